@@ -0,0 +1,15 @@
+#!/bin/sh
+# Runs the tests -- working around the vendored (2015) ugorji/go codec, whose base64 alphabet has a duplicate symbol: since Go 1.22
+# encoding/base64 panics on it at init, so any test binary importing client-go dies before running. The vendored sources are left
+# untouched: a fixed copy of codec/gen.go is passed to "go test" with -overlay. Extra arguments are passed on to "go test".
+set -e
+
+cd "$(dirname "$0")/.."
+gen=vendor/github.com/ugorji/go/codec/gen.go
+tmp=$(mktemp -d)
+trap 'rm -rf "$tmp"' EXIT
+
+sed 's/0123456789__")/0123456789_.")/' "$gen" > "$tmp/gen.go"
+printf '{"Replace": {"%s": "%s"}}\n' "$PWD/$gen" "$tmp/gen.go" > "$tmp/overlay.json"
+
+go test -overlay "$tmp/overlay.json" "$@" . ./handler/...
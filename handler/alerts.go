@@ -0,0 +1,155 @@
+package handler
+
+import (
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"io"
+	"net/http"
+	"os"
+	"sync"
+	"time"
+
+	"github.com/golang/glog"
+	//
+)
+
+// Alerts are sent to each of the AlertSinks -- as JSON objects -- and logged. An alert is "raised" when its condition first shows
+// up, and "resolved" when it goes away. The sinks are:
+// - a writer (e.g. stdout, or a file): one JSON object per line
+// - a webhook: one HTTP POST per alert, with the JSON object as the body
+//
+// Each sink has its own queue, drained by its own goroutine -- so a slow or dead sink (e.g. a webhook timing out) neither blocks
+// the watchers raising the alerts, nor the other sinks. Alerts are dropped (and logged) when the queue of a sink is full.
+
+// Alert is an alert being raised or resolved
+type Alert struct {
+	Time      time.Time `json:"time"`
+	Status    string    `json:"status"` // "raised" or "resolved"
+	Check     string    `json:"check"`
+	Namespace string    `json:"namespace"`
+	Pod       string    `json:"pod,omitempty"`
+	Container string    `json:"container,omitempty"`
+	Owner     string    `json:"owner,omitempty"` // The owning controller, e.g. "ReplicaSet/web-3712581235"
+	Detail    string    `json:"detail"`
+}
+
+// AlertSink is where alerts are sent
+type AlertSink interface {
+	Send(alert Alert) error
+	String() string
+}
+
+// AlertSinks are the configured alert sinks. Defaults to JSON lines on stdout. To be set before the first alert is sent
+var AlertSinks = []AlertSink{NewWriterSink(os.Stdout, "stdout")}
+
+// alertQueueSize is the number of alerts that may be waiting for each sink
+const alertQueueSize = 1000
+
+// alertQueue is the queue of alerts waiting for a sink
+type alertQueue struct {
+	sink   AlertSink
+	alerts chan Alert
+}
+
+var (
+	alertQueuesOnce sync.Once
+	alertQueues     []alertQueue
+)
+
+// startAlertSinks starts a goroutine per sink, sending the alerts of its queue
+func startAlertSinks() {
+	for _, sink := range AlertSinks {
+		q := alertQueue{sink, make(chan Alert, alertQueueSize)}
+		alertQueues = append(alertQueues, q)
+		go func(q alertQueue) {
+			for alert := range q.alerts {
+				if err := q.sink.Send(alert); err != nil {
+					glog.Errorf("Error sending alert to %s. Error: %s", q.sink, err)
+				}
+			}
+		}(q)
+	}
+}
+
+// writerSink writes the alerts as JSON lines
+type writerSink struct {
+	w    io.Writer
+	name string
+}
+
+// NewWriterSink returns a sink writing the alerts as JSON lines to a writer
+func NewWriterSink(w io.Writer, name string) AlertSink {
+	return &writerSink{w, name}
+}
+
+func (s *writerSink) Send(alert Alert) error {
+	b, err := json.Marshal(alert)
+	if err != nil {
+		return err
+	}
+	_, err = fmt.Fprintf(s.w, "%s\n", b)
+	return err
+}
+
+func (s *writerSink) String() string {
+	return s.name
+}
+
+// webhookSink POSTs the alerts to a URL
+type webhookSink struct {
+	url    string
+	client *http.Client
+}
+
+// NewWebhookSink returns a sink POSTing each alert (as JSON) to a URL
+func NewWebhookSink(url string) AlertSink {
+	return &webhookSink{url, &http.Client{Timeout: 5 * time.Second}}
+}
+
+func (s *webhookSink) Send(alert Alert) error {
+	b, err := json.Marshal(alert)
+	if err != nil {
+		return err
+	}
+	resp, err := s.client.Post(s.url, "application/json", bytes.NewReader(b))
+	if err != nil {
+		return err
+	}
+	defer resp.Body.Close()
+	if resp.StatusCode >= 300 {
+		return fmt.Errorf("unexpected HTTP status %s", resp.Status)
+	}
+	return nil
+}
+
+func (s *webhookSink) String() string {
+	return s.url
+}
+
+// sendAlert logs an alert and queues it for all the AlertSinks. It does not wait for the alert to be sent
+func sendAlert(alert Alert) {
+	alert.Time = time.Now().UTC()
+
+	what := objectName(alert.Namespace, alert.Pod)
+	if alert.Container != "" {
+		what += " [" + alert.Container + "]"
+	}
+	if alert.Owner != "" {
+		what += " (" + alert.Owner + ")"
+	}
+	if alert.Status == "resolved" {
+		glog.Infof("Resolved alert [%s] pod %s: %s", alert.Check, what, alert.Detail)
+	} else {
+		glog.Warningf("Alert [%s] pod %s: %s", alert.Check, what, alert.Detail)
+	}
+
+	alertQueuesOnce.Do(startAlertSinks)
+	for _, q := range alertQueues {
+		select {
+		case q.alerts <- alert:
+		default:
+			glog.Errorf("Alert queue of %s full -- dropping alert [%s] pod %s", q.sink, alert.Check, what)
+		}
+	}
+}
@@ -0,0 +1,189 @@
+package handler
+
+import (
+	"fmt"
+	"io"
+	"net/http"
+	"strings"
+
+	apiv1 "github.com/FlorianOtel/client-go/pkg/api/v1"
+	apiv1beta1 "github.com/FlorianOtel/client-go/pkg/apis/extensions/v1beta1"
+	metav1 "github.com/FlorianOtel/client-go/pkg/apis/meta/v1"
+)
+
+// "Can A reach B?": the verdict of the NetworkPolicies for a flow from a source Pod to a port of a destination Pod -- and why.
+// The explanation lists the policies selecting the destination, and for each of their ingress rules whether it admitted the flow
+// or which part of it (ports, peers selectors) failed to match.
+
+// RuleExplanation explains whether an ingress rule admits a flow
+type RuleExplanation struct {
+	Rule   int      `json:"rule"`
+	Admits bool     `json:"admits"`
+	Failed []string `json:"failed,omitempty"` // What didn't match, if the rule does not admit the flow
+}
+
+// PolicyExplanation explains the ingress rules of a policy selecting the destination
+type PolicyExplanation struct {
+	Policy string            `json:"policy"`
+	Rules  []RuleExplanation `json:"rules"`
+}
+
+// ReachExplanation is the answer to "can A reach B ?"
+type ReachExplanation struct {
+	Source      string              `json:"source"`
+	Destination string              `json:"destination"`
+	Port        string              `json:"port"`
+	Allowed     bool                `json:"allowed"`
+	Summary     string              `json:"summary"`
+	Policies    []PolicyExplanation `json:"policies"`     // The policies selecting the destination
+	NotSelected []string            `json:"notSelecting"` // The other policies of the destination namespace, and their podSelector
+}
+
+// LookupPod returns a cached Pod, given as "namespace/name"
+func LookupPod(name string) (*apiv1.Pod, error) {
+	if PodStore == nil {
+		return nil, fmt.Errorf("pods are not watched")
+	}
+	if !strings.Contains(name, "/") {
+		return nil, fmt.Errorf("invalid pod %q. Expected namespace/name", name)
+	}
+	obj, exists, err := PodStore.GetByKey(name)
+	if err != nil {
+		return nil, err
+	}
+	if !exists {
+		return nil, fmt.Errorf("unknown pod %q", name)
+	}
+	return obj.(*apiv1.Pod), nil
+}
+
+// explainPeer tells why a peer does not match a source Pod. Empty if it matches
+func explainPeer(np *apiv1beta1.NetworkPolicy, peer apiv1beta1.NetworkPolicyPeer, src *apiv1.Pod) string {
+	if peerMatchesPod(np, peer, src) {
+		return ""
+	}
+	if peer.PodSelector != nil {
+		if src.Namespace != np.Namespace {
+			return fmt.Sprintf("podSelector %q only selects pods in namespace %s (source is in %s)", metav1.FormatLabelSelector(peer.PodSelector), np.Namespace, src.Namespace)
+		}
+		return fmt.Sprintf("podSelector %q does not match source labels %v", metav1.FormatLabelSelector(peer.PodSelector), src.Labels)
+	}
+	if peer.NamespaceSelector != nil {
+		ns := cachedNamespace(src.Namespace)
+		if ns == nil {
+			return fmt.Sprintf("namespaceSelector %q: source namespace %s unknown", metav1.FormatLabelSelector(peer.NamespaceSelector), src.Namespace)
+		}
+		return fmt.Sprintf("namespaceSelector %q does not match labels %v of source namespace %s", metav1.FormatLabelSelector(peer.NamespaceSelector), ns.Labels, src.Namespace)
+	}
+	return "empty peer"
+}
+
+// explainRule explains whether an ingress rule admits a flow
+func explainRule(np *apiv1beta1.NetworkPolicy, i int, rule apiv1beta1.NetworkPolicyIngressRule, src, dst *apiv1.Pod, port FlowPort) RuleExplanation {
+	e := RuleExplanation{Rule: i}
+
+	if !ruleAdmitsPort(rule, dst, port) {
+		var ports []string
+		for _, p := range rule.Ports {
+			ports = append(ports, portString(p))
+		}
+		e.Failed = append(e.Failed, fmt.Sprintf("port %s not in %v", port, ports))
+	}
+	if !ruleAdmitsPeer(np, rule, src) {
+		for j, peer := range rule.From {
+			e.Failed = append(e.Failed, fmt.Sprintf("peer %d: %s", j, explainPeer(np, peer, src)))
+		}
+	}
+
+	e.Admits = len(e.Failed) == 0
+	return e
+}
+
+// ExplainReach evaluates a set of NetworkPolicies for a flow from "src" to a port of "dst", and explains the verdict
+func ExplainReach(policies []*apiv1beta1.NetworkPolicy, src, dst *apiv1.Pod, port FlowPort) ReachExplanation {
+	v := EvaluateIngress(policies, src, dst, port)
+	e := ReachExplanation{
+		Source:      objectName(src.Namespace, src.Name),
+		Destination: objectName(dst.Namespace, dst.Name),
+		Port:        port.String(),
+		Allowed:     v.Allowed,
+		Policies:    []PolicyExplanation{},
+		NotSelected: []string{},
+	}
+
+	switch {
+	case !v.Isolated:
+		e.Summary = fmt.Sprintf("allowed: namespace %s is not isolated (no DefaultDeny %s annotation), so NetworkPolicies do not apply", dst.Namespace, NetworkPolicyAnnotation)
+	case len(v.Selecting) == 0:
+		e.Summary = fmt.Sprintf("denied: namespace %s is isolated and no NetworkPolicy selects the destination", dst.Namespace)
+	case v.Allowed:
+		e.Summary = fmt.Sprintf("allowed by %s", strings.Join(v.AdmittedBy, ", "))
+	default:
+		e.Summary = fmt.Sprintf("denied: none of the rules of the %d NetworkPolicies selecting the destination admit the flow", len(v.Selecting))
+	}
+
+	for _, np := range policies {
+		if np.Namespace != dst.Namespace {
+			continue
+		}
+		name := objectName(np.Namespace, np.Name)
+		if !policySelectsPod(np, dst) {
+			e.NotSelected = append(e.NotSelected, fmt.Sprintf("%s (podSelector %q)", name, metav1.FormatLabelSelector(&np.Spec.PodSelector)))
+			continue
+		}
+		pe := PolicyExplanation{Policy: name, Rules: []RuleExplanation{}}
+		for i, rule := range np.Spec.Ingress {
+			pe.Rules = append(pe.Rules, explainRule(np, i, rule, src, dst, port))
+		}
+		e.Policies = append(e.Policies, pe)
+	}
+
+	return e
+}
+
+// PrintReachExplanation prints the answer to "can A reach B ?"
+func PrintReachExplanation(w io.Writer, e ReachExplanation) {
+	fmt.Fprintf(w, "Can %s reach %s on %s ? %s\n", e.Source, e.Destination, e.Port, e.Summary)
+	for _, p := range e.Policies {
+		fmt.Fprintf(w, "  networkpolicy %s selects the destination\n", p.Policy)
+		if len(p.Rules) == 0 {
+			fmt.Fprintf(w, "    no ingress rules: admits nothing\n")
+		}
+		for _, r := range p.Rules {
+			if r.Admits {
+				fmt.Fprintf(w, "    rule %d: admits\n", r.Rule)
+				continue
+			}
+			fmt.Fprintf(w, "    rule %d: does not admit\n", r.Rule)
+			for _, f := range r.Failed {
+				fmt.Fprintf(w, "      - %s\n", f)
+			}
+		}
+	}
+	for _, p := range e.NotSelected {
+		fmt.Fprintf(w, "  networkpolicy %s does not select the destination\n", p)
+	}
+}
+
+// CanReachHandler answers "can A reach B ?" over HTTP, e.g. /canreach?from=default/client&to=default/web&port=TCP/80
+func CanReachHandler(w http.ResponseWriter, r *http.Request) {
+	q := r.URL.Query()
+
+	src, err := LookupPod(q.Get("from"))
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusBadRequest)
+		return
+	}
+	dst, err := LookupPod(q.Get("to"))
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusBadRequest)
+		return
+	}
+	ports, err := ParseFlowPorts(q.Get("port"))
+	if err != nil || len(ports) != 1 {
+		http.Error(w, fmt.Sprintf("invalid port %q. Expected a single port, e.g. TCP/80", q.Get("port")), http.StatusBadRequest)
+		return
+	}
+
+	writeJSON(w, ExplainReach(CachedNetworkPolicies(), src, dst, ports[0]))
+}
@@ -0,0 +1,244 @@
+package handler
+
+import (
+	"fmt"
+	"io"
+	"net/http"
+	"sort"
+
+	"github.com/FlorianOtel/client-go/pkg/api/resource"
+	apiv1 "github.com/FlorianOtel/client-go/pkg/api/v1"
+)
+
+// Tenant capacity reporting: ResourceQuota hard limits vs. used amounts per namespace, and Pods violating the LimitRanges of their namespace
+
+// QuotaThreshold is the used / hard ratio above which a quota is flagged (e.g. 0.8 for 80%)
+var QuotaThreshold = 0.8
+
+// QuotaResources are the resources reported on -- in this order -- when present in a ResourceQuota
+var QuotaResources = []apiv1.ResourceName{
+	apiv1.ResourceCPU, apiv1.ResourceRequestsCPU, apiv1.ResourceLimitsCPU,
+	apiv1.ResourceMemory, apiv1.ResourceRequestsMemory, apiv1.ResourceLimitsMemory,
+	apiv1.ResourcePods,
+	apiv1.ResourceServices,
+	apiv1.ResourcePersistentVolumeClaims, apiv1.ResourceRequestsStorage,
+}
+
+// QuotaUsage is the usage of a single resource of a ResourceQuota
+type QuotaUsage struct {
+	Namespace     string  `json:"namespace"`
+	Quota         string  `json:"quota"`
+	Resource      string  `json:"resource"`
+	Hard          string  `json:"hard"`
+	Used          string  `json:"used"`
+	Ratio         float64 `json:"ratio"`
+	OverThreshold bool    `json:"overThreshold"`
+}
+
+// quotaRatio returns used / hard. A zero hard limit is "full" as soon as anything is used
+func quotaRatio(hard, used resource.Quantity) float64 {
+	if hard.MilliValue() == 0 {
+		if used.MilliValue() > 0 {
+			return 1
+		}
+		return 0
+	}
+	return float64(used.MilliValue()) / float64(hard.MilliValue())
+}
+
+// QuotaUsages returns the usage of the QuotaResources of all ResourceQuotas in a namespace -- or in all namespaces if "namespace" is empty
+func QuotaUsages(namespace string) []QuotaUsage {
+	var usages []QuotaUsage
+
+	if ResourceQuotaStore == nil {
+		return usages
+	}
+
+	for _, obj := range ResourceQuotaStore.List() {
+		quota := obj.(*apiv1.ResourceQuota)
+		if namespace != "" && quota.Namespace != namespace {
+			continue
+		}
+		usages = append(usages, quotaUsage(quota)...)
+	}
+
+	sort.SliceStable(usages, func(i, j int) bool {
+		if usages[i].Namespace != usages[j].Namespace {
+			return usages[i].Namespace < usages[j].Namespace
+		}
+		return usages[i].Quota < usages[j].Quota
+	})
+	return usages
+}
+
+// quotaUsage returns the usage of the QuotaResources of a ResourceQuota
+func quotaUsage(quota *apiv1.ResourceQuota) []QuotaUsage {
+	var usages []QuotaUsage
+
+	for _, name := range QuotaResources {
+		hard, ok := quota.Status.Hard[name]
+		if !ok {
+			continue
+		}
+		used := quota.Status.Used[name]
+		ratio := quotaRatio(hard, used)
+		usages = append(usages, QuotaUsage{
+			Namespace:     quota.Namespace,
+			Quota:         quota.Name,
+			Resource:      string(name),
+			Hard:          hard.String(),
+			Used:          used.String(),
+			Ratio:         ratio,
+			OverThreshold: ratio >= QuotaThreshold,
+		})
+	}
+	return usages
+}
+
+// PrintQuotaUsages prints the quota usages as a table, flagging the ones above the QuotaThreshold
+func PrintQuotaUsages(w io.Writer, usages []QuotaUsage) {
+	if len(usages) == 0 {
+		fmt.Fprintf(w, "  <no resource quotas>\n")
+		return
+	}
+	for _, u := range usages {
+		flag := ""
+		if u.OverThreshold {
+			flag = fmt.Sprintf("  <==== above %.0f%%", QuotaThreshold*100)
+		}
+		fmt.Fprintf(w, "  %-20s %-20s %-25s used %10s of %10s (%5.1f%%)%s\n", u.Namespace, u.Quota, u.Resource, u.Used, u.Hard, u.Ratio*100, flag)
+	}
+}
+
+// LimitRangeViolation is a Pod (or one of its containers) whose requests / limits violate a LimitRange of its namespace
+type LimitRangeViolation struct {
+	Namespace  string `json:"namespace"`
+	Pod        string `json:"pod"`
+	Container  string `json:"container,omitempty"` // Empty for Pod-level limits
+	LimitRange string `json:"limitRange"`
+	Violation  string `json:"violation"`
+}
+
+// CheckPodLimits checks a Pod against all the (cached) LimitRanges of its namespace
+func CheckPodLimits(pod *apiv1.Pod) []LimitRangeViolation {
+	var violations []LimitRangeViolation
+
+	if LimitRangeStore == nil {
+		return violations
+	}
+
+	for _, obj := range LimitRangeStore.List() {
+		lr := obj.(*apiv1.LimitRange)
+		if lr.Namespace != pod.Namespace {
+			continue
+		}
+		for _, item := range lr.Spec.Limits {
+			switch item.Type {
+			case apiv1.LimitTypeContainer:
+				for _, c := range pod.Spec.Containers {
+					for _, v := range checkLimits(item, c.Resources.Requests, c.Resources.Limits) {
+						violations = append(violations, LimitRangeViolation{pod.Namespace, pod.Name, c.Name, lr.Name, v})
+					}
+				}
+			case apiv1.LimitTypePod:
+				requests, limits := apiv1.ResourceList{}, apiv1.ResourceList{}
+				for _, c := range pod.Spec.Containers {
+					addResources(requests, c.Resources.Requests)
+					addResources(limits, c.Resources.Limits)
+				}
+				for _, v := range checkLimits(item, requests, limits) {
+					violations = append(violations, LimitRangeViolation{pod.Namespace, pod.Name, "", lr.Name, v})
+				}
+			}
+		}
+	}
+	return violations
+}
+
+// addResources adds the quantities of "add" to "sum"
+func addResources(sum, add apiv1.ResourceList) {
+	for name, q := range add {
+		total := sum[name]
+		total.Add(q)
+		sum[name] = total
+	}
+}
+
+// checkLimits checks requests / limits against the min, max and max limit / request ratio of a LimitRangeItem
+func checkLimits(item apiv1.LimitRangeItem, requests, limits apiv1.ResourceList) []string {
+	var violations []string
+
+	for name, min := range item.Min {
+		if req, ok := requests[name]; !ok {
+			violations = append(violations, fmt.Sprintf("no %s request (min %s)", name, min.String()))
+		} else if req.Cmp(min) < 0 {
+			violations = append(violations, fmt.Sprintf("%s request %s below min %s", name, req.String(), min.String()))
+		}
+	}
+	for name, max := range item.Max {
+		if lim, ok := limits[name]; !ok {
+			violations = append(violations, fmt.Sprintf("no %s limit (max %s)", name, max.String()))
+		} else if lim.Cmp(max) > 0 {
+			violations = append(violations, fmt.Sprintf("%s limit %s above max %s", name, lim.String(), max.String()))
+		}
+	}
+	for name, ratio := range item.MaxLimitRequestRatio {
+		req, hasReq := requests[name]
+		lim, hasLim := limits[name]
+		if !hasReq || !hasLim || req.MilliValue() == 0 {
+			continue
+		}
+		if actual := float64(lim.MilliValue()) / float64(req.MilliValue()); actual > float64(ratio.MilliValue())/1000 {
+			violations = append(violations, fmt.Sprintf("%s limit / request ratio %.2f above max %s", name, actual, ratio.String()))
+		}
+	}
+
+	sort.Strings(violations)
+	return violations
+}
+
+// NamespaceLimitViolations checks all the cached Pods of a namespace -- or of all namespaces if "namespace" is empty -- against their LimitRanges
+func NamespaceLimitViolations(namespace string) []LimitRangeViolation {
+	var violations []LimitRangeViolation
+
+	if PodStore == nil {
+		return violations
+	}
+
+	for _, obj := range PodStore.List() {
+		pod := obj.(*apiv1.Pod)
+		if namespace != "" && pod.Namespace != namespace {
+			continue
+		}
+		violations = append(violations, CheckPodLimits(pod)...)
+	}
+	return violations
+}
+
+// PrintLimitViolations prints the LimitRange violations
+func PrintLimitViolations(w io.Writer, violations []LimitRangeViolation) {
+	for _, v := range violations {
+		if v.Container != "" {
+			fmt.Fprintf(w, "  pod %s/%s, container %s violates limitrange %s: %s\n", v.Namespace, v.Pod, v.Container, v.LimitRange, v.Violation)
+		} else {
+			fmt.Fprintf(w, "  pod %s/%s violates limitrange %s: %s\n", v.Namespace, v.Pod, v.LimitRange, v.Violation)
+		}
+	}
+}
+
+// PrintNamespaceCapacity prints the capacity report of a namespace: quota usages and LimitRange violations
+func PrintNamespaceCapacity(w io.Writer, namespace string) {
+	fmt.Fprintf(w, " ######## namespace %s capacity ########\n", namespace)
+	PrintQuotaUsages(w, QuotaUsages(namespace))
+	PrintLimitViolations(w, NamespaceLimitViolations(namespace))
+}
+
+// CapacityHandler serves the capacity report over HTTP, e.g. /capacity[?namespace=default]
+func CapacityHandler(w http.ResponseWriter, r *http.Request) {
+	namespace := r.URL.Query().Get("namespace")
+	writeJSON(w, map[string]interface{}{
+		"threshold":       QuotaThreshold,
+		"quotas":          QuotaUsages(namespace),
+		"limitViolations": NamespaceLimitViolations(namespace),
+	})
+}
@@ -0,0 +1,349 @@
+package handler
+
+import (
+	"crypto/x509"
+	"encoding/asn1"
+	"encoding/pem"
+	"fmt"
+	"sort"
+	"strings"
+	"sync"
+
+	"github.com/golang/glog"
+	//
+
+	apiv1 "github.com/FlorianOtel/client-go/pkg/api/v1"
+	certificatesv1alpha1 "github.com/FlorianOtel/client-go/pkg/apis/certificates/v1alpha1"
+	metav1 "github.com/FlorianOtel/client-go/pkg/apis/meta/v1"
+)
+
+// CertificateSigningRequests are decoded (subject, SANs, key usages) and reported with their approval status.
+// Optionally, pending CSRs are run through a list of approval rules -- the first rule that reaches a decision wins. CSRs no rule
+// decides on are left to a human. In dry-run mode the decisions are only logged.
+
+// CSR approval modes
+const (
+	CSRApprovalOff    = "off"
+	CSRApprovalDryRun = "dry-run"
+	CSRApprovalOn     = "on"
+)
+
+// CSRApproval is the approval mode. One of CSRApprovalOff, CSRApprovalDryRun or CSRApprovalOn
+var CSRApproval = CSRApprovalOff
+
+// CSRRules are the names of the approval rules applied -- in this order -- to pending CSRs. See csrRules
+var CSRRules = []string{"kubelet-serving", "kubelet-client"}
+
+// CSRInfo is the decoded form of a CertificateSigningRequest
+type CSRInfo struct {
+	Requestor      string   `json:"requestor"`
+	Groups         []string `json:"groups,omitempty"`
+	CommonName     string   `json:"commonName"`
+	Organizations  []string `json:"organizations,omitempty"`
+	DNSNames       []string `json:"dnsNames,omitempty"`
+	IPAddresses    []string `json:"ipAddresses,omitempty"`
+	EmailAddresses []string `json:"emailAddresses,omitempty"`
+	KeyUsages      []string `json:"keyUsages,omitempty"`
+	ExtKeyUsages   []string `json:"extKeyUsages,omitempty"`
+	Status         string   `json:"status"` // "Pending", "Approved" or "Denied"
+	Issued         bool     `json:"issued"`
+	Error          string   `json:"error,omitempty"` // Set if the PEM request could not be decoded
+}
+
+// CSRDecision is the outcome of an approval rule
+type CSRDecision struct {
+	Rule    string
+	Approve bool
+	Reason  string
+}
+
+// csrRule decides on a pending CSR. Returns nil if the rule doesn't apply
+type csrRule func(csr *certificatesv1alpha1.CertificateSigningRequest, req *x509.CertificateRequest) *CSRDecision
+
+// csrRules are the available approval rules, by name
+var csrRules = map[string]csrRule{
+	"kubelet-serving": kubeletServingRule,
+	"kubelet-client":  kubeletClientRule,
+}
+
+// CSRRuleNames returns the names of the available approval rules, sorted
+func CSRRuleNames() []string {
+	var names []string
+	for name := range csrRules {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+	return names
+}
+
+// dry-run decisions already logged -- by CSR UID -- so resyncs / updates don't repeat them
+var (
+	csrDecidedMutex sync.Mutex
+	csrDecided      = make(map[string]bool)
+)
+
+// Object identifiers of the X.509 key usage extensions (RFC 5280)
+var (
+	oidKeyUsage    = asn1.ObjectIdentifier{2, 5, 29, 15}
+	oidExtKeyUsage = asn1.ObjectIdentifier{2, 5, 29, 37}
+)
+
+// keyUsageNames are the names of the key usage bits, in bit order
+var keyUsageNames = []string{"digital signature", "content commitment", "key encipherment", "data encipherment",
+	"key agreement", "cert sign", "crl sign", "encipher only", "decipher only"}
+
+// extKeyUsageNames are the names of the common extended key usages, by OID
+var extKeyUsageNames = map[string]string{
+	"1.3.6.1.5.5.7.3.1": "server auth",
+	"1.3.6.1.5.5.7.3.2": "client auth",
+	"1.3.6.1.5.5.7.3.3": "code signing",
+	"1.3.6.1.5.5.7.3.4": "email protection",
+	"1.3.6.1.5.5.7.3.8": "timestamping",
+	"1.3.6.1.5.5.7.3.9": "ocsp signing",
+}
+
+// decodeCSR parses the PEM-encoded PKCS#10 request of a CSR
+func decodeCSR(csr *certificatesv1alpha1.CertificateSigningRequest) (*x509.CertificateRequest, error) {
+	block, _ := pem.Decode(csr.Spec.Request)
+	if block == nil {
+		return nil, fmt.Errorf("no PEM data found in the request")
+	}
+	if block.Type != "CERTIFICATE REQUEST" && block.Type != "NEW CERTIFICATE REQUEST" {
+		return nil, fmt.Errorf("unexpected PEM block type %q", block.Type)
+	}
+	return x509.ParseCertificateRequest(block.Bytes)
+}
+
+// requestUsages returns the (extended) key usages requested via extensions. N.B. The v1alpha1 API has no "usages" field in the spec
+func requestUsages(req *x509.CertificateRequest) (usages, extUsages []string) {
+	for _, ext := range req.Extensions {
+		switch {
+		case ext.Id.Equal(oidKeyUsage):
+			var bits asn1.BitString
+			if _, err := asn1.Unmarshal(ext.Value, &bits); err != nil {
+				continue
+			}
+			for i, name := range keyUsageNames {
+				if bits.At(i) != 0 {
+					usages = append(usages, name)
+				}
+			}
+		case ext.Id.Equal(oidExtKeyUsage):
+			var oids []asn1.ObjectIdentifier
+			if _, err := asn1.Unmarshal(ext.Value, &oids); err != nil {
+				continue
+			}
+			for _, oid := range oids {
+				if name, ok := extKeyUsageNames[oid.String()]; ok {
+					extUsages = append(extUsages, name)
+				} else {
+					extUsages = append(extUsages, oid.String())
+				}
+			}
+		}
+	}
+	return usages, extUsages
+}
+
+// csrStatus returns "Approved" or "Denied" (whichever condition is latest), else "Pending"
+func csrStatus(csr *certificatesv1alpha1.CertificateSigningRequest) string {
+	status := "Pending"
+	for _, c := range csr.Status.Conditions {
+		switch c.Type {
+		case certificatesv1alpha1.CertificateApproved, certificatesv1alpha1.CertificateDenied:
+			status = string(c.Type)
+		}
+	}
+	return status
+}
+
+// csrInfo decodes a CSR
+func csrInfo(csr *certificatesv1alpha1.CertificateSigningRequest) CSRInfo {
+	info := CSRInfo{
+		Requestor: csr.Spec.Username,
+		Groups:    csr.Spec.Groups,
+		Status:    csrStatus(csr),
+		Issued:    len(csr.Status.Certificate) > 0,
+	}
+
+	req, err := decodeCSR(csr)
+	if err != nil {
+		info.Error = err.Error()
+		return info
+	}
+
+	info.CommonName = req.Subject.CommonName
+	info.Organizations = req.Subject.Organization
+	info.DNSNames = req.DNSNames
+	for _, ip := range req.IPAddresses {
+		info.IPAddresses = append(info.IPAddresses, ip.String())
+	}
+	info.EmailAddresses = req.EmailAddresses
+	info.KeyUsages, info.ExtKeyUsages = requestUsages(req)
+	return info
+}
+
+// kubeletIdentity returns the node name if the CSR is requested by a node for itself: requestor "system:node:<node>" in group
+// "system:nodes", with a matching subject (CN "system:node:<node>", O "system:nodes"). Empty otherwise
+func kubeletIdentity(csr *certificatesv1alpha1.CertificateSigningRequest, req *x509.CertificateRequest) string {
+	const prefix = "system:node:"
+
+	if !strings.HasPrefix(csr.Spec.Username, prefix) {
+		return ""
+	}
+	inNodesGroup := false
+	for _, g := range csr.Spec.Groups {
+		inNodesGroup = inNodesGroup || g == "system:nodes"
+	}
+	if !inNodesGroup {
+		return ""
+	}
+	if req.Subject.CommonName != csr.Spec.Username || len(req.Subject.Organization) != 1 || req.Subject.Organization[0] != "system:nodes" {
+		return ""
+	}
+	return strings.TrimPrefix(csr.Spec.Username, prefix)
+}
+
+// kubeletServingRule approves a kubelet serving certificate if all its SANs are addresses of the (cached) node -- and denies it otherwise
+func kubeletServingRule(csr *certificatesv1alpha1.CertificateSigningRequest, req *x509.CertificateRequest) *CSRDecision {
+	node := kubeletIdentity(csr, req)
+	if node == "" || len(req.DNSNames)+len(req.IPAddresses) == 0 || len(req.EmailAddresses) > 0 || NodeStore == nil {
+		return nil
+	}
+
+	obj, exists, err := NodeStore.GetByKey(node)
+	if err != nil || !exists {
+		return nil // Unknown (yet) node: leave it to a human
+	}
+
+	addresses := make(map[string]bool)
+	for _, a := range obj.(*apiv1.Node).Status.Addresses {
+		addresses[a.Address] = true
+	}
+
+	var unknown []string
+	for _, name := range req.DNSNames {
+		if !addresses[name] {
+			unknown = append(unknown, name)
+		}
+	}
+	for _, ip := range req.IPAddresses {
+		if !addresses[ip.String()] {
+			unknown = append(unknown, ip.String())
+		}
+	}
+	if len(unknown) > 0 {
+		return &CSRDecision{Approve: false, Reason: fmt.Sprintf("SAN(s) %v are not addresses of node %s", unknown, node)}
+	}
+	return &CSRDecision{Approve: true, Reason: fmt.Sprintf("kubelet serving certificate; all SANs are addresses of node %s", node)}
+}
+
+// kubeletClientRule approves a kubelet client certificate (no SANs) requested by a node for itself
+func kubeletClientRule(csr *certificatesv1alpha1.CertificateSigningRequest, req *x509.CertificateRequest) *CSRDecision {
+	node := kubeletIdentity(csr, req)
+	if node == "" || len(req.DNSNames)+len(req.IPAddresses)+len(req.EmailAddresses) > 0 {
+		return nil
+	}
+	return &CSRDecision{Approve: true, Reason: fmt.Sprintf("kubelet client certificate requested by node %s for itself", node)}
+}
+
+// DecideCSR runs the CSRRules on a CSR. Returns nil if no rule reaches a decision
+func DecideCSR(csr *certificatesv1alpha1.CertificateSigningRequest) *CSRDecision {
+	req, err := decodeCSR(csr)
+	if err != nil {
+		return nil
+	}
+	for _, name := range CSRRules {
+		rule, ok := csrRules[name]
+		if !ok {
+			glog.Warningf("Unknown CSR approval rule %q", name)
+			continue
+		}
+		if d := rule(csr, req); d != nil {
+			d.Rule = name
+			return d
+		}
+	}
+	return nil
+}
+
+// processCSR applies the approval rules to a pending CSR -- or just logs the decision in dry-run mode
+func processCSR(csr *certificatesv1alpha1.CertificateSigningRequest) {
+	if CSRApproval == CSRApprovalOff || csrStatus(csr) != "Pending" {
+		return
+	}
+
+	d := DecideCSR(csr)
+	if d == nil {
+		glog.Infof("No approval rule applies to CSR %s -- left for manual approval", csr.Name)
+		return
+	}
+
+	verdict, condition := "deny", certificatesv1alpha1.CertificateDenied
+	if d.Approve {
+		verdict, condition = "approve", certificatesv1alpha1.CertificateApproved
+	}
+
+	if CSRApproval == CSRApprovalDryRun {
+		csrDecidedMutex.Lock()
+		defer csrDecidedMutex.Unlock()
+		if !csrDecided[string(csr.UID)] {
+			csrDecided[string(csr.UID)] = true
+			glog.Infof("[dry-run] Would %s CSR %s (rule %s): %s", verdict, csr.Name, d.Rule, d.Reason)
+		}
+		return
+	}
+
+	if Clientset == nil {
+		glog.Errorf("Cannot %s CSR %s: no client", verdict, csr.Name)
+		return
+	}
+
+	// Don't modify the cached object
+	decided := *csr
+	decided.Status.Conditions = append(append([]certificatesv1alpha1.CertificateSigningRequestCondition{}, csr.Status.Conditions...),
+		certificatesv1alpha1.CertificateSigningRequestCondition{
+			Type:           condition,
+			Reason:         "AutoApprovalRule",
+			Message:        fmt.Sprintf("rule %s: %s", d.Rule, d.Reason),
+			LastUpdateTime: metav1.Now(),
+		})
+
+	if _, err := Clientset.Certificates().CertificateSigningRequests().UpdateApproval(&decided); err != nil {
+		glog.Errorf("Error trying to %s CSR %s. Error: %s", verdict, csr.Name, err)
+		return
+	}
+	glog.Infof("=====> CSR %s: %sd by rule %s: %s", csr.Name, verdict, d.Rule, d.Reason)
+}
+
+func CertificateSigningRequestCreated(csr *certificatesv1alpha1.CertificateSigningRequest) error {
+	glog.Info("=====> A certificatesigningrequest got created")
+	JsonPrettyPrint("certificatesigningrequest", csr)
+	processCSR(csr)
+	return nil
+}
+
+func CertificateSigningRequestDeleted(csr *certificatesv1alpha1.CertificateSigningRequest) error {
+	glog.Info("=====> A certificatesigningrequest got deleted")
+	JsonPrettyPrint("certificatesigningrequest", csr)
+
+	csrDecidedMutex.Lock()
+	delete(csrDecided, string(csr.UID))
+	csrDecidedMutex.Unlock()
+	return nil
+}
+
+// Report approval status changes and certificate issuance
+func CertificateSigningRequestUpdated(old, updated *certificatesv1alpha1.CertificateSigningRequest) error {
+	oldStatus, newStatus := csrStatus(old), csrStatus(updated)
+	oldIssued, newIssued := len(old.Status.Certificate) > 0, len(updated.Status.Certificate) > 0
+
+	if oldStatus != newStatus {
+		glog.Infof("=====> A certificatesigningrequest got updated: %s %s -> %s", updated.Name, oldStatus, newStatus)
+	}
+	if !oldIssued && newIssued {
+		glog.Infof("=====> A certificatesigningrequest got updated: %s certificate issued", updated.Name)
+	}
+	processCSR(updated)
+	return nil
+}
@@ -0,0 +1,36 @@
+package handler
+
+import (
+	"github.com/golang/glog"
+	//
+
+	rbacv1alpha1 "github.com/FlorianOtel/client-go/pkg/apis/rbac/v1alpha1"
+)
+
+func ClusterRoleCreated(clusterrole *rbacv1alpha1.ClusterRole) error {
+	glog.Info("=====> A clusterrole got created")
+	JsonPrettyPrint("clusterrole", clusterrole)
+	// The ClusterRoles listed at startup already existed: only the ones created while we run are audited
+	if clusterrole.CreationTimestamp.Time.Before(startTime) {
+		return nil
+	}
+	reportRules("created", "ClusterRole", clusterrole.Namespace, clusterrole.Name, nil, clusterrole.Rules)
+	return nil
+}
+
+func ClusterRoleDeleted(clusterrole *rbacv1alpha1.ClusterRole) error {
+	glog.Info("=====> A clusterrole got deleted")
+	JsonPrettyPrint("clusterrole", clusterrole)
+	reportRules("deleted", "ClusterRole", clusterrole.Namespace, clusterrole.Name, clusterrole.Rules, nil)
+	return nil
+}
+
+// Report the rule-level changes: rules added / removed, and verbs, apiGroups, resources etc added to / removed from existing rules
+func ClusterRoleUpdated(old, updated *rbacv1alpha1.ClusterRole) error {
+	if len(diffRules(old.Rules, updated.Rules)) == 0 {
+		return nil
+	}
+	glog.Infof("=====> A clusterrole got updated: %s", objectName(updated.Namespace, updated.Name))
+	reportRules("updated", "ClusterRole", updated.Namespace, updated.Name, old.Rules, updated.Rules)
+	return nil
+}
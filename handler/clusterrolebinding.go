@@ -0,0 +1,37 @@
+package handler
+
+import (
+	"github.com/golang/glog"
+	//
+
+	rbacv1alpha1 "github.com/FlorianOtel/client-go/pkg/apis/rbac/v1alpha1"
+)
+
+func ClusterRoleBindingCreated(clusterrolebinding *rbacv1alpha1.ClusterRoleBinding) error {
+	glog.Info("=====> A clusterrolebinding got created")
+	JsonPrettyPrint("clusterrolebinding", clusterrolebinding)
+	// The ClusterRoleBindings listed at startup already existed: only the ones created while we run are audited
+	if clusterrolebinding.CreationTimestamp.Time.Before(startTime) {
+		return nil
+	}
+	reportSubjects("created", "ClusterRoleBinding", clusterrolebinding.Namespace, clusterrolebinding.Name, clusterrolebinding.RoleRef, nil, clusterrolebinding.Subjects)
+	return nil
+}
+
+func ClusterRoleBindingDeleted(clusterrolebinding *rbacv1alpha1.ClusterRoleBinding) error {
+	glog.Info("=====> A clusterrolebinding got deleted")
+	JsonPrettyPrint("clusterrolebinding", clusterrolebinding)
+	reportSubjects("deleted", "ClusterRoleBinding", clusterrolebinding.Namespace, clusterrolebinding.Name, clusterrolebinding.RoleRef, clusterrolebinding.Subjects, nil)
+	return nil
+}
+
+// Report who was added to / removed from the binding (and any change of the role it refers to)
+func ClusterRoleBindingUpdated(old, updated *rbacv1alpha1.ClusterRoleBinding) error {
+	if old.RoleRef == updated.RoleRef && subjectsEqual(old.Subjects, updated.Subjects) {
+		return nil
+	}
+	glog.Infof("=====> A clusterrolebinding got updated: %s", objectName(updated.Namespace, updated.Name))
+	reportRoleRef("ClusterRoleBinding", updated.Namespace, updated.Name, old.RoleRef, updated.RoleRef)
+	reportSubjects("updated", "ClusterRoleBinding", updated.Namespace, updated.Name, updated.RoleRef, old.Subjects, updated.Subjects)
+	return nil
+}
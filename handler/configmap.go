@@ -0,0 +1,58 @@
+package handler
+
+import (
+	"fmt"
+
+	"github.com/golang/glog"
+	//
+
+	apiv1 "github.com/FlorianOtel/client-go/pkg/api/v1"
+)
+
+// ConfigMapDiffLimit is the maximum size (in bytes, old and new values combined) of a ConfigMap value for which a full line-by-line diff is printed on update.
+// Zero disables value diffs -- only the names of the changed keys are printed.
+var ConfigMapDiffLimit = 0
+
+func ConfigMapCreated(configmap *apiv1.ConfigMap) error {
+	glog.Info("=====> A configmap got created")
+	JsonPrettyPrint("configmap", configmap)
+	printReferences("configmap", configmap.Namespace, configmap.Name, PodsReferencingConfigMap(configmap.Namespace, configmap.Name))
+	return nil
+}
+
+func ConfigMapDeleted(configmap *apiv1.ConfigMap) error {
+	glog.Info("=====> A configmap got deleted")
+	JsonPrettyPrint("configmap", configmap)
+	printReferences("configmap", configmap.Namespace, configmap.Name, PodsReferencingConfigMap(configmap.Namespace, configmap.Name))
+	return nil
+}
+
+// Report which keys were added, removed or changed -- and which Pods are affected by the change
+func ConfigMapUpdated(old, updated *apiv1.ConfigMap) error {
+	added, removed, changed := diffKeys(old.Data, updated.Data)
+
+	// Periodic resyncs / metadata-only updates
+	if len(added)+len(removed)+len(changed) == 0 {
+		return nil
+	}
+
+	glog.Infof("=====> A configmap got updated: %s/%s", updated.Namespace, updated.Name)
+
+	for _, k := range added {
+		fmt.Printf("  key %q added\n", k)
+	}
+	for _, k := range removed {
+		fmt.Printf("  key %q removed\n", k)
+	}
+	for _, k := range changed {
+		fmt.Printf("  key %q changed\n", k)
+		if ConfigMapDiffLimit > 0 && len(old.Data[k])+len(updated.Data[k]) <= ConfigMapDiffLimit {
+			for _, line := range diffLines(old.Data[k], updated.Data[k]) {
+				fmt.Printf("    %s\n", line)
+			}
+		}
+	}
+
+	printReferences("configmap", updated.Namespace, updated.Name, PodsReferencingConfigMap(updated.Namespace, updated.Name))
+	return nil
+}
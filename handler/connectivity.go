@@ -0,0 +1,337 @@
+package handler
+
+import (
+	"encoding/csv"
+	"fmt"
+	"io"
+	"net/http"
+	"sort"
+	"strconv"
+	"strings"
+
+	apiv1 "github.com/FlorianOtel/client-go/pkg/api/v1"
+	apiv1beta1 "github.com/FlorianOtel/client-go/pkg/apis/extensions/v1beta1"
+	"github.com/FlorianOtel/client-go/pkg/util/intstr"
+)
+
+// Connectivity matrix: the ingress allowed by the NetworkPolicies between all the (cached) Pods -- or between groups of Pods:
+// namespaces, or the values of a given label -- on given ports. See netpolselection.go for the (beta) semantics.
+// Traffic from a Pod to itself is never subject to NetworkPolicies, and is left out.
+
+// FlowPort is a destination port, e.g. TCP/80
+type FlowPort struct {
+	Protocol apiv1.Protocol
+	Port     int32
+}
+
+func (p FlowPort) String() string {
+	return fmt.Sprintf("%s/%d", p.Protocol, p.Port)
+}
+
+// ParseFlowPorts parses a comma-separated list of ports, e.g. "TCP/80,UDP/53". The protocol defaults to TCP
+func ParseFlowPorts(s string) ([]FlowPort, error) {
+	var ports []FlowPort
+	for _, item := range strings.Split(s, ",") {
+		item = strings.TrimSpace(item)
+		if item == "" {
+			continue
+		}
+		protocol, number := apiv1.ProtocolTCP, item
+		if i := strings.Index(item, "/"); i >= 0 {
+			protocol, number = apiv1.Protocol(strings.ToUpper(item[:i])), item[i+1:]
+		}
+		if protocol != apiv1.ProtocolTCP && protocol != apiv1.ProtocolUDP {
+			return nil, fmt.Errorf("invalid protocol in %q. Expected TCP or UDP", item)
+		}
+		port, err := strconv.ParseInt(number, 10, 32)
+		if err != nil || port < 1 || port > 65535 {
+			return nil, fmt.Errorf("invalid port in %q", item)
+		}
+		ports = append(ports, FlowPort{protocol, int32(port)})
+	}
+	if len(ports) == 0 {
+		return nil, fmt.Errorf("no ports given")
+	}
+	return ports, nil
+}
+
+// IngressVerdict is the outcome of evaluating the NetworkPolicies for a flow from a source to a destination Pod
+type IngressVerdict struct {
+	Allowed    bool     `json:"allowed"`
+	Isolated   bool     `json:"isolated"`   // Whether the destination namespace is isolated. If not, all ingress is allowed
+	Selecting  []string `json:"selecting"`  // The policies selecting the destination Pod
+	AdmittedBy []string `json:"admittedBy"` // The policy rules admitting the flow, e.g. "default/web rule 0"
+}
+
+// containerPort resolves a named port of a Pod
+func containerPort(pod *apiv1.Pod, name string, protocol apiv1.Protocol) (int32, bool) {
+	for _, c := range pod.Spec.Containers {
+		for _, p := range c.Ports {
+			pp := p.Protocol
+			if pp == "" {
+				pp = apiv1.ProtocolTCP
+			}
+			if p.Name == name && pp == protocol {
+				return p.ContainerPort, true
+			}
+		}
+	}
+	return 0, false
+}
+
+// policyPortMatches tells whether a NetworkPolicyPort covers a port of the destination Pod. Named ports are resolved against the Pod
+func policyPortMatches(p apiv1beta1.NetworkPolicyPort, dst *apiv1.Pod, port FlowPort) bool {
+	protocol := apiv1.ProtocolTCP
+	if p.Protocol != nil {
+		protocol = *p.Protocol
+	}
+	if protocol != port.Protocol {
+		return false
+	}
+	if p.Port == nil {
+		return true
+	}
+	if p.Port.Type == intstr.String {
+		number, ok := containerPort(dst, p.Port.StrVal, protocol)
+		return ok && number == port.Port
+	}
+	return p.Port.IntVal == port.Port
+}
+
+// ruleAdmitsPort tells whether an ingress rule covers a port of the destination Pod. No ports: all ports
+func ruleAdmitsPort(rule apiv1beta1.NetworkPolicyIngressRule, dst *apiv1.Pod, port FlowPort) bool {
+	if len(rule.Ports) == 0 {
+		return true
+	}
+	for _, p := range rule.Ports {
+		if policyPortMatches(p, dst, port) {
+			return true
+		}
+	}
+	return false
+}
+
+// ruleAdmitsPeer tells whether an ingress rule admits a source Pod. No "from": all sources
+func ruleAdmitsPeer(np *apiv1beta1.NetworkPolicy, rule apiv1beta1.NetworkPolicyIngressRule, src *apiv1.Pod) bool {
+	if len(rule.From) == 0 {
+		return true
+	}
+	for _, peer := range rule.From {
+		if peerMatchesPod(np, peer, src) {
+			return true
+		}
+	}
+	return false
+}
+
+// EvaluateIngress evaluates a set of NetworkPolicies for a flow from "src" to a port of "dst"
+func EvaluateIngress(policies []*apiv1beta1.NetworkPolicy, src, dst *apiv1.Pod, port FlowPort) IngressVerdict {
+	v := IngressVerdict{Isolated: namespaceIsolated(dst.Namespace), Selecting: []string{}, AdmittedBy: []string{}}
+	if !v.Isolated {
+		v.Allowed = true
+		return v
+	}
+
+	for _, np := range policies {
+		if !policySelectsPod(np, dst) {
+			continue
+		}
+		v.Selecting = append(v.Selecting, objectName(np.Namespace, np.Name))
+		for i, rule := range np.Spec.Ingress {
+			if ruleAdmitsPort(rule, dst, port) && ruleAdmitsPeer(np, rule, src) {
+				v.AdmittedBy = append(v.AdmittedBy, fmt.Sprintf("%s rule %d", objectName(np.Namespace, np.Name), i))
+			}
+		}
+	}
+	v.Allowed = len(v.AdmittedBy) > 0
+	return v
+}
+
+// ConnectivityCell is the ingress allowed from a source group to a destination group on a port
+type ConnectivityCell struct {
+	Source      string `json:"source"`
+	Destination string `json:"destination"`
+	Port        string `json:"port"`
+	Verdict     string `json:"verdict"` // "allowed", "denied" -- or "partial" when only some of the Pod pairs of the groups are allowed
+	Allowed     int    `json:"allowed"` // Number of Pod pairs allowed
+	Total       int    `json:"total"`   // Number of Pod pairs
+}
+
+// ConnectivityMatrix is the ingress allowed between all groups of Pods, on each port
+type ConnectivityMatrix struct {
+	GroupBy string             `json:"groupBy"`
+	Groups  []string           `json:"groups"`
+	Ports   []string           `json:"ports"`
+	Cells   []ConnectivityCell `json:"cells"`
+}
+
+// podGroup returns the group of a Pod: the Pod itself ("pod"), its namespace ("namespace"), or the value of a label ("label:<key>")
+func podGroup(pod *apiv1.Pod, groupBy string) string {
+	switch {
+	case groupBy == "namespace":
+		return pod.Namespace
+	case strings.HasPrefix(groupBy, "label:"):
+		key := strings.TrimPrefix(groupBy, "label:")
+		if value, ok := pod.Labels[key]; ok {
+			return key + "=" + value
+		}
+		return key + "=<none>"
+	default:
+		return objectName(pod.Namespace, pod.Name)
+	}
+}
+
+// validGroupBy checks a grouping
+func validGroupBy(groupBy string) error {
+	if groupBy == "pod" || groupBy == "namespace" || (strings.HasPrefix(groupBy, "label:") && len(groupBy) > len("label:")) {
+		return nil
+	}
+	return fmt.Errorf("invalid grouping %q. Expected one of: pod, namespace, label:<key>", groupBy)
+}
+
+// ComputeConnectivity computes the connectivity matrix between the cached (running) Pods for a set of NetworkPolicies
+func ComputeConnectivity(policies []*apiv1beta1.NetworkPolicy, groupBy string, ports []FlowPort) (ConnectivityMatrix, error) {
+	m := ConnectivityMatrix{GroupBy: groupBy, Groups: []string{}, Ports: []string{}, Cells: []ConnectivityCell{}}
+	if err := validGroupBy(groupBy); err != nil {
+		return m, err
+	}
+
+	var pods []*apiv1.Pod
+	groups := make(map[string]bool)
+	for _, pod := range cachedPods() {
+		if podTerminated(pod) {
+			continue
+		}
+		pods = append(pods, pod)
+		groups[podGroup(pod, groupBy)] = true
+	}
+	for g := range groups {
+		m.Groups = append(m.Groups, g)
+	}
+	sort.Strings(m.Groups)
+
+	for _, port := range ports {
+		m.Ports = append(m.Ports, port.String())
+
+		cells := make(map[[2]string]*ConnectivityCell)
+		for _, src := range pods {
+			for _, dst := range pods {
+				if src == dst {
+					continue
+				}
+				key := [2]string{podGroup(src, groupBy), podGroup(dst, groupBy)}
+				cell, ok := cells[key]
+				if !ok {
+					cell = &ConnectivityCell{Source: key[0], Destination: key[1], Port: port.String()}
+					cells[key] = cell
+				}
+				cell.Total++
+				if EvaluateIngress(policies, src, dst, port).Allowed {
+					cell.Allowed++
+				}
+			}
+		}
+
+		for _, src := range m.Groups {
+			for _, dst := range m.Groups {
+				cell, ok := cells[[2]string{src, dst}]
+				if !ok {
+					continue
+				}
+				switch cell.Allowed {
+				case cell.Total:
+					cell.Verdict = "allowed"
+				case 0:
+					cell.Verdict = "denied"
+				default:
+					cell.Verdict = "partial"
+				}
+				m.Cells = append(m.Cells, *cell)
+			}
+		}
+	}
+
+	return m, nil
+}
+
+// WriteConnectivity writes a connectivity matrix as "csv" (one line per source / destination / port), "json" or "dot"
+// (a graph with an edge per allowed -- or partially allowed -- source / destination pair, labelled with the ports)
+func WriteConnectivity(w io.Writer, m ConnectivityMatrix, format string) error {
+	switch format {
+	case "csv":
+		cw := csv.NewWriter(w)
+		cw.Write([]string{"source", "destination", "port", "verdict", "allowed", "total"})
+		for _, c := range m.Cells {
+			cw.Write([]string{c.Source, c.Destination, c.Port, c.Verdict, strconv.Itoa(c.Allowed), strconv.Itoa(c.Total)})
+		}
+		cw.Flush()
+		return cw.Error()
+	case "json":
+		return writeIndentedJSON(w, m)
+	case "dot":
+		edges := make(map[[2]string][]string)
+		var order [][2]string
+		for _, c := range m.Cells {
+			if c.Verdict == "denied" {
+				continue
+			}
+			key := [2]string{c.Source, c.Destination}
+			if _, ok := edges[key]; !ok {
+				order = append(order, key)
+			}
+			label := c.Port
+			if c.Verdict == "partial" {
+				label += fmt.Sprintf(" (%d/%d)", c.Allowed, c.Total)
+			}
+			edges[key] = append(edges[key], label)
+		}
+
+		fmt.Fprintf(w, "digraph connectivity {\n")
+		for _, g := range m.Groups {
+			fmt.Fprintf(w, "  %q;\n", g)
+		}
+		for _, key := range order {
+			fmt.Fprintf(w, "  %q -> %q [label=%q];\n", key[0], key[1], strings.Join(edges[key], ", "))
+		}
+		fmt.Fprintf(w, "}\n")
+		return nil
+	default:
+		return fmt.Errorf("invalid format %q. Expected one of: csv, json, dot", format)
+	}
+}
+
+// ConnectivityHandler serves the connectivity matrix over HTTP, e.g. /connectivity?ports=TCP/80,UDP/53[&group=namespace][&format=csv]
+func ConnectivityHandler(w http.ResponseWriter, r *http.Request) {
+	q := r.URL.Query()
+
+	ports, err := ParseFlowPorts(q.Get("ports"))
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusBadRequest)
+		return
+	}
+	groupBy, format := q.Get("group"), q.Get("format")
+	if groupBy == "" {
+		groupBy = "pod"
+	}
+	if format == "" {
+		format = "json"
+	}
+
+	m, err := ComputeConnectivity(CachedNetworkPolicies(), groupBy, ports)
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusBadRequest)
+		return
+	}
+	switch format {
+	case "csv":
+		w.Header().Set("Content-Type", "text/csv")
+	case "dot":
+		w.Header().Set("Content-Type", "text/vnd.graphviz")
+	case "json":
+		writeJSON(w, m)
+		return
+	}
+	if err := WriteConnectivity(w, m, format); err != nil {
+		http.Error(w, err.Error(), http.StatusBadRequest)
+	}
+}
@@ -0,0 +1,149 @@
+package handler
+
+import (
+	"reflect"
+	"testing"
+
+	apiv1 "github.com/FlorianOtel/client-go/pkg/api/v1"
+	apiv1beta1 "github.com/FlorianOtel/client-go/pkg/apis/extensions/v1beta1"
+	metav1 "github.com/FlorianOtel/client-go/pkg/apis/meta/v1"
+	"github.com/FlorianOtel/client-go/pkg/util/intstr"
+	"github.com/FlorianOtel/client-go/tools/cache"
+)
+
+// withNamespaces sets up the Namespace store with the given Namespaces for the duration of a test
+func withNamespaces(t *testing.T, namespaces ...*apiv1.Namespace) {
+	saved := NamespaceStore
+	t.Cleanup(func() { NamespaceStore = saved })
+
+	NamespaceStore = cache.NewStore(cache.MetaNamespaceKeyFunc)
+	for _, ns := range namespaces {
+		if err := NamespaceStore.Add(ns); err != nil {
+			t.Fatal(err)
+		}
+	}
+}
+
+// isolated is the annotation enabling the ingress isolation of a namespace
+var connIsolated = map[string]string{NetworkPolicyAnnotation: `{"ingress": {"isolation": "DefaultDeny"}}`}
+
+// The connectivity fixture:
+// - "prod" and "ops" are isolated, "dev" is not
+// - prod/web only admits prod/client on its "http" port (8080), and anything from the namespaces labelled role=monitoring
+// - prod/db only admits UDP/53; prod/client is selected by no policy
+var (
+	connectivityNamespaces = []*apiv1.Namespace{
+		{ObjectMeta: apiv1.ObjectMeta{Name: "prod", Annotations: connIsolated}},
+		{ObjectMeta: apiv1.ObjectMeta{Name: "dev"}},
+		{ObjectMeta: apiv1.ObjectMeta{Name: "ops", Labels: map[string]string{"role": "monitoring"}, Annotations: connIsolated}},
+	}
+
+	connClient = &apiv1.Pod{ObjectMeta: apiv1.ObjectMeta{Namespace: "prod", Name: "client", Labels: map[string]string{"app": "client"}}}
+	connWeb    = &apiv1.Pod{
+		ObjectMeta: apiv1.ObjectMeta{Namespace: "prod", Name: "web", Labels: map[string]string{"app": "web"}},
+		Spec:       apiv1.PodSpec{Containers: []apiv1.Container{{Name: "web", Ports: []apiv1.ContainerPort{{Name: "http", ContainerPort: 8080}}}}},
+	}
+	connDB         = &apiv1.Pod{ObjectMeta: apiv1.ObjectMeta{Namespace: "prod", Name: "db", Labels: map[string]string{"app": "db"}}}
+	connDone       = &apiv1.Pod{ObjectMeta: apiv1.ObjectMeta{Namespace: "prod", Name: "done"}, Status: apiv1.PodStatus{Phase: apiv1.PodSucceeded}}
+	connTester     = &apiv1.Pod{ObjectMeta: apiv1.ObjectMeta{Namespace: "dev", Name: "tester"}}
+	connPrometheus = &apiv1.Pod{ObjectMeta: apiv1.ObjectMeta{Namespace: "ops", Name: "prometheus"}}
+
+	connHTTPPort = intstr.FromString("http")
+	connDNSPort  = intstr.FromInt(53)
+	connUDP      = apiv1.ProtocolUDP
+
+	connectivityPolicies = []*apiv1beta1.NetworkPolicy{
+		{
+			ObjectMeta: apiv1.ObjectMeta{Namespace: "prod", Name: "web-from-client"},
+			Spec: apiv1beta1.NetworkPolicySpec{
+				PodSelector: metav1.LabelSelector{MatchLabels: map[string]string{"app": "web"}},
+				Ingress: []apiv1beta1.NetworkPolicyIngressRule{{
+					Ports: []apiv1beta1.NetworkPolicyPort{{Port: &connHTTPPort}},
+					From:  []apiv1beta1.NetworkPolicyPeer{{PodSelector: &metav1.LabelSelector{MatchLabels: map[string]string{"app": "client"}}}},
+				}},
+			},
+		},
+		{
+			ObjectMeta: apiv1.ObjectMeta{Namespace: "prod", Name: "web-from-monitoring"},
+			Spec: apiv1beta1.NetworkPolicySpec{
+				PodSelector: metav1.LabelSelector{MatchLabels: map[string]string{"app": "web"}},
+				Ingress: []apiv1beta1.NetworkPolicyIngressRule{{
+					From: []apiv1beta1.NetworkPolicyPeer{{NamespaceSelector: &metav1.LabelSelector{MatchLabels: map[string]string{"role": "monitoring"}}}},
+				}},
+			},
+		},
+		{
+			ObjectMeta: apiv1.ObjectMeta{Namespace: "prod", Name: "db-dns"},
+			Spec: apiv1beta1.NetworkPolicySpec{
+				PodSelector: metav1.LabelSelector{MatchLabels: map[string]string{"app": "db"}},
+				Ingress:     []apiv1beta1.NetworkPolicyIngressRule{{Ports: []apiv1beta1.NetworkPolicyPort{{Protocol: &connUDP, Port: &connDNSPort}}}},
+			},
+		},
+	}
+)
+
+func TestEvaluateIngress(t *testing.T) {
+	withNamespaces(t, connectivityNamespaces...)
+
+	webPolicies := []string{"prod/web-from-client", "prod/web-from-monitoring"}
+	tests := []struct {
+		name     string
+		src, dst *apiv1.Pod
+		port     FlowPort
+		expected IngressVerdict
+	}{
+		{"not isolated", connClient, connTester, FlowPort{apiv1.ProtocolTCP, 1234},
+			IngressVerdict{Allowed: true, Selecting: []string{}, AdmittedBy: []string{}}},
+		{"named port", connClient, connWeb, FlowPort{apiv1.ProtocolTCP, 8080},
+			IngressVerdict{Allowed: true, Isolated: true, Selecting: webPolicies, AdmittedBy: []string{"prod/web-from-client rule 0"}}},
+		{"other port", connClient, connWeb, FlowPort{apiv1.ProtocolTCP, 80},
+			IngressVerdict{Isolated: true, Selecting: webPolicies, AdmittedBy: []string{}}},
+		{"other protocol", connClient, connWeb, FlowPort{apiv1.ProtocolUDP, 8080},
+			IngressVerdict{Isolated: true, Selecting: webPolicies, AdmittedBy: []string{}}},
+		{"namespace selector", connPrometheus, connWeb, FlowPort{apiv1.ProtocolTCP, 9100},
+			IngressVerdict{Allowed: true, Isolated: true, Selecting: webPolicies, AdmittedBy: []string{"prod/web-from-monitoring rule 0"}}},
+		// A podSelector peer only matches Pods in the namespace of the policy
+		{"pod selector in another namespace", connTester, connWeb, FlowPort{apiv1.ProtocolTCP, 8080},
+			IngressVerdict{Isolated: true, Selecting: webPolicies, AdmittedBy: []string{}}},
+		{"no from: all sources", connTester, connDB, FlowPort{apiv1.ProtocolUDP, 53},
+			IngressVerdict{Allowed: true, Isolated: true, Selecting: []string{"prod/db-dns"}, AdmittedBy: []string{"prod/db-dns rule 0"}}},
+		{"no policy selecting", connWeb, connClient, FlowPort{apiv1.ProtocolTCP, 8080},
+			IngressVerdict{Isolated: true, Selecting: []string{}, AdmittedBy: []string{}}},
+	}
+	for _, test := range tests {
+		if v := EvaluateIngress(connectivityPolicies, test.src, test.dst, test.port); !reflect.DeepEqual(v, test.expected) {
+			t.Errorf("%s: EvaluateIngress(%s -> %s %s) = %+v, expected %+v", test.name, test.src.Name, test.dst.Name, test.port, v, test.expected)
+		}
+	}
+}
+
+func TestComputeConnectivity(t *testing.T) {
+	withNamespaces(t, connectivityNamespaces...)
+	withPods(t, connClient, connWeb, connDB, connDone, connTester, connPrometheus)
+
+	m, err := ComputeConnectivity(connectivityPolicies, "namespace", []FlowPort{{apiv1.ProtocolTCP, 8080}})
+	if err != nil {
+		t.Fatal(err)
+	}
+	expected := ConnectivityMatrix{
+		GroupBy: "namespace",
+		Groups:  []string{"dev", "ops", "prod"},
+		Ports:   []string{"TCP/8080"},
+		Cells: []ConnectivityCell{
+			{"dev", "ops", "TCP/8080", "denied", 0, 1},
+			{"dev", "prod", "TCP/8080", "denied", 0, 3},
+			{"ops", "dev", "TCP/8080", "allowed", 1, 1},
+			{"ops", "prod", "TCP/8080", "partial", 1, 3},
+			{"prod", "dev", "TCP/8080", "allowed", 3, 3},
+			{"prod", "ops", "TCP/8080", "denied", 0, 3},
+			{"prod", "prod", "TCP/8080", "partial", 1, 6},
+		},
+	}
+	if !reflect.DeepEqual(m, expected) {
+		t.Errorf("ComputeConnectivity = %+v, expected %+v", m, expected)
+	}
+
+	if _, err := ComputeConnectivity(connectivityPolicies, "label:", nil); err == nil {
+		t.Errorf("ComputeConnectivity(label:): expected an error")
+	}
+}
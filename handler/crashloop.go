@@ -0,0 +1,250 @@
+package handler
+
+import (
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"sort"
+	"sync"
+	"time"
+
+	apiv1 "github.com/FlorianOtel/client-go/pkg/api/v1"
+	"github.com/FlorianOtel/client-go/pkg/types"
+)
+
+// Container failure detection, from the Pod status updates. The checks are:
+// - "crashloop":          a container is in CrashLoopBackOff
+// - "restart-storm":      a container restarted RestartThreshold times or more within RestartWindow
+// - "oomkilled":          a container got OOMKilled -- alerted once per termination, never resolved
+// - "image-pull-backoff": a container image cannot be pulled (ImagePullBackOff / ErrImagePull)
+//
+// Alerts are de-duplicated: raised once when the condition shows up, resolved when it goes away -- or when the Pod is deleted.
+// The conditions are re-evaluated on each Pod update. Restart rates are computed from the restarts observed while we run; as a
+// container that stopped restarting produces no more Pod updates, the restart storms are also re-evaluated periodically
+// (ExpireRestartStorms).
+
+// RestartThreshold is the number of restarts within RestartWindow making a restart storm
+var RestartThreshold = 5
+
+// RestartWindow is the window over which restarts are counted
+var RestartWindow = 10 * time.Minute
+
+// podAlertState is the alert state of a Pod
+type podAlertState struct {
+	restarts map[string][]time.Time // Container -> times of the restarts observed within the RestartWindow
+	active   map[string]Alert       // Condition key -> raised alert
+	oomKills map[string]bool        // OOM kills already alerted on
+}
+
+var (
+	podAlertMutex sync.Mutex
+	podAlerts     = make(map[types.UID]*podAlertState)
+)
+
+// PodOwner returns the controller owning a Pod, as "Kind/name" -- from its ownerReferences or, for older controllers, its
+// created-by annotation. Empty if it has none
+func PodOwner(pod *apiv1.Pod) string {
+	for _, ref := range pod.OwnerReferences {
+		if ref.Controller != nil && *ref.Controller {
+			return ref.Kind + "/" + ref.Name
+		}
+	}
+	if len(pod.OwnerReferences) > 0 {
+		return pod.OwnerReferences[0].Kind + "/" + pod.OwnerReferences[0].Name
+	}
+	if createdBy, ok := pod.Annotations[apiv1.CreatedByAnnotation]; ok {
+		var ref apiv1.SerializedReference
+		if err := json.Unmarshal([]byte(createdBy), &ref); err == nil && ref.Reference.Kind != "" {
+			return ref.Reference.Kind + "/" + ref.Reference.Name
+		}
+	}
+	return ""
+}
+
+// containerStatuses returns the statuses of all the containers of a Pod -- init containers included -- by name
+func containerStatuses(pod *apiv1.Pod) map[string]apiv1.ContainerStatus {
+	statuses := make(map[string]apiv1.ContainerStatus)
+	for _, cs := range pod.Status.InitContainerStatuses {
+		statuses[cs.Name] = cs
+	}
+	for _, cs := range pod.Status.ContainerStatuses {
+		statuses[cs.Name] = cs
+	}
+	return statuses
+}
+
+// lastTermination describes the last termination of a container, if any
+func lastTermination(cs apiv1.ContainerStatus) string {
+	if t := cs.LastTerminationState.Terminated; t != nil {
+		return "; last termination: " + terminationDetail(t)
+	}
+	return ""
+}
+
+// checkPodAlerts evaluates the alert conditions on the updated state of a Pod -- "old" is nil for newly observed Pods -- and
+// raises / resolves the corresponding alerts
+func checkPodAlerts(old, updated *apiv1.Pod) {
+	podAlertMutex.Lock()
+	defer podAlertMutex.Unlock()
+
+	state, ok := podAlerts[updated.UID]
+	if !ok {
+		state = &podAlertState{restarts: make(map[string][]time.Time), active: make(map[string]Alert), oomKills: make(map[string]bool)}
+		podAlerts[updated.UID] = state
+	}
+
+	now := time.Now()
+	owner := PodOwner(updated)
+	alert := func(check, container, detail string) Alert {
+		return Alert{Time: now.UTC(), Status: "raised", Check: check, Namespace: updated.Namespace, Pod: updated.Name, Container: container, Owner: owner, Detail: detail}
+	}
+
+	var previous map[string]apiv1.ContainerStatus
+	if old != nil {
+		previous = containerStatuses(old)
+	}
+
+	current := make(map[string]Alert)
+	for name, cs := range containerStatuses(updated) {
+		if w := cs.State.Waiting; w != nil {
+			switch w.Reason {
+			case "CrashLoopBackOff":
+				current["crashloop|"+name] = alert("crashloop", name, fmt.Sprintf("back-off restarting, %d restart(s)%s", cs.RestartCount, lastTermination(cs)))
+			case "ImagePullBackOff", "ErrImagePull":
+				current["image-pull-backoff|"+name] = alert("image-pull-backoff", name, fmt.Sprintf("%s for image %s: %s", w.Reason, cs.Image, w.Message))
+			}
+		}
+
+		// Restart rate
+		if prev, ok := previous[name]; ok && cs.RestartCount > prev.RestartCount {
+			for i := prev.RestartCount; i < cs.RestartCount; i++ {
+				state.restarts[name] = append(state.restarts[name], now)
+			}
+		}
+		var recent []time.Time
+		for _, t := range state.restarts[name] {
+			if now.Sub(t) <= RestartWindow {
+				recent = append(recent, t)
+			}
+		}
+		state.restarts[name] = recent
+		if len(recent) >= RestartThreshold {
+			current["restart-storm|"+name] = alert("restart-storm", name, fmt.Sprintf("%d restarts within %s (threshold: %d)%s", len(recent), RestartWindow, RestartThreshold, lastTermination(cs)))
+		}
+
+		// OOM kills: one alert per termination
+		for _, t := range []*apiv1.ContainerStateTerminated{cs.State.Terminated, cs.LastTerminationState.Terminated} {
+			if t == nil || t.Reason != "OOMKilled" {
+				continue
+			}
+			key := fmt.Sprintf("%s|%s|%s", name, t.ContainerID, t.FinishedAt)
+			if !state.oomKills[key] {
+				state.oomKills[key] = true
+				sendAlert(alert("oomkilled", name, fmt.Sprintf("OOMKilled at %s, %d restart(s) -- memory limit %s", t.FinishedAt.UTC().Format(time.RFC3339),
+					cs.RestartCount, memoryLimit(updated, name))))
+			}
+		}
+	}
+
+	for key, a := range current {
+		if _, raised := state.active[key]; !raised {
+			state.active[key] = a
+			sendAlert(a)
+		}
+	}
+	for key, a := range state.active {
+		if _, holds := current[key]; !holds {
+			delete(state.active, key)
+			a.Status = "resolved"
+			sendAlert(a)
+		}
+	}
+}
+
+// ExpireRestartStorms drops the restarts that fell out of the RestartWindow, and resolves the restart-storm alerts no longer
+// reaching the RestartThreshold. Meant to be run periodically (e.g. via wait.Until)
+func ExpireRestartStorms() {
+	podAlertMutex.Lock()
+	defer podAlertMutex.Unlock()
+
+	now := time.Now()
+	for _, state := range podAlerts {
+		for name, restarts := range state.restarts {
+			var recent []time.Time
+			for _, t := range restarts {
+				if now.Sub(t) <= RestartWindow {
+					recent = append(recent, t)
+				}
+			}
+			if len(recent) == 0 {
+				delete(state.restarts, name)
+			} else {
+				state.restarts[name] = recent
+			}
+
+			key := "restart-storm|" + name
+			if a, raised := state.active[key]; raised && len(recent) < RestartThreshold {
+				delete(state.active, key)
+				a.Status = "resolved"
+				a.Detail = fmt.Sprintf("%d restart(s) within %s (threshold: %d)", len(recent), RestartWindow, RestartThreshold)
+				sendAlert(a)
+			}
+		}
+	}
+}
+
+// memoryLimit returns the memory limit of a container, if any
+func memoryLimit(pod *apiv1.Pod, container string) string {
+	for _, c := range append(append([]apiv1.Container{}, pod.Spec.InitContainers...), pod.Spec.Containers...) {
+		if c.Name != container {
+			continue
+		}
+		if limit, ok := c.Resources.Limits[apiv1.ResourceMemory]; ok {
+			return limit.String()
+		}
+	}
+	return "<none>"
+}
+
+// forgetPodAlerts resolves the active alerts of a deleted Pod, and drops its alert state
+func forgetPodAlerts(pod *apiv1.Pod) {
+	podAlertMutex.Lock()
+	defer podAlertMutex.Unlock()
+
+	if state, ok := podAlerts[pod.UID]; ok {
+		for _, a := range state.active {
+			a.Status = "resolved"
+			a.Detail = "pod deleted"
+			sendAlert(a)
+		}
+		delete(podAlerts, pod.UID)
+	}
+}
+
+// ActiveAlerts returns the currently raised Pod alerts, sorted by namespace / pod / check
+func ActiveAlerts() []Alert {
+	podAlertMutex.Lock()
+	defer podAlertMutex.Unlock()
+
+	alerts := []Alert{}
+	for _, state := range podAlerts {
+		for _, a := range state.active {
+			alerts = append(alerts, a)
+		}
+	}
+	sort.Slice(alerts, func(i, j int) bool {
+		if alerts[i].Namespace != alerts[j].Namespace {
+			return alerts[i].Namespace < alerts[j].Namespace
+		}
+		if alerts[i].Pod != alerts[j].Pod {
+			return alerts[i].Pod < alerts[j].Pod
+		}
+		return alerts[i].Check+alerts[i].Container < alerts[j].Check+alerts[j].Container
+	})
+	return alerts
+}
+
+// AlertsHandler serves the currently raised Pod alerts over HTTP: /alerts
+func AlertsHandler(w http.ResponseWriter, r *http.Request) {
+	writeJSON(w, ActiveAlerts())
+}
@@ -0,0 +1,33 @@
+package handler
+
+import (
+	"github.com/golang/glog"
+	//
+
+	apiv1beta1 "github.com/FlorianOtel/client-go/pkg/apis/extensions/v1beta1"
+)
+
+func DaemonSetCreated(ds *apiv1beta1.DaemonSet) error {
+	glog.Info("=====> A daemonset got created")
+	JsonPrettyPrint("daemonset", ds)
+	return nil
+}
+
+func DaemonSetDeleted(ds *apiv1beta1.DaemonSet) error {
+	glog.Info("=====> A daemonset got deleted")
+	JsonPrettyPrint("daemonset", ds)
+	return nil
+}
+
+// Only image changes are reported -- scaling and status updates are left out
+func DaemonSetUpdated(old, updated *apiv1beta1.DaemonSet) error {
+	changes := templateImageChanges(old.Spec.Template, updated.Spec.Template)
+	if len(changes) == 0 {
+		return nil
+	}
+	glog.Infof("=====> A daemonset got updated: %s", objectName(updated.Namespace, updated.Name))
+	for _, c := range changes {
+		glog.Infof("  %s", c)
+	}
+	return nil
+}
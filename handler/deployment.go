@@ -0,0 +1,33 @@
+package handler
+
+import (
+	"github.com/golang/glog"
+	//
+
+	apiv1beta1 "github.com/FlorianOtel/client-go/pkg/apis/extensions/v1beta1"
+)
+
+func DeploymentCreated(deploy *apiv1beta1.Deployment) error {
+	glog.Info("=====> A deployment got created")
+	JsonPrettyPrint("deployment", deploy)
+	return nil
+}
+
+func DeploymentDeleted(deploy *apiv1beta1.Deployment) error {
+	glog.Info("=====> A deployment got deleted")
+	JsonPrettyPrint("deployment", deploy)
+	return nil
+}
+
+// Only image changes are reported -- scaling and status updates are left out
+func DeploymentUpdated(old, updated *apiv1beta1.Deployment) error {
+	changes := templateImageChanges(old.Spec.Template, updated.Spec.Template)
+	if len(changes) == 0 {
+		return nil
+	}
+	glog.Infof("=====> A deployment got updated: %s", objectName(updated.Namespace, updated.Name))
+	for _, c := range changes {
+		glog.Infof("  %s", c)
+	}
+	return nil
+}
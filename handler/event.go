@@ -0,0 +1,25 @@
+package handler
+
+import (
+	apiv1 "github.com/FlorianOtel/client-go/pkg/api/v1"
+)
+
+// Events are far too chatty to be printed: the ones about Pods are only recorded in the Pod timelines
+
+func EventCreated(event *apiv1.Event) error {
+	recordPodEvent(event)
+	return nil
+}
+
+// Expired Events are garbage-collected by the API server -- they stay in the Pod timelines
+func EventDeleted(event *apiv1.Event) error {
+	return nil
+}
+
+// Repeated Events are updates of the same Event, with an increased count
+func EventUpdated(old, updated *apiv1.Event) error {
+	if old.Count != updated.Count || old.Message != updated.Message {
+		recordPodEvent(updated)
+	}
+	return nil
+}
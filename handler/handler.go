@@ -8,28 +8,80 @@ Original code: https://github.com/aporeto-inc/trireme-kubernetes/blob/master/kub
 package handler
 
 import (
+	"reflect"
 	"time"
 
 	"github.com/golang/glog"
 	//
 	"github.com/FlorianOtel/client-go/kubernetes"
 	apiv1 "github.com/FlorianOtel/client-go/pkg/api/v1"
+	appsv1beta1 "github.com/FlorianOtel/client-go/pkg/apis/apps/v1beta1"
+	autoscalingv1 "github.com/FlorianOtel/client-go/pkg/apis/autoscaling/v1"
+	certificatesv1alpha1 "github.com/FlorianOtel/client-go/pkg/apis/certificates/v1alpha1"
 	apiv1beta1 "github.com/FlorianOtel/client-go/pkg/apis/extensions/v1beta1"
+	policyv1beta1 "github.com/FlorianOtel/client-go/pkg/apis/policy/v1beta1"
+	rbacv1alpha1 "github.com/FlorianOtel/client-go/pkg/apis/rbac/v1alpha1"
+	storagev1beta1 "github.com/FlorianOtel/client-go/pkg/apis/storage/v1beta1"
 	"github.com/FlorianOtel/client-go/pkg/fields"
 	"github.com/FlorianOtel/client-go/pkg/runtime"
 	"github.com/FlorianOtel/client-go/tools/cache"
 	// "github.com/FlorianOtel/client-go/pkg/util/wait"
 )
 
+// startTime is when we started -- the objects created before it already existed, rather than got created while we run
+var startTime = time.Now()
+
+// Local caches of the watched resources. They are set by the caller once the corresponding controllers are created,
+// and are used by handlers that need to correlate objects of different types (e.g. which Pods reference a given ConfigMap).
+// A nil store simply means that resource is not being watched.
+var (
+	PodStore                       cache.Store
+	ServiceStore                   cache.Store
+	NamespaceStore                 cache.Store
+	NetworkPolicyStore             cache.Store
+	NodeStore                      cache.Store
+	PodDisruptionBudgetStore       cache.Store
+	PersistentVolumeStore          cache.Store
+	PersistentVolumeClaimStore     cache.Store
+	ResourceQuotaStore             cache.Store
+	LimitRangeStore                cache.Store
+	SecretStore                    cache.Store
+	ServiceAccountStore            cache.Store
+	RoleStore                      cache.Store
+	ClusterRoleStore               cache.Store
+	RoleBindingStore               cache.Store
+	ClusterRoleBindingStore        cache.Store
+	PodSecurityPolicyStore         cache.Store
+	DeploymentStore                cache.Store
+	DaemonSetStore                 cache.Store
+	StatefulSetStore               cache.Store
+	ConfigMapStore                 cache.Store
+	StorageClassStore              cache.Store
+	HorizontalPodAutoscalerStore   cache.Store
+	CertificateSigningRequestStore cache.Store
+)
+
 // CreateResourceController creates a controller for a specific ressource and namespace.
-// The parameter function will be called on Add/Delete/Update events
+// The parameter function will be called on Add/Delete/Update events -- then the rules are applied
 func CreateResourceController(client cache.Getter, resource string, namespace string, obj runtime.Object, selector fields.Selector,
 	addFunc func(addedObj interface{}), deleteFunc func(deletedObj interface{}), updateFunc func(oldObj, updatedObj interface{})) (cache.Store, *cache.Controller) {
 
+	kind := reflect.Indirect(reflect.ValueOf(obj)).Type().Name()
+	registerRuleTarget(kind, client, resource)
+
 	handlers := cache.ResourceEventHandlerFuncs{
-		AddFunc:    addFunc,
-		DeleteFunc: deleteFunc,
-		UpdateFunc: updateFunc,
+		AddFunc: func(addedObj interface{}) {
+			addFunc(addedObj)
+			applyRules(kind, RuleCreated, addedObj)
+		},
+		DeleteFunc: func(deletedObj interface{}) {
+			deleteFunc(deletedObj)
+			applyRules(kind, RuleDeleted, deletedObj)
+		},
+		UpdateFunc: func(oldObj, updatedObj interface{}) {
+			updateFunc(oldObj, updatedObj)
+			applyRules(kind, RuleUpdated, updatedObj)
+		},
 	}
 
 	listWatch := cache.NewListWatchFromClient(client, resource, namespace, selector)
@@ -156,3 +208,448 @@ func CreateNodeController(c *kubernetes.Clientset,
 			}
 		})
 }
+
+// CreateConfigMapController creates a controller specifically for ConfigMaps.
+func CreateConfigMapController(c *kubernetes.Clientset, namespace string,
+	addFunc func(addedObj *apiv1.ConfigMap) error, deleteFunc func(deletedObj *apiv1.ConfigMap) error, updateFunc func(oldObj, updatedObj *apiv1.ConfigMap) error) (cache.Store, *cache.Controller) {
+	return CreateResourceController(c.Core().RESTClient(), "configmaps", namespace, &apiv1.ConfigMap{}, fields.Everything(),
+		func(addedObj interface{}) {
+			if err := addFunc(addedObj.(*apiv1.ConfigMap)); err != nil {
+				glog.Infof("Error while handling Add ConfigMap: %s ", err)
+			}
+		},
+		func(deletedObj interface{}) {
+			if err := deleteFunc(deletedObj.(*apiv1.ConfigMap)); err != nil {
+				glog.Infof("Error while handling Delete ConfigMap: %s ", err)
+			}
+		},
+		func(oldObj, updatedObj interface{}) {
+			if err := updateFunc(oldObj.(*apiv1.ConfigMap), updatedObj.(*apiv1.ConfigMap)); err != nil {
+				glog.Infof("Error while handling Update ConfigMap: %s ", err)
+			}
+		})
+}
+
+// CreateSecretController creates a controller specifically for Secrets.
+func CreateSecretController(c *kubernetes.Clientset, namespace string,
+	addFunc func(addedObj *apiv1.Secret) error, deleteFunc func(deletedObj *apiv1.Secret) error, updateFunc func(oldObj, updatedObj *apiv1.Secret) error) (cache.Store, *cache.Controller) {
+	return CreateResourceController(c.Core().RESTClient(), "secrets", namespace, &apiv1.Secret{}, fields.Everything(),
+		func(addedObj interface{}) {
+			if err := addFunc(addedObj.(*apiv1.Secret)); err != nil {
+				glog.Infof("Error while handling Add Secret: %s ", err)
+			}
+		},
+		func(deletedObj interface{}) {
+			if err := deleteFunc(deletedObj.(*apiv1.Secret)); err != nil {
+				glog.Infof("Error while handling Delete Secret: %s ", err)
+			}
+		},
+		func(oldObj, updatedObj interface{}) {
+			if err := updateFunc(oldObj.(*apiv1.Secret), updatedObj.(*apiv1.Secret)); err != nil {
+				glog.Infof("Error while handling Update Secret: %s ", err)
+			}
+		})
+}
+
+// CreatePersistentVolumeController creates a controller specifically for PersistentVolumes.
+func CreatePersistentVolumeController(c *kubernetes.Clientset,
+	addFunc func(addedObj *apiv1.PersistentVolume) error, deleteFunc func(deletedObj *apiv1.PersistentVolume) error, updateFunc func(oldObj, updatedObj *apiv1.PersistentVolume) error) (cache.Store, *cache.Controller) {
+	return CreateResourceController(c.Core().RESTClient(), "persistentvolumes", "", &apiv1.PersistentVolume{}, fields.Everything(),
+		func(addedObj interface{}) {
+			if err := addFunc(addedObj.(*apiv1.PersistentVolume)); err != nil {
+				glog.Infof("Error while handling Add PersistentVolume: %s ", err)
+			}
+		},
+		func(deletedObj interface{}) {
+			if err := deleteFunc(deletedObj.(*apiv1.PersistentVolume)); err != nil {
+				glog.Infof("Error while handling Delete PersistentVolume: %s ", err)
+			}
+		},
+		func(oldObj, updatedObj interface{}) {
+			if err := updateFunc(oldObj.(*apiv1.PersistentVolume), updatedObj.(*apiv1.PersistentVolume)); err != nil {
+				glog.Infof("Error while handling Update PersistentVolume: %s ", err)
+			}
+		})
+}
+
+// CreatePersistentVolumeClaimController creates a controller specifically for PersistentVolumeClaims.
+func CreatePersistentVolumeClaimController(c *kubernetes.Clientset, namespace string,
+	addFunc func(addedObj *apiv1.PersistentVolumeClaim) error, deleteFunc func(deletedObj *apiv1.PersistentVolumeClaim) error, updateFunc func(oldObj, updatedObj *apiv1.PersistentVolumeClaim) error) (cache.Store, *cache.Controller) {
+	return CreateResourceController(c.Core().RESTClient(), "persistentvolumeclaims", namespace, &apiv1.PersistentVolumeClaim{}, fields.Everything(),
+		func(addedObj interface{}) {
+			if err := addFunc(addedObj.(*apiv1.PersistentVolumeClaim)); err != nil {
+				glog.Infof("Error while handling Add PersistentVolumeClaim: %s ", err)
+			}
+		},
+		func(deletedObj interface{}) {
+			if err := deleteFunc(deletedObj.(*apiv1.PersistentVolumeClaim)); err != nil {
+				glog.Infof("Error while handling Delete PersistentVolumeClaim: %s ", err)
+			}
+		},
+		func(oldObj, updatedObj interface{}) {
+			if err := updateFunc(oldObj.(*apiv1.PersistentVolumeClaim), updatedObj.(*apiv1.PersistentVolumeClaim)); err != nil {
+				glog.Infof("Error while handling Update PersistentVolumeClaim: %s ", err)
+			}
+		})
+}
+
+// CreateStorageClassController creates a controller specifically for StorageClasses.
+func CreateStorageClassController(c *kubernetes.Clientset,
+	addFunc func(addedObj *storagev1beta1.StorageClass) error, deleteFunc func(deletedObj *storagev1beta1.StorageClass) error, updateFunc func(oldObj, updatedObj *storagev1beta1.StorageClass) error) (cache.Store, *cache.Controller) {
+	return CreateResourceController(c.Storage().RESTClient(), "storageclasses", "", &storagev1beta1.StorageClass{}, fields.Everything(),
+		func(addedObj interface{}) {
+			if err := addFunc(addedObj.(*storagev1beta1.StorageClass)); err != nil {
+				glog.Infof("Error while handling Add StorageClass: %s ", err)
+			}
+		},
+		func(deletedObj interface{}) {
+			if err := deleteFunc(deletedObj.(*storagev1beta1.StorageClass)); err != nil {
+				glog.Infof("Error while handling Delete StorageClass: %s ", err)
+			}
+		},
+		func(oldObj, updatedObj interface{}) {
+			if err := updateFunc(oldObj.(*storagev1beta1.StorageClass), updatedObj.(*storagev1beta1.StorageClass)); err != nil {
+				glog.Infof("Error while handling Update StorageClass: %s ", err)
+			}
+		})
+}
+
+// CreateRoleController creates a controller specifically for Roles.
+func CreateRoleController(c *kubernetes.Clientset, namespace string,
+	addFunc func(addedObj *rbacv1alpha1.Role) error, deleteFunc func(deletedObj *rbacv1alpha1.Role) error, updateFunc func(oldObj, updatedObj *rbacv1alpha1.Role) error) (cache.Store, *cache.Controller) {
+	return CreateResourceController(c.Rbac().RESTClient(), "roles", namespace, &rbacv1alpha1.Role{}, fields.Everything(),
+		func(addedObj interface{}) {
+			if err := addFunc(addedObj.(*rbacv1alpha1.Role)); err != nil {
+				glog.Infof("Error while handling Add Role: %s ", err)
+			}
+		},
+		func(deletedObj interface{}) {
+			if err := deleteFunc(deletedObj.(*rbacv1alpha1.Role)); err != nil {
+				glog.Infof("Error while handling Delete Role: %s ", err)
+			}
+		},
+		func(oldObj, updatedObj interface{}) {
+			if err := updateFunc(oldObj.(*rbacv1alpha1.Role), updatedObj.(*rbacv1alpha1.Role)); err != nil {
+				glog.Infof("Error while handling Update Role: %s ", err)
+			}
+		})
+}
+
+// CreateClusterRoleController creates a controller specifically for ClusterRoles.
+func CreateClusterRoleController(c *kubernetes.Clientset,
+	addFunc func(addedObj *rbacv1alpha1.ClusterRole) error, deleteFunc func(deletedObj *rbacv1alpha1.ClusterRole) error, updateFunc func(oldObj, updatedObj *rbacv1alpha1.ClusterRole) error) (cache.Store, *cache.Controller) {
+	return CreateResourceController(c.Rbac().RESTClient(), "clusterroles", "", &rbacv1alpha1.ClusterRole{}, fields.Everything(),
+		func(addedObj interface{}) {
+			if err := addFunc(addedObj.(*rbacv1alpha1.ClusterRole)); err != nil {
+				glog.Infof("Error while handling Add ClusterRole: %s ", err)
+			}
+		},
+		func(deletedObj interface{}) {
+			if err := deleteFunc(deletedObj.(*rbacv1alpha1.ClusterRole)); err != nil {
+				glog.Infof("Error while handling Delete ClusterRole: %s ", err)
+			}
+		},
+		func(oldObj, updatedObj interface{}) {
+			if err := updateFunc(oldObj.(*rbacv1alpha1.ClusterRole), updatedObj.(*rbacv1alpha1.ClusterRole)); err != nil {
+				glog.Infof("Error while handling Update ClusterRole: %s ", err)
+			}
+		})
+}
+
+// CreateRoleBindingController creates a controller specifically for RoleBindings.
+func CreateRoleBindingController(c *kubernetes.Clientset, namespace string,
+	addFunc func(addedObj *rbacv1alpha1.RoleBinding) error, deleteFunc func(deletedObj *rbacv1alpha1.RoleBinding) error, updateFunc func(oldObj, updatedObj *rbacv1alpha1.RoleBinding) error) (cache.Store, *cache.Controller) {
+	return CreateResourceController(c.Rbac().RESTClient(), "rolebindings", namespace, &rbacv1alpha1.RoleBinding{}, fields.Everything(),
+		func(addedObj interface{}) {
+			if err := addFunc(addedObj.(*rbacv1alpha1.RoleBinding)); err != nil {
+				glog.Infof("Error while handling Add RoleBinding: %s ", err)
+			}
+		},
+		func(deletedObj interface{}) {
+			if err := deleteFunc(deletedObj.(*rbacv1alpha1.RoleBinding)); err != nil {
+				glog.Infof("Error while handling Delete RoleBinding: %s ", err)
+			}
+		},
+		func(oldObj, updatedObj interface{}) {
+			if err := updateFunc(oldObj.(*rbacv1alpha1.RoleBinding), updatedObj.(*rbacv1alpha1.RoleBinding)); err != nil {
+				glog.Infof("Error while handling Update RoleBinding: %s ", err)
+			}
+		})
+}
+
+// CreateClusterRoleBindingController creates a controller specifically for ClusterRoleBindings.
+func CreateClusterRoleBindingController(c *kubernetes.Clientset,
+	addFunc func(addedObj *rbacv1alpha1.ClusterRoleBinding) error, deleteFunc func(deletedObj *rbacv1alpha1.ClusterRoleBinding) error, updateFunc func(oldObj, updatedObj *rbacv1alpha1.ClusterRoleBinding) error) (cache.Store, *cache.Controller) {
+	return CreateResourceController(c.Rbac().RESTClient(), "clusterrolebindings", "", &rbacv1alpha1.ClusterRoleBinding{}, fields.Everything(),
+		func(addedObj interface{}) {
+			if err := addFunc(addedObj.(*rbacv1alpha1.ClusterRoleBinding)); err != nil {
+				glog.Infof("Error while handling Add ClusterRoleBinding: %s ", err)
+			}
+		},
+		func(deletedObj interface{}) {
+			if err := deleteFunc(deletedObj.(*rbacv1alpha1.ClusterRoleBinding)); err != nil {
+				glog.Infof("Error while handling Delete ClusterRoleBinding: %s ", err)
+			}
+		},
+		func(oldObj, updatedObj interface{}) {
+			if err := updateFunc(oldObj.(*rbacv1alpha1.ClusterRoleBinding), updatedObj.(*rbacv1alpha1.ClusterRoleBinding)); err != nil {
+				glog.Infof("Error while handling Update ClusterRoleBinding: %s ", err)
+			}
+		})
+}
+
+// CreateResourceQuotaController creates a controller specifically for ResourceQuotas.
+func CreateResourceQuotaController(c *kubernetes.Clientset, namespace string,
+	addFunc func(addedObj *apiv1.ResourceQuota) error, deleteFunc func(deletedObj *apiv1.ResourceQuota) error, updateFunc func(oldObj, updatedObj *apiv1.ResourceQuota) error) (cache.Store, *cache.Controller) {
+	return CreateResourceController(c.Core().RESTClient(), "resourcequotas", namespace, &apiv1.ResourceQuota{}, fields.Everything(),
+		func(addedObj interface{}) {
+			if err := addFunc(addedObj.(*apiv1.ResourceQuota)); err != nil {
+				glog.Infof("Error while handling Add ResourceQuota: %s ", err)
+			}
+		},
+		func(deletedObj interface{}) {
+			if err := deleteFunc(deletedObj.(*apiv1.ResourceQuota)); err != nil {
+				glog.Infof("Error while handling Delete ResourceQuota: %s ", err)
+			}
+		},
+		func(oldObj, updatedObj interface{}) {
+			if err := updateFunc(oldObj.(*apiv1.ResourceQuota), updatedObj.(*apiv1.ResourceQuota)); err != nil {
+				glog.Infof("Error while handling Update ResourceQuota: %s ", err)
+			}
+		})
+}
+
+// CreateLimitRangeController creates a controller specifically for LimitRanges.
+func CreateLimitRangeController(c *kubernetes.Clientset, namespace string,
+	addFunc func(addedObj *apiv1.LimitRange) error, deleteFunc func(deletedObj *apiv1.LimitRange) error, updateFunc func(oldObj, updatedObj *apiv1.LimitRange) error) (cache.Store, *cache.Controller) {
+	return CreateResourceController(c.Core().RESTClient(), "limitranges", namespace, &apiv1.LimitRange{}, fields.Everything(),
+		func(addedObj interface{}) {
+			if err := addFunc(addedObj.(*apiv1.LimitRange)); err != nil {
+				glog.Infof("Error while handling Add LimitRange: %s ", err)
+			}
+		},
+		func(deletedObj interface{}) {
+			if err := deleteFunc(deletedObj.(*apiv1.LimitRange)); err != nil {
+				glog.Infof("Error while handling Delete LimitRange: %s ", err)
+			}
+		},
+		func(oldObj, updatedObj interface{}) {
+			if err := updateFunc(oldObj.(*apiv1.LimitRange), updatedObj.(*apiv1.LimitRange)); err != nil {
+				glog.Infof("Error while handling Update LimitRange: %s ", err)
+			}
+		})
+}
+
+// CreateHorizontalPodAutoscalerController creates a controller specifically for HorizontalPodAutoscalers.
+func CreateHorizontalPodAutoscalerController(c *kubernetes.Clientset, namespace string,
+	addFunc func(addedObj *autoscalingv1.HorizontalPodAutoscaler) error, deleteFunc func(deletedObj *autoscalingv1.HorizontalPodAutoscaler) error, updateFunc func(oldObj, updatedObj *autoscalingv1.HorizontalPodAutoscaler) error) (cache.Store, *cache.Controller) {
+	return CreateResourceController(c.Autoscaling().RESTClient(), "horizontalpodautoscalers", namespace, &autoscalingv1.HorizontalPodAutoscaler{}, fields.Everything(),
+		func(addedObj interface{}) {
+			if err := addFunc(addedObj.(*autoscalingv1.HorizontalPodAutoscaler)); err != nil {
+				glog.Infof("Error while handling Add HorizontalPodAutoscaler: %s ", err)
+			}
+		},
+		func(deletedObj interface{}) {
+			if err := deleteFunc(deletedObj.(*autoscalingv1.HorizontalPodAutoscaler)); err != nil {
+				glog.Infof("Error while handling Delete HorizontalPodAutoscaler: %s ", err)
+			}
+		},
+		func(oldObj, updatedObj interface{}) {
+			if err := updateFunc(oldObj.(*autoscalingv1.HorizontalPodAutoscaler), updatedObj.(*autoscalingv1.HorizontalPodAutoscaler)); err != nil {
+				glog.Infof("Error while handling Update HorizontalPodAutoscaler: %s ", err)
+			}
+		})
+}
+
+// CreatePodDisruptionBudgetController creates a controller specifically for PodDisruptionBudgets.
+func CreatePodDisruptionBudgetController(c *kubernetes.Clientset, namespace string,
+	addFunc func(addedObj *policyv1beta1.PodDisruptionBudget) error, deleteFunc func(deletedObj *policyv1beta1.PodDisruptionBudget) error, updateFunc func(oldObj, updatedObj *policyv1beta1.PodDisruptionBudget) error) (cache.Store, *cache.Controller) {
+	return CreateResourceController(c.Policy().RESTClient(), "poddisruptionbudgets", namespace, &policyv1beta1.PodDisruptionBudget{}, fields.Everything(),
+		func(addedObj interface{}) {
+			if err := addFunc(addedObj.(*policyv1beta1.PodDisruptionBudget)); err != nil {
+				glog.Infof("Error while handling Add PodDisruptionBudget: %s ", err)
+			}
+		},
+		func(deletedObj interface{}) {
+			if err := deleteFunc(deletedObj.(*policyv1beta1.PodDisruptionBudget)); err != nil {
+				glog.Infof("Error while handling Delete PodDisruptionBudget: %s ", err)
+			}
+		},
+		func(oldObj, updatedObj interface{}) {
+			if err := updateFunc(oldObj.(*policyv1beta1.PodDisruptionBudget), updatedObj.(*policyv1beta1.PodDisruptionBudget)); err != nil {
+				glog.Infof("Error while handling Update PodDisruptionBudget: %s ", err)
+			}
+		})
+}
+
+// CreateThirdPartyResourceController creates a controller specifically for ThirdPartyResources.
+func CreateThirdPartyResourceController(c *kubernetes.Clientset,
+	addFunc func(addedObj *apiv1beta1.ThirdPartyResource) error, deleteFunc func(deletedObj *apiv1beta1.ThirdPartyResource) error, updateFunc func(oldObj, updatedObj *apiv1beta1.ThirdPartyResource) error) (cache.Store, *cache.Controller) {
+	return CreateResourceController(c.Extensions().RESTClient(), "thirdpartyresources", "", &apiv1beta1.ThirdPartyResource{}, fields.Everything(),
+		func(addedObj interface{}) {
+			if err := addFunc(addedObj.(*apiv1beta1.ThirdPartyResource)); err != nil {
+				glog.Infof("Error while handling Add ThirdPartyResource: %s ", err)
+			}
+		},
+		func(deletedObj interface{}) {
+			if err := deleteFunc(deletedObj.(*apiv1beta1.ThirdPartyResource)); err != nil {
+				glog.Infof("Error while handling Delete ThirdPartyResource: %s ", err)
+			}
+		},
+		func(oldObj, updatedObj interface{}) {
+			if err := updateFunc(oldObj.(*apiv1beta1.ThirdPartyResource), updatedObj.(*apiv1beta1.ThirdPartyResource)); err != nil {
+				glog.Infof("Error while handling Update ThirdPartyResource: %s ", err)
+			}
+		})
+}
+
+// CreateServiceAccountController creates a controller specifically for serviceaccounts.
+func CreateServiceAccountController(c *kubernetes.Clientset, namespace string,
+	addFunc func(addedObj *apiv1.ServiceAccount) error, deleteFunc func(deletedObj *apiv1.ServiceAccount) error, updateFunc func(oldObj, updatedObj *apiv1.ServiceAccount) error) (cache.Store, *cache.Controller) {
+	return CreateResourceController(c.Core().RESTClient(), "serviceaccounts", namespace, &apiv1.ServiceAccount{}, fields.Everything(),
+		func(addedObj interface{}) {
+			if err := addFunc(addedObj.(*apiv1.ServiceAccount)); err != nil {
+				glog.Infof("Error while handling Add serviceaccount: %s ", err)
+			}
+		},
+		func(deletedObj interface{}) {
+			if err := deleteFunc(deletedObj.(*apiv1.ServiceAccount)); err != nil {
+				glog.Infof("Error while handling Delete serviceaccount: %s ", err)
+			}
+		},
+		func(oldObj, updatedObj interface{}) {
+			if err := updateFunc(oldObj.(*apiv1.ServiceAccount), updatedObj.(*apiv1.ServiceAccount)); err != nil {
+				glog.Infof("Error while handling Update serviceaccount: %s ", err)
+			}
+		})
+}
+
+// CreateCertificateSigningRequestController creates a controller specifically for certificatesigningrequests.
+func CreateCertificateSigningRequestController(c *kubernetes.Clientset,
+	addFunc func(addedObj *certificatesv1alpha1.CertificateSigningRequest) error, deleteFunc func(deletedObj *certificatesv1alpha1.CertificateSigningRequest) error, updateFunc func(oldObj, updatedObj *certificatesv1alpha1.CertificateSigningRequest) error) (cache.Store, *cache.Controller) {
+	return CreateResourceController(c.Certificates().RESTClient(), "certificatesigningrequests", "", &certificatesv1alpha1.CertificateSigningRequest{}, fields.Everything(),
+		func(addedObj interface{}) {
+			if err := addFunc(addedObj.(*certificatesv1alpha1.CertificateSigningRequest)); err != nil {
+				glog.Infof("Error while handling Add certificatesigningrequest: %s ", err)
+			}
+		},
+		func(deletedObj interface{}) {
+			if err := deleteFunc(deletedObj.(*certificatesv1alpha1.CertificateSigningRequest)); err != nil {
+				glog.Infof("Error while handling Delete certificatesigningrequest: %s ", err)
+			}
+		},
+		func(oldObj, updatedObj interface{}) {
+			if err := updateFunc(oldObj.(*certificatesv1alpha1.CertificateSigningRequest), updatedObj.(*certificatesv1alpha1.CertificateSigningRequest)); err != nil {
+				glog.Infof("Error while handling Update certificatesigningrequest: %s ", err)
+			}
+		})
+}
+
+// CreateEventController creates a controller specifically for events -- only the ones about Pods.
+func CreateEventController(c *kubernetes.Clientset, namespace string,
+	addFunc func(addedObj *apiv1.Event) error, deleteFunc func(deletedObj *apiv1.Event) error, updateFunc func(oldObj, updatedObj *apiv1.Event) error) (cache.Store, *cache.Controller) {
+	filter := fields.Set(map[string]string{
+		"involvedObject.kind": "Pod",
+	}).AsSelector()
+
+	return CreateResourceController(c.Core().RESTClient(), "events", namespace, &apiv1.Event{}, filter,
+		func(addedObj interface{}) {
+			if err := addFunc(addedObj.(*apiv1.Event)); err != nil {
+				glog.Infof("Error while handling Add event: %s ", err)
+			}
+		},
+		func(deletedObj interface{}) {
+			if err := deleteFunc(deletedObj.(*apiv1.Event)); err != nil {
+				glog.Infof("Error while handling Delete event: %s ", err)
+			}
+		},
+		func(oldObj, updatedObj interface{}) {
+			if err := updateFunc(oldObj.(*apiv1.Event), updatedObj.(*apiv1.Event)); err != nil {
+				glog.Infof("Error while handling Update event: %s ", err)
+			}
+		})
+}
+
+// CreatePodSecurityPolicyController creates a controller specifically for podsecuritypolicies.
+func CreatePodSecurityPolicyController(c *kubernetes.Clientset,
+	addFunc func(addedObj *apiv1beta1.PodSecurityPolicy) error, deleteFunc func(deletedObj *apiv1beta1.PodSecurityPolicy) error, updateFunc func(oldObj, updatedObj *apiv1beta1.PodSecurityPolicy) error) (cache.Store, *cache.Controller) {
+	return CreateResourceController(c.Extensions().RESTClient(), "podsecuritypolicies", "", &apiv1beta1.PodSecurityPolicy{}, fields.Everything(),
+		func(addedObj interface{}) {
+			if err := addFunc(addedObj.(*apiv1beta1.PodSecurityPolicy)); err != nil {
+				glog.Infof("Error while handling Add podsecuritypolicy: %s ", err)
+			}
+		},
+		func(deletedObj interface{}) {
+			if err := deleteFunc(deletedObj.(*apiv1beta1.PodSecurityPolicy)); err != nil {
+				glog.Infof("Error while handling Delete podsecuritypolicy: %s ", err)
+			}
+		},
+		func(oldObj, updatedObj interface{}) {
+			if err := updateFunc(oldObj.(*apiv1beta1.PodSecurityPolicy), updatedObj.(*apiv1beta1.PodSecurityPolicy)); err != nil {
+				glog.Infof("Error while handling Update podsecuritypolicy: %s ", err)
+			}
+		})
+}
+
+// CreateDeploymentController creates a controller specifically for deployments.
+func CreateDeploymentController(c *kubernetes.Clientset, namespace string,
+	addFunc func(addedObj *apiv1beta1.Deployment) error, deleteFunc func(deletedObj *apiv1beta1.Deployment) error, updateFunc func(oldObj, updatedObj *apiv1beta1.Deployment) error) (cache.Store, *cache.Controller) {
+	return CreateResourceController(c.Extensions().RESTClient(), "deployments", namespace, &apiv1beta1.Deployment{}, fields.Everything(),
+		func(addedObj interface{}) {
+			if err := addFunc(addedObj.(*apiv1beta1.Deployment)); err != nil {
+				glog.Infof("Error while handling Add deployment: %s ", err)
+			}
+		},
+		func(deletedObj interface{}) {
+			if err := deleteFunc(deletedObj.(*apiv1beta1.Deployment)); err != nil {
+				glog.Infof("Error while handling Delete deployment: %s ", err)
+			}
+		},
+		func(oldObj, updatedObj interface{}) {
+			if err := updateFunc(oldObj.(*apiv1beta1.Deployment), updatedObj.(*apiv1beta1.Deployment)); err != nil {
+				glog.Infof("Error while handling Update deployment: %s ", err)
+			}
+		})
+}
+
+// CreateDaemonSetController creates a controller specifically for daemonsets.
+func CreateDaemonSetController(c *kubernetes.Clientset, namespace string,
+	addFunc func(addedObj *apiv1beta1.DaemonSet) error, deleteFunc func(deletedObj *apiv1beta1.DaemonSet) error, updateFunc func(oldObj, updatedObj *apiv1beta1.DaemonSet) error) (cache.Store, *cache.Controller) {
+	return CreateResourceController(c.Extensions().RESTClient(), "daemonsets", namespace, &apiv1beta1.DaemonSet{}, fields.Everything(),
+		func(addedObj interface{}) {
+			if err := addFunc(addedObj.(*apiv1beta1.DaemonSet)); err != nil {
+				glog.Infof("Error while handling Add daemonset: %s ", err)
+			}
+		},
+		func(deletedObj interface{}) {
+			if err := deleteFunc(deletedObj.(*apiv1beta1.DaemonSet)); err != nil {
+				glog.Infof("Error while handling Delete daemonset: %s ", err)
+			}
+		},
+		func(oldObj, updatedObj interface{}) {
+			if err := updateFunc(oldObj.(*apiv1beta1.DaemonSet), updatedObj.(*apiv1beta1.DaemonSet)); err != nil {
+				glog.Infof("Error while handling Update daemonset: %s ", err)
+			}
+		})
+}
+
+// CreateStatefulSetController creates a controller specifically for statefulsets.
+func CreateStatefulSetController(c *kubernetes.Clientset, namespace string,
+	addFunc func(addedObj *appsv1beta1.StatefulSet) error, deleteFunc func(deletedObj *appsv1beta1.StatefulSet) error, updateFunc func(oldObj, updatedObj *appsv1beta1.StatefulSet) error) (cache.Store, *cache.Controller) {
+	return CreateResourceController(c.Apps().RESTClient(), "statefulsets", namespace, &appsv1beta1.StatefulSet{}, fields.Everything(),
+		func(addedObj interface{}) {
+			if err := addFunc(addedObj.(*appsv1beta1.StatefulSet)); err != nil {
+				glog.Infof("Error while handling Add statefulset: %s ", err)
+			}
+		},
+		func(deletedObj interface{}) {
+			if err := deleteFunc(deletedObj.(*appsv1beta1.StatefulSet)); err != nil {
+				glog.Infof("Error while handling Delete statefulset: %s ", err)
+			}
+		},
+		func(oldObj, updatedObj interface{}) {
+			if err := updateFunc(oldObj.(*appsv1beta1.StatefulSet), updatedObj.(*appsv1beta1.StatefulSet)); err != nil {
+				glog.Infof("Error while handling Update statefulset: %s ", err)
+			}
+		})
+}
@@ -0,0 +1,72 @@
+package handler
+
+import (
+	"fmt"
+
+	"github.com/golang/glog"
+	//
+
+	autoscalingv1 "github.com/FlorianOtel/client-go/pkg/apis/autoscaling/v1"
+)
+
+// hpaCPU formats the current vs. target CPU utilisation of an HPA, e.g. "cpu 93% / target 80%"
+func hpaCPU(hpa *autoscalingv1.HorizontalPodAutoscaler) string {
+	current, target := "<unknown>", "<default>"
+	if hpa.Status.CurrentCPUUtilizationPercentage != nil {
+		current = fmt.Sprintf("%d%%", *hpa.Status.CurrentCPUUtilizationPercentage)
+	}
+	if hpa.Spec.TargetCPUUtilizationPercentage != nil {
+		target = fmt.Sprintf("%d%%", *hpa.Spec.TargetCPUUtilizationPercentage)
+	}
+	return fmt.Sprintf("cpu %s / target %s", current, target)
+}
+
+// printHorizontalPodAutoscaler prints a one-line summary of an HPA: target, replicas (current, desired, min / max) and CPU utilisation
+func printHorizontalPodAutoscaler(hpa *autoscalingv1.HorizontalPodAutoscaler) {
+	min := int32(1)
+	if hpa.Spec.MinReplicas != nil {
+		min = *hpa.Spec.MinReplicas
+	}
+	fmt.Printf("  horizontalpodautoscaler %s/%s: target %s %s, replicas %d (desired %d, min %d, max %d), %s\n",
+		hpa.Namespace, hpa.Name, hpa.Spec.ScaleTargetRef.Kind, hpa.Spec.ScaleTargetRef.Name,
+		hpa.Status.CurrentReplicas, hpa.Status.DesiredReplicas, min, hpa.Spec.MaxReplicas, hpaCPU(hpa))
+}
+
+func HorizontalPodAutoscalerCreated(hpa *autoscalingv1.HorizontalPodAutoscaler) error {
+	glog.Info("=====> A horizontalpodautoscaler got created")
+	JsonPrettyPrint("horizontalpodautoscaler", hpa)
+	printHorizontalPodAutoscaler(hpa)
+	return nil
+}
+
+func HorizontalPodAutoscalerDeleted(hpa *autoscalingv1.HorizontalPodAutoscaler) error {
+	glog.Info("=====> A horizontalpodautoscaler got deleted")
+	printHorizontalPodAutoscaler(hpa)
+	return nil
+}
+
+// Report scaling events: changes of the current / desired number of replicas
+func HorizontalPodAutoscalerUpdated(old, updated *autoscalingv1.HorizontalPodAutoscaler) error {
+	if old.Status.CurrentReplicas == updated.Status.CurrentReplicas && old.Status.DesiredReplicas == updated.Status.DesiredReplicas {
+		glog.V(2).Infof("horizontalpodautoscaler %s/%s: %s", updated.Namespace, updated.Name, hpaCPU(updated))
+		return nil
+	}
+
+	glog.Infof("=====> A horizontalpodautoscaler got updated: %s/%s", updated.Namespace, updated.Name)
+
+	if old.Status.DesiredReplicas != updated.Status.DesiredReplicas {
+		direction := "up"
+		if updated.Status.DesiredReplicas < old.Status.DesiredReplicas {
+			direction = "down"
+		}
+		fmt.Printf("  horizontalpodautoscaler %s/%s: scaling %s %s %s: desired replicas %d -> %d (%s)\n",
+			updated.Namespace, updated.Name, direction, updated.Spec.ScaleTargetRef.Kind, updated.Spec.ScaleTargetRef.Name,
+			old.Status.DesiredReplicas, updated.Status.DesiredReplicas, hpaCPU(updated))
+	}
+	printHorizontalPodAutoscaler(updated)
+
+	if updated.Status.DesiredReplicas == updated.Spec.MaxReplicas && old.Status.DesiredReplicas != updated.Spec.MaxReplicas {
+		glog.Warningf("horizontalpodautoscaler %s/%s reached its maximum of %d replicas (%s)", updated.Namespace, updated.Name, updated.Spec.MaxReplicas, hpaCPU(updated))
+	}
+	return nil
+}
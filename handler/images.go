@@ -0,0 +1,404 @@
+package handler
+
+import (
+	"fmt"
+	"io"
+	"net/http"
+	"sort"
+	"strings"
+
+	apiv1 "github.com/FlorianOtel/client-go/pkg/api/v1"
+	appsv1beta1 "github.com/FlorianOtel/client-go/pkg/apis/apps/v1beta1"
+	apiv1beta1 "github.com/FlorianOtel/client-go/pkg/apis/extensions/v1beta1"
+	metav1 "github.com/FlorianOtel/client-go/pkg/apis/meta/v1"
+	"github.com/FlorianOtel/client-go/pkg/labels"
+)
+
+// Container image inventory: every image referenced by the cached Pods and workloads (Deployments, DaemonSets, StatefulSets),
+// normalized the way Docker does -- "nginx" is "docker.io/library/nginx:latest" -- with the digests it resolved to on the nodes
+// (the imageID of the container statuses), and the namespaces / Pods / nodes / workloads using it.
+//
+// Drift checks:
+// - "tag-digest-drift": the same tag resolved to different digests on different nodes
+// - "workload-drift":   a Pod selected by a workload runs an image other than the one in the workload's Pod template.
+//                       N.B. Rollouts in progress show up as drift too, until they complete
+
+// ImageReference is a parsed image reference
+type ImageReference struct {
+	Registry   string `json:"registry"`
+	Repository string `json:"repository"`
+	Tag        string `json:"tag,omitempty"`
+	Digest     string `json:"digest,omitempty"`
+}
+
+// ImageUsage is an entry of the image inventory
+type ImageUsage struct {
+	Image string `json:"image"` // Normalized reference
+	ImageReference
+	ResolvedDigests []string `json:"resolvedDigests"`
+	Namespaces      []string `json:"namespaces"`
+	Pods            []string `json:"pods"`
+	Nodes           []string `json:"nodes"`
+	Workloads       []string `json:"workloads"` // E.g. "Deployment default/web"
+}
+
+// ImageDrift is an image drift finding
+type ImageDrift struct {
+	Check     string `json:"check"`
+	Image     string `json:"image"`
+	Namespace string `json:"namespace,omitempty"`
+	Workload  string `json:"workload,omitempty"`
+	Pod       string `json:"pod,omitempty"`
+	Container string `json:"container,omitempty"`
+	Detail    string `json:"detail"`
+}
+
+// ParseImage parses an image reference, filling in the Docker defaults: registry "docker.io", repository "library/<name>"
+// for official images and tag "latest" -- unless pinned by digest
+func ParseImage(image string) ImageReference {
+	var ref ImageReference
+	name := image
+	if i := strings.Index(name, "@"); i >= 0 {
+		name, ref.Digest = name[:i], name[i+1:]
+	}
+	if i := strings.LastIndex(name, ":"); i > strings.LastIndex(name, "/") {
+		name, ref.Tag = name[:i], name[i+1:]
+	}
+	if ref.Tag == "" && ref.Digest == "" {
+		ref.Tag = "latest"
+	}
+
+	parts := strings.SplitN(name, "/", 2)
+	if len(parts) == 2 && (strings.ContainsAny(parts[0], ".:") || parts[0] == "localhost") {
+		ref.Registry, ref.Repository = parts[0], parts[1]
+	} else {
+		ref.Registry, ref.Repository = "docker.io", name
+	}
+	if ref.Registry == "docker.io" && !strings.Contains(ref.Repository, "/") {
+		ref.Repository = "library/" + ref.Repository
+	}
+	return ref
+}
+
+// String returns the normalized form of an image reference
+func (r ImageReference) String() string {
+	s := r.Registry + "/" + r.Repository
+	if r.Tag != "" {
+		s += ":" + r.Tag
+	}
+	if r.Digest != "" {
+		s += "@" + r.Digest
+	}
+	return s
+}
+
+// imageDigest returns the digest of an imageID, e.g. "docker-pullable://nginx@sha256:..." -> "sha256:..."
+func imageDigest(imageID string) string {
+	if i := strings.Index(imageID, "://"); i >= 0 {
+		imageID = imageID[i+3:]
+	}
+	if i := strings.Index(imageID, "@"); i >= 0 {
+		imageID = imageID[i+1:]
+	}
+	return imageID
+}
+
+// workloadTemplate is the Pod template of a workload
+type workloadTemplate struct {
+	Kind      string
+	Namespace string
+	Name      string
+	Selector  *metav1.LabelSelector
+	Template  apiv1.PodTemplateSpec
+}
+
+// String returns the workload as e.g. "Deployment default/web"
+func (w workloadTemplate) String() string {
+	return w.Kind + " " + objectName(w.Namespace, w.Name)
+}
+
+// cachedWorkloads returns the cached Deployments, DaemonSets and StatefulSets
+func cachedWorkloads() []workloadTemplate {
+	var workloads []workloadTemplate
+	if DeploymentStore != nil {
+		for _, obj := range DeploymentStore.List() {
+			d := obj.(*apiv1beta1.Deployment)
+			workloads = append(workloads, workloadTemplate{"Deployment", d.Namespace, d.Name, d.Spec.Selector, d.Spec.Template})
+		}
+	}
+	if DaemonSetStore != nil {
+		for _, obj := range DaemonSetStore.List() {
+			ds := obj.(*apiv1beta1.DaemonSet)
+			workloads = append(workloads, workloadTemplate{"DaemonSet", ds.Namespace, ds.Name, ds.Spec.Selector, ds.Spec.Template})
+		}
+	}
+	if StatefulSetStore != nil {
+		for _, obj := range StatefulSetStore.List() {
+			ss := obj.(*appsv1beta1.StatefulSet)
+			workloads = append(workloads, workloadTemplate{"StatefulSet", ss.Namespace, ss.Name, ss.Spec.Selector, ss.Spec.Template})
+		}
+	}
+	sort.Slice(workloads, func(i, j int) bool { return workloads[i].String() < workloads[j].String() })
+	return workloads
+}
+
+// workloadSelects tells whether a workload selects a Pod. Without a selector, the template labels are used -- as the API server defaults it
+func workloadSelects(w workloadTemplate, pod *apiv1.Pod) bool {
+	if pod.Namespace != w.Namespace {
+		return false
+	}
+	selector := labels.SelectorFromSet(labels.Set(w.Template.Labels))
+	if w.Selector != nil {
+		s, err := metav1.LabelSelectorAsSelector(w.Selector)
+		if err != nil {
+			return false
+		}
+		selector = s
+	}
+	return !selector.Empty() && selector.Matches(labels.Set(pod.Labels))
+}
+
+// templateImageChanges describes the container image changes between two Pod templates
+func templateImageChanges(old, updated apiv1.PodTemplateSpec) []string {
+	before := make(map[string]string)
+	for _, c := range append(append([]apiv1.Container{}, old.Spec.InitContainers...), old.Spec.Containers...) {
+		before[c.Name] = c.Image
+	}
+	var changes []string
+	for _, c := range append(append([]apiv1.Container{}, updated.Spec.InitContainers...), updated.Spec.Containers...) {
+		if image, ok := before[c.Name]; !ok {
+			changes = append(changes, fmt.Sprintf("container %s added: image %s", c.Name, c.Image))
+		} else if image != c.Image {
+			changes = append(changes, fmt.Sprintf("container %s: image %s -> %s", c.Name, image, c.Image))
+		}
+		delete(before, c.Name)
+	}
+	for name, image := range before {
+		changes = append(changes, fmt.Sprintf("container %s removed: image %s", name, image))
+	}
+	sort.Strings(changes)
+	return changes
+}
+
+// runningImage returns the image a container of a Pod actually runs -- from its status if known, from the spec otherwise -- and its digest
+func runningImage(pod *apiv1.Pod, c apiv1.Container) (string, string) {
+	for _, cs := range append(append([]apiv1.ContainerStatus{}, pod.Status.InitContainerStatuses...), pod.Status.ContainerStatuses...) {
+		if cs.Name != c.Name || cs.Image == "" {
+			continue
+		}
+		// Some runtimes report the image ID rather than the reference
+		if strings.HasPrefix(cs.Image, "sha256:") {
+			return c.Image, imageDigest(cs.ImageID)
+		}
+		return cs.Image, imageDigest(cs.ImageID)
+	}
+	return c.Image, ""
+}
+
+// appendUnique appends a string to a list, unless it's empty or already in it
+func appendUnique(list []string, s string) []string {
+	if s == "" {
+		return list
+	}
+	for _, e := range list {
+		if e == s {
+			return list
+		}
+	}
+	return append(list, s)
+}
+
+// ImageInventory returns the images used in a namespace -- or in all namespaces if "namespace" is empty -- sorted by image
+func ImageInventory(namespace string) []ImageUsage {
+	byImage := make(map[string]*ImageUsage)
+	usage := func(image string) *ImageUsage {
+		ref := ParseImage(image)
+		u, ok := byImage[ref.String()]
+		if !ok {
+			u = &ImageUsage{Image: ref.String(), ImageReference: ref, ResolvedDigests: []string{}, Namespaces: []string{}, Pods: []string{},
+				Nodes: []string{}, Workloads: []string{}}
+			byImage[ref.String()] = u
+		}
+		return u
+	}
+
+	for _, pod := range cachedPods() {
+		if (namespace != "" && pod.Namespace != namespace) || podTerminated(pod) {
+			continue
+		}
+		for _, c := range podContainers(pod) {
+			_, digest := runningImage(pod, c)
+			u := usage(c.Image)
+			u.ResolvedDigests = appendUnique(u.ResolvedDigests, digest)
+			u.Namespaces = appendUnique(u.Namespaces, pod.Namespace)
+			u.Pods = appendUnique(u.Pods, objectName(pod.Namespace, pod.Name))
+			u.Nodes = appendUnique(u.Nodes, pod.Spec.NodeName)
+		}
+	}
+	for _, w := range cachedWorkloads() {
+		if namespace != "" && w.Namespace != namespace {
+			continue
+		}
+		for _, c := range append(append([]apiv1.Container{}, w.Template.Spec.InitContainers...), w.Template.Spec.Containers...) {
+			u := usage(c.Image)
+			u.Namespaces = appendUnique(u.Namespaces, w.Namespace)
+			u.Workloads = appendUnique(u.Workloads, w.String())
+		}
+	}
+
+	inventory := []ImageUsage{}
+	for _, u := range byImage {
+		for _, list := range [][]string{u.ResolvedDigests, u.Namespaces, u.Pods, u.Nodes, u.Workloads} {
+			sort.Strings(list)
+		}
+		inventory = append(inventory, *u)
+	}
+	sort.Slice(inventory, func(i, j int) bool { return inventory[i].Image < inventory[j].Image })
+	return inventory
+}
+
+// FindImage answers "where is image X running": the inventory entries matching a query -- an image reference (without a tag,
+// all its tags match) or a digest
+func FindImage(query string) []ImageUsage {
+	matches := []ImageUsage{}
+	q := ParseImage(query)
+	name := query
+	if i := strings.Index(name, "@"); i >= 0 {
+		name = name[:i]
+	}
+	anyTag := !strings.Contains(name[strings.LastIndex(name, "/")+1:], ":")
+
+	for _, u := range ImageInventory("") {
+		match := false
+		if strings.HasPrefix(query, "sha256:") {
+			match = u.Digest == query
+			for _, d := range u.ResolvedDigests {
+				match = match || d == query
+			}
+		} else {
+			match = u.Registry == q.Registry && u.Repository == q.Repository && (anyTag || u.Tag == q.Tag) && (q.Digest == "" || u.Digest == q.Digest)
+		}
+		if match {
+			matches = append(matches, u)
+		}
+	}
+	return matches
+}
+
+// ImageDrifts runs the drift checks over a namespace -- or all namespaces if "namespace" is empty
+func ImageDrifts(namespace string) []ImageDrift {
+	drifts := []ImageDrift{}
+
+	var pods []*apiv1.Pod
+	for _, pod := range cachedPods() {
+		if (namespace == "" || pod.Namespace == namespace) && !podTerminated(pod) {
+			pods = append(pods, pod)
+		}
+	}
+
+	// Tags resolving to different digests on different nodes
+	nodesByDigest := make(map[string]map[string][]string) // Image -> digest -> nodes
+	for _, pod := range pods {
+		for _, c := range podContainers(pod) {
+			ref := ParseImage(c.Image)
+			_, digest := runningImage(pod, c)
+			if ref.Digest != "" || digest == "" || pod.Spec.NodeName == "" {
+				continue // Pinned by digest, or not resolved yet
+			}
+			if nodesByDigest[ref.String()] == nil {
+				nodesByDigest[ref.String()] = make(map[string][]string)
+			}
+			nodesByDigest[ref.String()][digest] = appendUnique(nodesByDigest[ref.String()][digest], pod.Spec.NodeName)
+		}
+	}
+	for image, digests := range nodesByDigest {
+		if len(digests) < 2 {
+			continue
+		}
+		var resolved []string
+		for digest, nodes := range digests {
+			sort.Strings(nodes)
+			resolved = append(resolved, fmt.Sprintf("%s on %s", digest, strings.Join(nodes, ", ")))
+		}
+		sort.Strings(resolved)
+		drifts = append(drifts, ImageDrift{Check: "tag-digest-drift", Image: image,
+			Detail: fmt.Sprintf("resolves to %d digests: %s", len(digests), strings.Join(resolved, "; "))})
+	}
+
+	// Pods running something other than their workload's template
+	for _, w := range cachedWorkloads() {
+		if namespace != "" && w.Namespace != namespace {
+			continue
+		}
+		for _, pod := range pods {
+			if !workloadSelects(w, pod) {
+				continue
+			}
+			for _, tc := range w.Template.Spec.Containers {
+				for _, c := range pod.Spec.Containers {
+					if c.Name != tc.Name {
+						continue
+					}
+					running, _ := runningImage(pod, c)
+					if ParseImage(running).String() != ParseImage(tc.Image).String() {
+						drifts = append(drifts, ImageDrift{Check: "workload-drift", Image: ParseImage(tc.Image).String(), Namespace: w.Namespace,
+							Workload: w.String(), Pod: pod.Name, Container: c.Name, Detail: fmt.Sprintf("runs %s, the workload specifies %s", running, tc.Image)})
+					}
+				}
+			}
+		}
+	}
+
+	sort.SliceStable(drifts, func(i, j int) bool {
+		if drifts[i].Check != drifts[j].Check {
+			return drifts[i].Check < drifts[j].Check
+		}
+		return drifts[i].Image+drifts[i].Workload+drifts[i].Pod < drifts[j].Image+drifts[j].Workload+drifts[j].Pod
+	})
+	return drifts
+}
+
+// PrintImageInventory prints the image inventory
+func PrintImageInventory(w io.Writer, inventory []ImageUsage) {
+	if len(inventory) == 0 {
+		fmt.Fprintf(w, "  <no images>\n")
+	}
+	for _, u := range inventory {
+		fmt.Fprintf(w, "Image %s\n", u.Image)
+		fmt.Fprintf(w, "  digests:    %s\n", strings.Join(u.ResolvedDigests, ", "))
+		fmt.Fprintf(w, "  namespaces: %s\n", strings.Join(u.Namespaces, ", "))
+		fmt.Fprintf(w, "  pods:       %s\n", strings.Join(u.Pods, ", "))
+		fmt.Fprintf(w, "  nodes:      %s\n", strings.Join(u.Nodes, ", "))
+		fmt.Fprintf(w, "  workloads:  %s\n", strings.Join(u.Workloads, ", "))
+	}
+}
+
+// PrintImageDrifts prints the image drift findings, one per line
+func PrintImageDrifts(w io.Writer, drifts []ImageDrift) {
+	if len(drifts) == 0 {
+		fmt.Fprintf(w, "  <no drift>\n")
+	}
+	for _, d := range drifts {
+		switch d.Check {
+		case "workload-drift":
+			fmt.Fprintf(w, "  [%s] %s: pod %s container %s %s\n", d.Check, d.Workload, d.Pod, d.Container, d.Detail)
+		default:
+			fmt.Fprintf(w, "  [%s] image %s %s\n", d.Check, d.Image, d.Detail)
+		}
+	}
+}
+
+// ImagesHandler serves the image inventory over HTTP: /images[?namespace=default] -- or /images?image=nginx to find where an image runs
+func ImagesHandler(w http.ResponseWriter, r *http.Request) {
+	q := r.URL.Query()
+	if q.Get("image") != "" {
+		writeJSON(w, FindImage(q.Get("image")))
+		return
+	}
+	writeJSON(w, ImageInventory(q.Get("namespace")))
+}
+
+// ImageDriftHandler serves the image drift findings over HTTP: /imagedrift[?namespace=default]
+func ImageDriftHandler(w http.ResponseWriter, r *http.Request) {
+	writeJSON(w, ImageDrifts(r.URL.Query().Get("namespace")))
+}
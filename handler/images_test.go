@@ -0,0 +1,55 @@
+package handler
+
+import "testing"
+
+func TestParseImage(t *testing.T) {
+	const digest = "sha256:0123456789abcdef"
+	tests := []struct {
+		image    string
+		expected ImageReference
+	}{
+		{"nginx", ImageReference{"docker.io", "library/nginx", "latest", ""}},
+		{"nginx:1.11", ImageReference{"docker.io", "library/nginx", "1.11", ""}},
+		{"nginx@" + digest, ImageReference{"docker.io", "library/nginx", "", digest}},
+		{"nginx:1.11@" + digest, ImageReference{"docker.io", "library/nginx", "1.11", digest}},
+		{"bitnami/redis:4.0", ImageReference{"docker.io", "bitnami/redis", "4.0", ""}},
+		{"docker.io/nginx", ImageReference{"docker.io", "library/nginx", "latest", ""}},
+		{"gcr.io/google_containers/pause:3.0", ImageReference{"gcr.io", "google_containers/pause", "3.0", ""}},
+		// A registry port is not a tag
+		{"registry.local:5000/team/app", ImageReference{"registry.local:5000", "team/app", "latest", ""}},
+		{"registry.local:5000/team/app:v2", ImageReference{"registry.local:5000", "team/app", "v2", ""}},
+		{"localhost/app", ImageReference{"localhost", "app", "latest", ""}},
+		{"localhost:5000/app@" + digest, ImageReference{"localhost:5000", "app", "", digest}},
+	}
+	for _, test := range tests {
+		if ref := ParseImage(test.image); ref != test.expected {
+			t.Errorf("ParseImage(%q) = %+v, expected %+v", test.image, ref, test.expected)
+		}
+	}
+}
+
+func TestImageReferenceString(t *testing.T) {
+	tests := map[string]string{
+		"nginx":                             "docker.io/library/nginx:latest",
+		"registry.local:5000/app@sha256:01": "registry.local:5000/app@sha256:01",
+		"quay.io/coreos/etcd:v3.1":          "quay.io/coreos/etcd:v3.1",
+	}
+	for image, expected := range tests {
+		if s := ParseImage(image).String(); s != expected {
+			t.Errorf("ParseImage(%q).String() = %q, expected %q", image, s, expected)
+		}
+	}
+}
+
+func TestImageDigest(t *testing.T) {
+	tests := map[string]string{
+		"docker-pullable://nginx@sha256:01": "sha256:01",
+		"docker://sha256:02":                "sha256:02",
+		"sha256:03":                         "sha256:03",
+	}
+	for imageID, expected := range tests {
+		if digest := imageDigest(imageID); digest != expected {
+			t.Errorf("imageDigest(%q) = %q, expected %q", imageID, digest, expected)
+		}
+	}
+}
@@ -0,0 +1,35 @@
+package handler
+
+import (
+	"os"
+
+	"github.com/golang/glog"
+	//
+
+	"github.com/FlorianOtel/client-go/pkg/api"
+	apiv1 "github.com/FlorianOtel/client-go/pkg/api/v1"
+)
+
+func LimitRangeCreated(lr *apiv1.LimitRange) error {
+	glog.Info("=====> A limitrange got created")
+	JsonPrettyPrint("limitrange", lr)
+	PrintLimitViolations(os.Stdout, NamespaceLimitViolations(lr.Namespace))
+	return nil
+}
+
+func LimitRangeDeleted(lr *apiv1.LimitRange) error {
+	glog.Info("=====> A limitrange got deleted")
+	JsonPrettyPrint("limitrange", lr)
+	return nil
+}
+
+// Re-check the Pods of the namespace against the new limits
+func LimitRangeUpdated(old, updated *apiv1.LimitRange) error {
+	if api.Semantic.DeepEqual(old.Spec, updated.Spec) {
+		return nil
+	}
+	glog.Infof("=====> A limitrange got updated: %s/%s", updated.Namespace, updated.Name)
+	JsonPrettyPrint("limitrange", updated)
+	PrintLimitViolations(os.Stdout, NamespaceLimitViolations(updated.Namespace))
+	return nil
+}
@@ -0,0 +1,510 @@
+package handler
+
+import (
+	"encoding/json"
+	"fmt"
+	"io"
+	"net/http"
+	"os"
+	"path/filepath"
+	"reflect"
+	"sort"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/golang/glog"
+	//
+
+	"github.com/FlorianOtel/client-go/pkg/api"
+	"github.com/FlorianOtel/client-go/pkg/api/meta"
+	apiv1 "github.com/FlorianOtel/client-go/pkg/api/v1"
+	"github.com/FlorianOtel/client-go/pkg/runtime/schema"
+	"github.com/FlorianOtel/client-go/pkg/util/yaml"
+	"github.com/FlorianOtel/client-go/tools/cache"
+)
+
+// Desired state drift: the manifests of a directory (e.g. a GitOps repository) are compared against the live objects in the
+// caches. The findings are:
+// - "missing":   a manifest has no live object
+// - "extra":     a live object has no manifest -- for the kinds found in the manifests, in the namespaces found in the manifests
+//                ("managed" namespaces). Objects created by a controller, the "default" ServiceAccount and the ServiceAccount
+//                token Secrets are not reported
+// - "modified":  fields of a manifest differ from the live object
+// - "unwatched": a manifest is for a kind, or a namespace, we don't watch -- so it cannot be checked
+//
+// Only the fields set in a manifest are compared -- fields defaulted by the API server, and the status, are ignored. The
+// manifests are decoded with the API scheme first, so that e.g. "500m" and "0.5" CPUs compare equal.
+//
+// When run continuously (ReportManifestDrift), the manifests are reloaded on each run, and a "raised" event is emitted for each
+// new finding and a "resolved" event for each finding that went away -- as JSON lines to ManifestDriftLog.
+
+// ManifestDriftLog is where the manifest drift events are written. Defaults to stdout
+var ManifestDriftLog io.Writer = os.Stdout
+
+// ManifestsDir is the directory of the manifests, for ManifestDriftHandler. Set by the caller
+var ManifestsDir string
+
+// WatchedResources are the resources we watch, and in which namespace. Set by the caller. Nil: all namespaces are assumed watched
+var WatchedResources []WatchedResource
+
+// Kinds that are not namespaced
+var clusterScopedKinds = map[string]bool{
+	"Namespace":                 true,
+	"Node":                      true,
+	"PersistentVolume":          true,
+	"StorageClass":              true,
+	"CertificateSigningRequest": true,
+	"PodSecurityPolicy":         true,
+	"ClusterRole":               true,
+	"ClusterRoleBinding":        true,
+}
+
+// Fields of the manifests that are never compared -- they are set by the API server
+var ignoredManifestFields = map[string]bool{
+	"apiVersion":                 true, // Not set on the cached objects
+	"kind":                       true,
+	"status":                     true,
+	"metadata.uid":               true,
+	"metadata.resourceVersion":   true,
+	"metadata.selfLink":          true,
+	"metadata.creationTimestamp": true,
+	"metadata.generation":        true,
+	"stringData":                 true, // Secrets: write-only, merged into "data" by the API server
+}
+
+// Manifest is an object of a manifest file
+type Manifest struct {
+	Kind      string
+	Namespace string
+	Name      string
+	Source    string                 // The file it was read from
+	object    map[string]interface{} // As written
+	decoded   map[string]interface{} // Decoded with the API scheme
+}
+
+// DriftFinding is a difference between a manifest and the live state
+type DriftFinding struct {
+	Check     string        `json:"check"`
+	Kind      string        `json:"kind"`
+	Namespace string        `json:"namespace,omitempty"`
+	Name      string        `json:"name"`
+	Source    string        `json:"source,omitempty"` // The manifest file. Empty for "extra" objects
+	Detail    string        `json:"detail,omitempty"`
+	Fields    []FieldChange `json:"fields,omitempty"` // "modified" only. Old is the desired value, New the live one
+}
+
+// DriftEvent is a drift finding being raised or resolved
+type DriftEvent struct {
+	Time   time.Time `json:"time"`
+	Status string    `json:"status"` // "raised" or "resolved"
+	DriftFinding
+}
+
+var (
+	driftMutex    sync.Mutex
+	driftFindings = make(map[string]DriftFinding) // The findings of the previous ReportManifestDrift run, by driftKey
+)
+
+// driftKey identifies a drift finding -- including the values of the differing fields, so that a new value is a new finding
+func driftKey(f DriftFinding) string {
+	b, _ := json.Marshal(f.Fields)
+	return strings.Join([]string{f.Check, snapshotKey(f.Kind, f.Namespace, f.Name), f.Detail, string(b)}, " ")
+}
+
+// decodeManifest decodes an object (as written) with the API scheme
+func decodeManifest(apiVersion, kind string, object map[string]interface{}) (map[string]interface{}, error) {
+	gv, err := schema.ParseGroupVersion(apiVersion)
+	if err != nil {
+		return nil, err
+	}
+	obj, err := api.Scheme.New(gv.WithKind(kind))
+	if err != nil {
+		return nil, err
+	}
+	b, err := json.Marshal(object)
+	if err != nil {
+		return nil, err
+	}
+	if err := json.Unmarshal(b, obj); err != nil {
+		return nil, err
+	}
+	return toJSONMap(obj)
+}
+
+// toJSONMap returns the JSON form of an object, as a decoded JSON map
+func toJSONMap(obj interface{}) (map[string]interface{}, error) {
+	b, err := json.Marshal(obj)
+	if err != nil {
+		return nil, err
+	}
+	var m map[string]interface{}
+	return m, json.Unmarshal(b, &m)
+}
+
+// DecodeManifests decodes the objects in a YAML or JSON stream -- possibly several YAML documents, or Lists.
+// Namespaced objects without a namespace are put in the "default" namespace
+func DecodeManifests(r io.Reader, source string) ([]*Manifest, error) {
+	var manifests []*Manifest
+
+	decoder := yaml.NewYAMLOrJSONDecoder(r, 4096)
+	for {
+		var object map[string]interface{}
+		if err := decoder.Decode(&object); err == io.EOF {
+			break
+		} else if err != nil {
+			return nil, err
+		}
+		if len(object) == 0 {
+			continue // Empty document
+		}
+
+		objects := []map[string]interface{}{object}
+		if items, ok := object["items"].([]interface{}); ok && strings.HasSuffix(fmt.Sprint(object["kind"]), "List") {
+			objects = nil
+			for _, item := range items {
+				if o, ok := item.(map[string]interface{}); ok {
+					objects = append(objects, o)
+				}
+			}
+		}
+
+		for _, o := range objects {
+			apiVersion, _ := o["apiVersion"].(string)
+			kind, _ := o["kind"].(string)
+			metadata, _ := o["metadata"].(map[string]interface{})
+			name, _ := metadata["name"].(string)
+			namespace, _ := metadata["namespace"].(string)
+			if apiVersion == "" || kind == "" || name == "" {
+				return nil, fmt.Errorf("object without an apiVersion, a kind or a name: %s", fieldValue(o))
+			}
+			if clusterScopedKinds[kind] {
+				namespace = ""
+			} else if namespace == "" {
+				namespace = apiv1.NamespaceDefault
+			}
+			decoded, err := decodeManifest(apiVersion, kind, o)
+			if err != nil {
+				return nil, fmt.Errorf("%s %s: %s", kind, objectName(namespace, name), err)
+			}
+			manifests = append(manifests, &Manifest{Kind: kind, Namespace: namespace, Name: name, Source: source, object: o, decoded: decoded})
+		}
+	}
+	return manifests, nil
+}
+
+// LoadManifests decodes the manifests of all the YAML and JSON files (*.yaml, *.yml, *.json) under a directory. Hidden files and
+// directories (e.g. ".git") are skipped
+func LoadManifests(dir string) ([]*Manifest, error) {
+	var manifests []*Manifest
+	seen := make(map[string]string)
+
+	err := filepath.Walk(dir, func(path string, info os.FileInfo, err error) error {
+		if err != nil {
+			return err
+		}
+		if path != dir && strings.HasPrefix(info.Name(), ".") {
+			if info.IsDir() {
+				return filepath.SkipDir
+			}
+			return nil
+		}
+		if info.IsDir() {
+			return nil
+		}
+		switch filepath.Ext(path) {
+		case ".yaml", ".yml", ".json":
+		default:
+			return nil
+		}
+
+		f, err := os.Open(path)
+		if err != nil {
+			return err
+		}
+		defer f.Close()
+		decoded, err := DecodeManifests(f, path)
+		if err != nil {
+			return fmt.Errorf("%s: %s", path, err)
+		}
+		for _, m := range decoded {
+			key := snapshotKey(m.Kind, m.Namespace, m.Name)
+			if other, ok := seen[key]; ok {
+				return fmt.Errorf("%s: duplicate %s (also in %s)", path, key, other)
+			}
+			seen[key] = path
+		}
+		manifests = append(manifests, decoded...)
+		return nil
+	})
+	return manifests, err
+}
+
+// kindResource returns the resource name of a kind, e.g. "networkpolicies" for NetworkPolicy
+func kindResource(kind string) string {
+	r := strings.ToLower(kind)
+	switch {
+	case strings.HasSuffix(r, "y"):
+		return strings.TrimSuffix(r, "y") + "ies"
+	case strings.HasSuffix(r, "s"):
+		return r + "es"
+	default:
+		return r + "s"
+	}
+}
+
+// kindWatched tells whether the objects of a kind are watched in a namespace
+func kindWatched(kind, namespace string) bool {
+	if WatchedResources == nil {
+		return true
+	}
+	resource := kindResource(kind)
+	for _, res := range WatchedResources {
+		if res.Resource == resource && (res.Namespace == "" || res.Namespace == namespace) {
+			return true
+		}
+	}
+	return false
+}
+
+// compareManifest appends the differences between the fields set in a manifest and a live object. "desired" is the manifest
+// as written (it tells which fields are set), "decoded" the manifest decoded with the API scheme (it has the values compared)
+func compareManifest(path string, desired, decoded, live interface{}, changes *[]FieldChange) {
+	if ignoredManifestFields[path] {
+		return
+	}
+	if decoded == nil {
+		return // Zero value, or a field unknown to the API types
+	}
+	if live == nil {
+		*changes = append(*changes, FieldChange{Path: path, Old: decoded})
+		return
+	}
+
+	desiredMap, desiredIsMap := desired.(map[string]interface{})
+	decodedMap, decodedIsMap := decoded.(map[string]interface{})
+	liveMap, liveIsMap := live.(map[string]interface{})
+	if desiredIsMap && decodedIsMap && liveIsMap {
+		var keys []string
+		for k := range desiredMap {
+			keys = append(keys, k)
+		}
+		sort.Strings(keys)
+		for _, k := range keys {
+			p := k
+			if path != "" {
+				p = path + "." + k
+			}
+			compareManifest(p, desiredMap[k], decodedMap[k], liveMap[k], changes)
+		}
+		return
+	}
+
+	desiredList, desiredIsList := desired.([]interface{})
+	decodedList, decodedIsList := decoded.([]interface{})
+	liveList, liveIsList := live.([]interface{})
+	if desiredIsList && decodedIsList && liveIsList && len(desiredList) == len(decodedList) {
+		for i := range desiredList {
+			p := fmt.Sprintf("%s[%d]", path, i)
+			if i >= len(liveList) {
+				*changes = append(*changes, FieldChange{Path: p, Old: decodedList[i]})
+				continue
+			}
+			compareManifest(p, desiredList[i], decodedList[i], liveList[i], changes)
+		}
+		for i := len(desiredList); i < len(liveList); i++ {
+			*changes = append(*changes, FieldChange{Path: fmt.Sprintf("%s[%d]", path, i), New: liveList[i]})
+		}
+		return
+	}
+
+	if !reflect.DeepEqual(decoded, live) {
+		*changes = append(*changes, FieldChange{Path: path, Old: decoded, New: live})
+	}
+}
+
+// hideSecretValues replaces the values of the Secret data in field changes -- they are not to be logged
+func hideSecretValues(changes []FieldChange) {
+	for i := range changes {
+		if changes[i].Path == "data" || strings.HasPrefix(changes[i].Path, "data.") {
+			if changes[i].Old != nil {
+				changes[i].Old = "<hidden>"
+			}
+			if changes[i].New != nil {
+				changes[i].New = "<hidden>"
+			}
+		}
+	}
+}
+
+// createdByController tells whether a live object was created by a controller (rather than from a manifest)
+func createdByController(obj interface{}) bool {
+	accessor, err := meta.Accessor(obj)
+	if err != nil {
+		return false
+	}
+	if len(accessor.GetOwnerReferences()) > 0 {
+		return true
+	}
+	_, ok := accessor.GetAnnotations()[api.CreatedByAnnotation]
+	return ok
+}
+
+// ManifestDrift compares manifests against the live objects in the caches
+func ManifestDrift(manifests []*Manifest) []DriftFinding {
+	var findings []DriftFinding
+	stores := snapshotStores()
+
+	desired := make(map[string]bool)
+	managedKinds := make(map[string]bool)
+	managedNamespaces := make(map[string]bool)
+	for _, m := range manifests {
+		desired[snapshotKey(m.Kind, m.Namespace, m.Name)] = true
+		managedKinds[m.Kind] = true
+		if m.Namespace != "" {
+			managedNamespaces[m.Namespace] = true
+		}
+
+		store, ok := stores[m.Kind]
+		if !ok {
+			findings = append(findings, DriftFinding{"unwatched", m.Kind, m.Namespace, m.Name, m.Source, fmt.Sprintf("%s objects are not watched", m.Kind), nil})
+			continue
+		}
+		if !kindWatched(m.Kind, m.Namespace) {
+			findings = append(findings, DriftFinding{"unwatched", m.Kind, m.Namespace, m.Name, m.Source, fmt.Sprintf("%s objects are not watched in namespace %s", m.Kind, m.Namespace), nil})
+			continue
+		}
+
+		obj, exists, err := store.GetByKey(objectName(m.Namespace, m.Name))
+		if err != nil {
+			glog.Errorf("Error looking up %s %s in the cache. Error: %s", m.Kind, objectName(m.Namespace, m.Name), err)
+			continue
+		}
+		if !exists {
+			findings = append(findings, DriftFinding{"missing", m.Kind, m.Namespace, m.Name, m.Source, "", nil})
+			continue
+		}
+		live, err := toJSONMap(obj)
+		if err != nil {
+			glog.Errorf("Error marshalling %s %s. Error: %s", m.Kind, objectName(m.Namespace, m.Name), err)
+			continue
+		}
+		var changes []FieldChange
+		compareManifest("", m.object, m.decoded, live, &changes)
+		if m.Kind == "Secret" {
+			hideSecretValues(changes)
+		}
+		if len(changes) > 0 {
+			findings = append(findings, DriftFinding{"modified", m.Kind, m.Namespace, m.Name, m.Source, fmt.Sprintf("%d field(s) differ", len(changes)), changes})
+		}
+	}
+
+	// Extra objects: in the managed namespaces, for the managed (namespaced) kinds
+	for kind := range managedKinds {
+		store, ok := stores[kind]
+		if !ok || clusterScopedKinds[kind] {
+			continue
+		}
+		for _, obj := range store.List() {
+			key, err := cache.MetaNamespaceKeyFunc(obj)
+			if err != nil {
+				continue
+			}
+			namespace, name, _ := cache.SplitMetaNamespaceKey(key)
+			if !managedNamespaces[namespace] || desired[snapshotKey(kind, namespace, name)] || createdByController(obj) {
+				continue
+			}
+			if sa, ok := obj.(*apiv1.ServiceAccount); ok && sa.Name == "default" {
+				continue
+			}
+			if secret, ok := obj.(*apiv1.Secret); ok && secret.Type == apiv1.SecretTypeServiceAccountToken {
+				continue
+			}
+			findings = append(findings, DriftFinding{"extra", kind, namespace, name, "", "no manifest", nil})
+		}
+	}
+
+	sort.SliceStable(findings, func(i, j int) bool {
+		a, b := findings[i], findings[j]
+		if ka, kb := snapshotKey(a.Kind, a.Namespace, a.Name), snapshotKey(b.Kind, b.Namespace, b.Name); ka != kb {
+			return ka < kb
+		}
+		return a.Check < b.Check
+	})
+	return findings
+}
+
+// driftEvent writes a drift event to the ManifestDriftLog
+func driftEvent(status string, f DriftFinding) {
+	b, err := json.Marshal(DriftEvent{Time: time.Now().UTC(), Status: status, DriftFinding: f})
+	if err != nil {
+		glog.Errorf("Error marshalling drift event %#v. Error: %s", f, err)
+		return
+	}
+	if _, err := fmt.Fprintf(ManifestDriftLog, "%s\n", b); err != nil {
+		glog.Errorf("Error writing drift event. Error: %s", err)
+	}
+}
+
+// ReportManifestDrift reloads the manifests of a directory, compares them against the live objects, and emits an event for each
+// finding raised or resolved since the previous run. If the manifests cannot be loaded, the previous findings are kept.
+// Meant to be run periodically (e.g. via wait.Until)
+func ReportManifestDrift(dir string) {
+	manifests, err := LoadManifests(dir)
+	if err != nil {
+		glog.Errorf("Error loading the manifests from %s. Error: %s", dir, err)
+		return
+	}
+
+	driftMutex.Lock()
+	defer driftMutex.Unlock()
+
+	current := make(map[string]DriftFinding)
+	for _, f := range ManifestDrift(manifests) {
+		key := driftKey(f)
+		current[key] = f
+		if _, ok := driftFindings[key]; !ok {
+			driftEvent("raised", f)
+		}
+	}
+	for key, f := range driftFindings {
+		if _, ok := current[key]; !ok {
+			driftEvent("resolved", f)
+		}
+	}
+	driftFindings = current
+}
+
+// PrintManifestDrift prints the drift findings
+func PrintManifestDrift(w io.Writer, findings []DriftFinding) {
+	if len(findings) == 0 {
+		fmt.Fprintf(w, "  <no drift>\n")
+	}
+	for _, f := range findings {
+		fmt.Fprintf(w, "  [%s] %s %s", f.Check, f.Kind, objectName(f.Namespace, f.Name))
+		if f.Source != "" {
+			fmt.Fprintf(w, " (%s)", f.Source)
+		}
+		if f.Detail != "" {
+			fmt.Fprintf(w, ": %s", f.Detail)
+		}
+		fmt.Fprintf(w, "\n")
+		for _, c := range f.Fields {
+			fmt.Fprintf(w, "      %s: %s -> %s\n", c.Path, fieldValue(c.Old), fieldValue(c.New))
+		}
+	}
+}
+
+// ManifestDriftHandler compares the manifests against the live objects on demand over HTTP: /manifestdrift
+func ManifestDriftHandler(w http.ResponseWriter, r *http.Request) {
+	if ManifestsDir == "" {
+		http.Error(w, "no manifests directory configured", http.StatusNotFound)
+		return
+	}
+	manifests, err := LoadManifests(ManifestsDir)
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusInternalServerError)
+		return
+	}
+	writeJSON(w, ManifestDrift(manifests))
+}
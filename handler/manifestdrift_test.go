@@ -0,0 +1,147 @@
+package handler
+
+import (
+	"reflect"
+	"strings"
+	"testing"
+
+	"github.com/FlorianOtel/client-go/pkg/api/resource"
+	apiv1 "github.com/FlorianOtel/client-go/pkg/api/v1"
+)
+
+func TestDecodeManifests(t *testing.T) {
+	input := `
+apiVersion: v1
+kind: ConfigMap
+metadata:
+  name: settings
+data:
+  mode: fast
+---
+---
+apiVersion: v1
+kind: List
+items:
+- apiVersion: v1
+  kind: Namespace
+  metadata:
+    name: team
+    namespace: ignored
+- apiVersion: v1
+  kind: Service
+  metadata:
+    name: web
+    namespace: team
+`
+	manifests, err := DecodeManifests(strings.NewReader(input), "test.yaml")
+	if err != nil {
+		t.Fatal(err)
+	}
+	var got []string
+	for _, m := range manifests {
+		got = append(got, m.Kind+" "+snapshotKey(m.Kind, m.Namespace, m.Name)+" "+m.Source)
+	}
+	expected := []string{
+		"ConfigMap " + snapshotKey("ConfigMap", "default", "settings") + " test.yaml", // Namespaced: defaults to "default"
+		"Namespace " + snapshotKey("Namespace", "", "team") + " test.yaml",            // Cluster-scoped: no namespace
+		"Service " + snapshotKey("Service", "team", "web") + " test.yaml",
+	}
+	if !reflect.DeepEqual(got, expected) {
+		t.Errorf("DecodeManifests = %v, expected %v", got, expected)
+	}
+
+	for _, invalid := range []string{
+		"apiVersion: v1\nkind: ConfigMap\nmetadata: {}\n",               // No name
+		"kind: ConfigMap\nmetadata:\n  name: settings\n",                // No apiVersion
+		"apiVersion: v1\nkind: NoSuchKind\nmetadata:\n  name: thing\n",  // Unknown kind
+		"apiVersion: v1\nkind: ConfigMap\nmetadata:\n  name: [broken\n", // Invalid YAML
+	} {
+		if _, err := DecodeManifests(strings.NewReader(invalid), "test.yaml"); err == nil {
+			t.Errorf("DecodeManifests(%q): expected an error", invalid)
+		}
+	}
+}
+
+// manifestChanges compares a manifest against a live object
+func manifestChanges(t *testing.T, manifest string, live interface{}) []FieldChange {
+	manifests, err := DecodeManifests(strings.NewReader(manifest), "test.yaml")
+	if err != nil || len(manifests) != 1 {
+		t.Fatalf("DecodeManifests: %d manifest(s), error %v", len(manifests), err)
+	}
+	liveMap, err := toJSONMap(live)
+	if err != nil {
+		t.Fatal(err)
+	}
+	var changes []FieldChange
+	compareManifest("", manifests[0].object, manifests[0].decoded, liveMap, &changes)
+	return changes
+}
+
+func TestCompareManifest(t *testing.T) {
+	manifest := `
+apiVersion: v1
+kind: Pod
+metadata:
+  name: web
+  labels:
+    app: web
+  resourceVersion: "1"
+spec:
+  containers:
+  - name: web
+    image: nginx:1.11
+    resources:
+      limits:
+        cpu: "0.5"
+status:
+  phase: Pending
+`
+	// The live object as the API server returns it: defaulted fields, status, ...
+	livePod := func() *apiv1.Pod {
+		return &apiv1.Pod{
+			ObjectMeta: apiv1.ObjectMeta{Namespace: "default", Name: "web", Labels: map[string]string{"app": "web"}, ResourceVersion: "42"},
+			Spec: apiv1.PodSpec{
+				Containers: []apiv1.Container{{
+					Name:                   "web",
+					Image:                  "nginx:1.11",
+					ImagePullPolicy:        apiv1.PullIfNotPresent,
+					TerminationMessagePath: "/dev/termination-log",
+					Resources:              apiv1.ResourceRequirements{Limits: apiv1.ResourceList{apiv1.ResourceCPU: resource.MustParse("500m")}},
+				}},
+				RestartPolicy: apiv1.RestartPolicyAlways,
+				DNSPolicy:     apiv1.DNSClusterFirst,
+			},
+			Status: apiv1.PodStatus{Phase: apiv1.PodRunning},
+		}
+	}
+
+	tests := []struct {
+		name     string
+		modify   func(pod *apiv1.Pod)
+		expected []FieldChange
+	}{
+		// Defaulted fields, the status, the resourceVersion and equivalent quantities ("0.5" and "500m") are not differences
+		{"in sync", func(pod *apiv1.Pod) {}, nil},
+		{"modified", func(pod *apiv1.Pod) { pod.Spec.Containers[0].Image = "nginx:1.12" }, []FieldChange{
+			{Path: "spec.containers[0].image", Old: "nginx:1.11", New: "nginx:1.12"},
+		}},
+		{"missing", func(pod *apiv1.Pod) { pod.Labels = nil }, []FieldChange{
+			{Path: "metadata.labels", Old: map[string]interface{}{"app": "web"}},
+		}},
+		{"added to a list", func(pod *apiv1.Pod) {
+			pod.Spec.Containers = append(pod.Spec.Containers, apiv1.Container{Name: "sidecar", Image: "envoy"})
+		}, []FieldChange{
+			{Path: "spec.containers[1]", New: map[string]interface{}{"name": "sidecar", "image": "envoy", "resources": map[string]interface{}{}}},
+		}},
+		{"removed from a list", func(pod *apiv1.Pod) { pod.Spec.Containers = []apiv1.Container{} }, []FieldChange{
+			{Path: "spec.containers[0]", Old: map[string]interface{}{"name": "web", "image": "nginx:1.11", "resources": map[string]interface{}{"limits": map[string]interface{}{"cpu": "500m"}}}},
+		}},
+	}
+	for _, test := range tests {
+		pod := livePod()
+		test.modify(pod)
+		if changes := manifestChanges(t, manifest, pod); !reflect.DeepEqual(changes, test.expected) {
+			t.Errorf("%s: compareManifest = %+v, expected %+v", test.name, changes, test.expected)
+		}
+	}
+}
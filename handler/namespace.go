@@ -1,6 +1,8 @@
 package handler
 
 import (
+	"os"
+
 	"github.com/golang/glog"
 	//
 
@@ -11,16 +13,22 @@ import (
 func NamespaceCreated(namespace *apiv1.Namespace) error {
 	glog.Info("=====> A namespace got created")
 	JsonPrettyPrint("namespace", namespace)
+	PrintNamespaceCapacity(os.Stdout, namespace.Name)
+	policiesNamespaceChanged(nil, namespace)
+	ProvisionNamespace(namespace)
 	return nil
 }
 
 func NamespaceDeleted(namespace *apiv1.Namespace) error {
 	glog.Info("=====> A namespace got deleted")
 	JsonPrettyPrint("namespace", namespace)
+	policiesNamespaceChanged(namespace, nil)
 	return nil
 }
 
-// Still TBD if / when / how to use  -- stub so far
+// Namespace updates are not printed. Label and isolation changes are passed on to the NetworkPolicy resolver, which re-resolves the
+// policies of the namespace and the ones selecting peers by namespace labels
 func NamespaceUpdated(old, updated *apiv1.Namespace) error {
+	policiesNamespaceChanged(old, updated)
 	return nil
 }
@@ -0,0 +1,266 @@
+package handler
+
+import (
+	"encoding/json"
+	"fmt"
+	"io"
+	"net/http"
+	"os"
+	"sort"
+	"sync"
+	"time"
+
+	"github.com/golang/glog"
+	//
+
+	"github.com/FlorianOtel/client-go/pkg/api"
+	apiv1 "github.com/FlorianOtel/client-go/pkg/api/v1"
+	apiv1beta1 "github.com/FlorianOtel/client-go/pkg/apis/extensions/v1beta1"
+	"github.com/FlorianOtel/client-go/pkg/util/intstr"
+)
+
+// NetworkPolicy lint: hygiene checks over the cached NetworkPolicies, Pods and Namespaces. The checks are:
+// - "empty-selector":        the podSelector of a policy matches no Pods
+// - "unmatched-peers":       the peers of an ingress rule match no Pods and no Namespaces
+// - "unexposed-port":        a port of an ingress rule is not exposed by any container of the selected Pods
+// - "duplicate-policy":      a policy has the same spec as another policy of its namespace
+// - "shadowed-policy":       a policy admits nothing beyond what another policy -- selecting (at least) the same Pods -- already admits
+// - "unprotected-namespace": a namespace has Pods but no NetworkPolicies
+//
+// When run continuously (ReportNetworkPolicyLint), a "raised" event is emitted for each new finding and a "resolved" event for
+// each finding that went away -- as JSON lines to LintLog.
+
+// LintLog is where the NetworkPolicy lint events are written. Defaults to stdout
+var LintLog io.Writer = os.Stdout
+
+// LintFinding is a single NetworkPolicy lint finding
+type LintFinding struct {
+	Check     string `json:"check"`
+	Namespace string `json:"namespace"`
+	Policy    string `json:"policy,omitempty"` // Empty for namespace-level findings
+	Detail    string `json:"detail"`
+}
+
+// LintEvent is a lint finding being raised or resolved
+type LintEvent struct {
+	Time   time.Time `json:"time"`
+	Status string    `json:"status"` // "raised" or "resolved"
+	LintFinding
+}
+
+var (
+	lintMutex    sync.Mutex
+	lintFindings = make(map[LintFinding]bool) // The findings of the previous ReportNetworkPolicyLint run
+)
+
+// subset tells whether all the elements of "a" are in "b"
+func subset(a, b []string) bool {
+	set := make(map[string]bool, len(b))
+	for _, s := range b {
+		set[s] = true
+	}
+	for _, s := range a {
+		if !set[s] {
+			return false
+		}
+	}
+	return true
+}
+
+// ruleCovered tells whether everything an ingress rule admits is also admitted by another rule
+func ruleCovered(r, by PolicyRuleSelection) bool {
+	portsCovered := (len(by.Ports) == 1 && by.Ports[0] == "all") || subset(r.Ports, by.Ports)
+	peersCovered := by.AllSources || (!r.AllSources && subset(r.Pods, by.Pods) && subset(r.Namespaces, by.Namespaces))
+	return portsCovered && peersCovered
+}
+
+// policyShadowed tells whether a (resolved) policy admits nothing beyond another one: it selects a subset of its Pods, and
+// each of its rules is covered by a rule of the other policy
+func policyShadowed(sel, by PolicySelection) bool {
+	if len(sel.Pods) == 0 || !subset(sel.Pods, by.Pods) {
+		return false
+	}
+	for _, r := range sel.Rules {
+		covered := false
+		for _, b := range by.Rules {
+			covered = covered || ruleCovered(r, b)
+		}
+		if !covered {
+			return false
+		}
+	}
+	return true
+}
+
+// portExposed tells whether any of the Pods exposes a NetworkPolicyPort
+func portExposed(p apiv1beta1.NetworkPolicyPort, pods []*apiv1.Pod) bool {
+	protocol := apiv1.ProtocolTCP
+	if p.Protocol != nil {
+		protocol = *p.Protocol
+	}
+	for _, pod := range pods {
+		if p.Port.Type == intstr.String {
+			if _, ok := containerPort(pod, p.Port.StrVal, protocol); ok {
+				return true
+			}
+			continue
+		}
+		for _, c := range pod.Spec.Containers {
+			for _, cp := range c.Ports {
+				cpProtocol := cp.Protocol
+				if cpProtocol == "" {
+					cpProtocol = apiv1.ProtocolTCP
+				}
+				if cp.ContainerPort == p.Port.IntVal && cpProtocol == protocol {
+					return true
+				}
+			}
+		}
+	}
+	return false
+}
+
+// LintNetworkPolicies runs the lint checks on the cached NetworkPolicies, Pods and Namespaces
+func LintNetworkPolicies() []LintFinding {
+	findings := []LintFinding{}
+
+	policies := CachedNetworkPolicies()
+	selections := make([]PolicySelection, len(policies))
+	for i, np := range policies {
+		selections[i] = resolvePolicy(np)
+	}
+
+	var pods []*apiv1.Pod
+	for _, pod := range cachedPods() {
+		if !podTerminated(pod) {
+			pods = append(pods, pod)
+		}
+	}
+
+	for i, np := range policies {
+		sel := selections[i]
+
+		if len(sel.Pods) == 0 {
+			findings = append(findings, LintFinding{"empty-selector", np.Namespace, np.Name, "podSelector matches no pods"})
+		}
+
+		var selected []*apiv1.Pod
+		for _, pod := range pods {
+			if policySelectsPod(np, pod) {
+				selected = append(selected, pod)
+			}
+		}
+
+		for j, rule := range np.Spec.Ingress {
+			r := sel.Rules[j]
+			if !r.AllSources && len(r.Pods) == 0 && len(r.Namespaces) == 0 {
+				findings = append(findings, LintFinding{"unmatched-peers", np.Namespace, np.Name, fmt.Sprintf("rule %d: peers match no pods and no namespaces", j)})
+			}
+			if len(selected) == 0 {
+				continue
+			}
+			for _, p := range rule.Ports {
+				if p.Port != nil && !portExposed(p, selected) {
+					findings = append(findings, LintFinding{"unexposed-port", np.Namespace, np.Name, fmt.Sprintf("rule %d: port %s not exposed by any container of the selected pods", j, portString(p))})
+				}
+			}
+		}
+
+		for k, other := range policies {
+			if k == i || other.Namespace != np.Namespace {
+				continue
+			}
+			if api.Semantic.DeepEqual(np.Spec, other.Spec) {
+				// Report the duplicate once: on the policy sorting last
+				if k < i {
+					findings = append(findings, LintFinding{"duplicate-policy", np.Namespace, np.Name, fmt.Sprintf("same spec as %s", other.Name)})
+				}
+				continue
+			}
+			// Mutually shadowing policies are equivalent: report only the one sorting last
+			if policyShadowed(sel, selections[k]) && (k < i || !policyShadowed(selections[k], sel)) {
+				findings = append(findings, LintFinding{"shadowed-policy", np.Namespace, np.Name, fmt.Sprintf("admits nothing beyond %s", other.Name)})
+			}
+		}
+	}
+
+	// Namespaces with Pods but no policies. The number of Pods is left out of the finding: it would be raised anew on each Pod
+	// added / deleted
+	withPods := make(map[string]bool)
+	for _, pod := range pods {
+		withPods[pod.Namespace] = true
+	}
+	for _, np := range policies {
+		delete(withPods, np.Namespace)
+	}
+	for ns := range withPods {
+		detail := "pods but no NetworkPolicies -- namespace not isolated: all ingress allowed"
+		if namespaceIsolated(ns) {
+			detail = "pods but no NetworkPolicies -- namespace isolated: all ingress denied"
+		}
+		findings = append(findings, LintFinding{"unprotected-namespace", ns, "", detail})
+	}
+
+	sort.SliceStable(findings, func(i, j int) bool {
+		if findings[i].Namespace != findings[j].Namespace {
+			return findings[i].Namespace < findings[j].Namespace
+		}
+		if findings[i].Policy != findings[j].Policy {
+			return findings[i].Policy < findings[j].Policy
+		}
+		return findings[i].Check < findings[j].Check
+	})
+	return findings
+}
+
+// lintEvent writes a lint event to the LintLog
+func lintEvent(status string, f LintFinding) {
+	b, err := json.Marshal(LintEvent{Time: time.Now().UTC(), Status: status, LintFinding: f})
+	if err != nil {
+		glog.Errorf("Error marshalling lint event %#v. Error: %s", f, err)
+		return
+	}
+	if _, err := fmt.Fprintf(LintLog, "%s\n", b); err != nil {
+		glog.Errorf("Error writing lint event. Error: %s", err)
+	}
+}
+
+// ReportNetworkPolicyLint runs the lint checks, and emits an event for each finding raised or resolved since the previous run.
+// Meant to be run periodically (e.g. via wait.Until)
+func ReportNetworkPolicyLint() {
+	lintMutex.Lock()
+	defer lintMutex.Unlock()
+
+	current := make(map[LintFinding]bool)
+	for _, f := range LintNetworkPolicies() {
+		current[f] = true
+		if !lintFindings[f] {
+			lintEvent("raised", f)
+		}
+	}
+	for f := range lintFindings {
+		if !current[f] {
+			lintEvent("resolved", f)
+		}
+	}
+	lintFindings = current
+}
+
+// PrintLintFindings prints the lint findings, one per line
+func PrintLintFindings(w io.Writer, findings []LintFinding) {
+	if len(findings) == 0 {
+		fmt.Fprintf(w, "  <no findings>\n")
+	}
+	for _, f := range findings {
+		if f.Policy != "" {
+			fmt.Fprintf(w, "  [%s] networkpolicy %s: %s\n", f.Check, objectName(f.Namespace, f.Policy), f.Detail)
+		} else {
+			fmt.Fprintf(w, "  [%s] namespace %s: %s\n", f.Check, f.Namespace, f.Detail)
+		}
+	}
+}
+
+// NetworkPolicyLintHandler runs the lint checks on demand over HTTP: /netpollint
+func NetworkPolicyLintHandler(w http.ResponseWriter, r *http.Request) {
+	writeJSON(w, LintNetworkPolicies())
+}
@@ -0,0 +1,375 @@
+package handler
+
+import (
+	"encoding/json"
+	"fmt"
+	"io"
+	"net/http"
+	"os"
+	"reflect"
+	"sort"
+	"sync"
+
+	"github.com/golang/glog"
+	//
+
+	apiv1 "github.com/FlorianOtel/client-go/pkg/api/v1"
+	apiv1beta1 "github.com/FlorianOtel/client-go/pkg/apis/extensions/v1beta1"
+	metav1 "github.com/FlorianOtel/client-go/pkg/apis/meta/v1"
+	"github.com/FlorianOtel/client-go/pkg/labels"
+)
+
+// NetworkPolicy selection resolver: the label selectors of each NetworkPolicy are evaluated against the cached Pods and Namespaces,
+// giving the concrete set of Pods the policy applies to -- and, per ingress rule, the concrete peers it admits.
+// The selections are kept up to date incrementally: a Pod / Namespace change only re-resolves the policies it may affect.
+//
+// Beta (extensions/v1beta1) semantics:
+// - Pods are only isolated if their namespace has the "DefaultDeny" ingress isolation annotation. Otherwise all ingress is allowed
+// - The traffic allowed to an isolated Pod is the union of the ingress rules of all the policies selecting it. None: no ingress at all
+// - An ingress rule without "from" admits all sources; without "ports", all ports
+// - A "podSelector" peer selects Pods in the namespace of the policy. A "namespaceSelector" peer selects all Pods in the matching namespaces
+
+// NetworkPolicyAnnotation is the (beta) namespace annotation enabling ingress isolation
+const NetworkPolicyAnnotation = "net.beta.kubernetes.io/network-policy"
+
+// PolicyRuleSelection is the resolved form of an ingress rule
+type PolicyRuleSelection struct {
+	Ports      []string `json:"ports"`      // E.g. "TCP/80". "all" if the rule has no ports
+	AllSources bool     `json:"allSources"` // The rule has no "from": all sources are admitted
+	Pods       []string `json:"pods"`       // Admitted Pods ("namespace/name")
+	Namespaces []string `json:"namespaces"` // Namespaces matched by namespaceSelector peers -- all their Pods are admitted
+}
+
+// PolicySelection is the resolved form of a NetworkPolicy
+type PolicySelection struct {
+	Namespace string                `json:"namespace"`
+	Name      string                `json:"name"`
+	Isolated  bool                  `json:"isolated"` // Whether the namespace is isolated, i.e. whether the policy is actually in effect
+	Pods      []string              `json:"pods"`     // Pods selected by the policy ("namespace/name")
+	Rules     []PolicyRuleSelection `json:"rules"`
+}
+
+var (
+	policySelectionsMutex sync.Mutex
+	policySelections      = make(map[string]PolicySelection) // "namespace/name" -> resolved policy
+)
+
+// selectorMatches tells whether a label selector matches a set of labels. Invalid selectors match nothing
+func selectorMatches(selector *metav1.LabelSelector, lbls map[string]string) bool {
+	s, err := metav1.LabelSelectorAsSelector(selector)
+	if err != nil {
+		glog.V(2).Infof("Invalid label selector %v. Error: %s", selector, err)
+		return false
+	}
+	return s.Matches(labels.Set(lbls))
+}
+
+// cachedNamespace returns a Namespace from the cache. Nil if unknown (or if Namespaces are not watched)
+func cachedNamespace(name string) *apiv1.Namespace {
+	if NamespaceStore == nil {
+		return nil
+	}
+	obj, exists, err := NamespaceStore.GetByKey(name)
+	if err != nil || !exists {
+		return nil
+	}
+	return obj.(*apiv1.Namespace)
+}
+
+// isolatedNamespace tells whether a namespace has ingress isolation ("DefaultDeny") enabled
+func isolatedNamespace(ns *apiv1.Namespace) bool {
+	if ns == nil {
+		return false
+	}
+	annotation, ok := ns.Annotations[NetworkPolicyAnnotation]
+	if !ok {
+		return false
+	}
+	var policy struct {
+		Ingress *struct {
+			Isolation string `json:"isolation"`
+		} `json:"ingress"`
+	}
+	if err := json.Unmarshal([]byte(annotation), &policy); err != nil {
+		glog.Warningf("Invalid %s annotation on namespace %s: %s", NetworkPolicyAnnotation, ns.Name, err)
+		return false
+	}
+	return policy.Ingress != nil && policy.Ingress.Isolation == "DefaultDeny"
+}
+
+// namespaceIsolated tells whether a (cached) namespace has ingress isolation enabled
+func namespaceIsolated(namespace string) bool {
+	return isolatedNamespace(cachedNamespace(namespace))
+}
+
+// cachedPods returns the cached Pods, sorted by namespace / name
+func cachedPods() []*apiv1.Pod {
+	var pods []*apiv1.Pod
+	if PodStore == nil {
+		return pods
+	}
+	for _, obj := range PodStore.List() {
+		pods = append(pods, obj.(*apiv1.Pod))
+	}
+	sort.Slice(pods, func(i, j int) bool {
+		return objectName(pods[i].Namespace, pods[i].Name) < objectName(pods[j].Namespace, pods[j].Name)
+	})
+	return pods
+}
+
+// CachedNetworkPolicies returns the cached NetworkPolicies, sorted by namespace / name
+func CachedNetworkPolicies() []*apiv1beta1.NetworkPolicy {
+	var policies []*apiv1beta1.NetworkPolicy
+	if NetworkPolicyStore == nil {
+		return policies
+	}
+	for _, obj := range NetworkPolicyStore.List() {
+		policies = append(policies, obj.(*apiv1beta1.NetworkPolicy))
+	}
+	sort.Slice(policies, func(i, j int) bool {
+		return objectName(policies[i].Namespace, policies[i].Name) < objectName(policies[j].Namespace, policies[j].Name)
+	})
+	return policies
+}
+
+// policySelectsPod tells whether a NetworkPolicy applies to a Pod
+func policySelectsPod(np *apiv1beta1.NetworkPolicy, pod *apiv1.Pod) bool {
+	return pod.Namespace == np.Namespace && selectorMatches(&np.Spec.PodSelector, pod.Labels)
+}
+
+// peerMatchesNamespace tells whether a namespaceSelector peer matches a namespace
+func peerMatchesNamespace(peer apiv1beta1.NetworkPolicyPeer, ns *apiv1.Namespace) bool {
+	return peer.NamespaceSelector != nil && ns != nil && selectorMatches(peer.NamespaceSelector, ns.Labels)
+}
+
+// peerMatchesPod tells whether a peer of a NetworkPolicy ingress rule matches a (source) Pod
+func peerMatchesPod(np *apiv1beta1.NetworkPolicy, peer apiv1beta1.NetworkPolicyPeer, pod *apiv1.Pod) bool {
+	if peer.PodSelector != nil {
+		return pod.Namespace == np.Namespace && selectorMatches(peer.PodSelector, pod.Labels)
+	}
+	return peerMatchesNamespace(peer, cachedNamespace(pod.Namespace))
+}
+
+// portString formats a NetworkPolicyPort, e.g. "TCP/80". Protocol defaults to TCP; a missing port means all ports
+func portString(p apiv1beta1.NetworkPolicyPort) string {
+	protocol := apiv1.ProtocolTCP
+	if p.Protocol != nil {
+		protocol = *p.Protocol
+	}
+	if p.Port == nil {
+		return string(protocol) + "/*"
+	}
+	return string(protocol) + "/" + p.Port.String()
+}
+
+// resolvePolicy resolves the selectors of a NetworkPolicy against the cached Pods and Namespaces
+func resolvePolicy(np *apiv1beta1.NetworkPolicy) PolicySelection {
+	sel := PolicySelection{Namespace: np.Namespace, Name: np.Name, Isolated: namespaceIsolated(np.Namespace), Pods: []string{}, Rules: []PolicyRuleSelection{}}
+
+	pods := cachedPods()
+	for _, pod := range pods {
+		if policySelectsPod(np, pod) {
+			sel.Pods = append(sel.Pods, objectName(pod.Namespace, pod.Name))
+		}
+	}
+
+	var namespaces []*apiv1.Namespace
+	if NamespaceStore != nil {
+		for _, obj := range NamespaceStore.List() {
+			namespaces = append(namespaces, obj.(*apiv1.Namespace))
+		}
+	}
+
+	for _, rule := range np.Spec.Ingress {
+		r := PolicyRuleSelection{Ports: []string{}, AllSources: len(rule.From) == 0, Pods: []string{}, Namespaces: []string{}}
+		for _, p := range rule.Ports {
+			r.Ports = append(r.Ports, portString(p))
+		}
+		if len(r.Ports) == 0 {
+			r.Ports = append(r.Ports, "all")
+		}
+
+		admitted := make(map[string]bool)
+		for _, peer := range rule.From {
+			for _, pod := range pods {
+				if peerMatchesPod(np, peer, pod) {
+					admitted[objectName(pod.Namespace, pod.Name)] = true
+				}
+			}
+			for _, ns := range namespaces {
+				if peerMatchesNamespace(peer, ns) {
+					r.Namespaces = append(r.Namespaces, ns.Name)
+				}
+			}
+		}
+		for pod := range admitted {
+			r.Pods = append(r.Pods, pod)
+		}
+		sort.Strings(r.Pods)
+		sort.Strings(r.Namespaces)
+
+		sel.Rules = append(sel.Rules, r)
+	}
+
+	return sel
+}
+
+// refreshPolicies re-resolves the cached NetworkPolicies accepted by "affected", and reports how their selections changed
+func refreshPolicies(w io.Writer, affected func(np *apiv1beta1.NetworkPolicy) bool) {
+	policySelectionsMutex.Lock()
+	defer policySelectionsMutex.Unlock()
+
+	for _, np := range CachedNetworkPolicies() {
+		if !affected(np) {
+			continue
+		}
+		key := objectName(np.Namespace, np.Name)
+		old, known := policySelections[key]
+		updated := resolvePolicy(np)
+		policySelections[key] = updated
+
+		if known {
+			printSelectionChanges(w, old, updated)
+		}
+	}
+}
+
+// storePolicy (re-)resolves a NetworkPolicy and stores its selection
+func storePolicy(np *apiv1beta1.NetworkPolicy) PolicySelection {
+	policySelectionsMutex.Lock()
+	defer policySelectionsMutex.Unlock()
+
+	sel := resolvePolicy(np)
+	policySelections[objectName(np.Namespace, np.Name)] = sel
+	return sel
+}
+
+// forgetPolicy drops the resolved selection of a deleted NetworkPolicy
+func forgetPolicy(np *apiv1beta1.NetworkPolicy) {
+	policySelectionsMutex.Lock()
+	defer policySelectionsMutex.Unlock()
+	delete(policySelections, objectName(np.Namespace, np.Name))
+}
+
+// hasNamespaceSelector tells whether any ingress rule of a NetworkPolicy has a namespaceSelector peer
+func hasNamespaceSelector(np *apiv1beta1.NetworkPolicy) bool {
+	for _, rule := range np.Spec.Ingress {
+		for _, peer := range rule.From {
+			if peer.NamespaceSelector != nil {
+				return true
+			}
+		}
+	}
+	return false
+}
+
+// policiesPodChanged re-resolves the policies a Pod change may affect: the ones in its namespace, and the ones admitting
+// peers by namespace. Only label changes matter for existing Pods
+func policiesPodChanged(old, updated *apiv1.Pod) {
+	pod := updated
+	if pod == nil {
+		pod = old
+	}
+	if old != nil && updated != nil && reflect.DeepEqual(old.Labels, updated.Labels) {
+		return
+	}
+	refreshPolicies(os.Stdout, func(np *apiv1beta1.NetworkPolicy) bool {
+		return np.Namespace == pod.Namespace || hasNamespaceSelector(np)
+	})
+}
+
+// policiesNamespaceChanged re-resolves the policies a Namespace change may affect: the ones in it (isolation), and the ones
+// admitting peers by namespace (labels)
+func policiesNamespaceChanged(old, updated *apiv1.Namespace) {
+	ns := updated
+	if ns == nil {
+		ns = old
+	}
+	if old != nil && updated != nil && reflect.DeepEqual(old.Labels, updated.Labels) && isolatedNamespace(old) == isolatedNamespace(updated) {
+		return
+	}
+	refreshPolicies(os.Stdout, func(np *apiv1beta1.NetworkPolicy) bool {
+		return np.Namespace == ns.Name || hasNamespaceSelector(np)
+	})
+}
+
+// PolicySelections returns the resolved NetworkPolicies of a namespace -- or of all namespaces if "namespace" is empty
+func PolicySelections(namespace string) []PolicySelection {
+	policySelectionsMutex.Lock()
+	defer policySelectionsMutex.Unlock()
+
+	selections := []PolicySelection{}
+	for _, sel := range policySelections {
+		if namespace == "" || sel.Namespace == namespace {
+			selections = append(selections, sel)
+		}
+	}
+	sort.Slice(selections, func(i, j int) bool {
+		return objectName(selections[i].Namespace, selections[i].Name) < objectName(selections[j].Namespace, selections[j].Name)
+	})
+	return selections
+}
+
+// PrintPolicySelection prints the Pods a NetworkPolicy applies to, and the peers each of its ingress rules admits
+func PrintPolicySelection(w io.Writer, sel PolicySelection) {
+	isolation := "namespace isolated (DefaultDeny)"
+	if !sel.Isolated {
+		isolation = "namespace NOT isolated -- policy has no effect"
+	}
+	fmt.Fprintf(w, "  networkpolicy %s (%s) applies to %d pod(s): %v\n", objectName(sel.Namespace, sel.Name), isolation, len(sel.Pods), sel.Pods)
+	if len(sel.Rules) == 0 {
+		fmt.Fprintf(w, "    no ingress rules: no traffic admitted\n")
+	}
+	for i, r := range sel.Rules {
+		if r.AllSources {
+			fmt.Fprintf(w, "    rule %d, ports %v: admits all sources\n", i, r.Ports)
+			continue
+		}
+		fmt.Fprintf(w, "    rule %d, ports %v: admits pods %v", i, r.Ports, r.Pods)
+		if len(r.Namespaces) > 0 {
+			fmt.Fprintf(w, ", all pods in namespaces %v", r.Namespaces)
+		}
+		fmt.Fprintf(w, "\n")
+	}
+}
+
+// printSelectionChanges reports the differences between two resolutions of the same NetworkPolicy
+func printSelectionChanges(w io.Writer, old, updated PolicySelection) {
+	name := objectName(updated.Namespace, updated.Name)
+
+	if old.Isolated != updated.Isolated {
+		fmt.Fprintf(w, "  networkpolicy %s: namespace isolation %v -> %v\n", name, old.Isolated, updated.Isolated)
+	}
+	added, removed := diffStrings(old.Pods, updated.Pods)
+	for _, p := range added {
+		fmt.Fprintf(w, "  networkpolicy %s now applies to pod %s\n", name, p)
+	}
+	for _, p := range removed {
+		fmt.Fprintf(w, "  networkpolicy %s no longer applies to pod %s\n", name, p)
+	}
+
+	if len(old.Rules) != len(updated.Rules) {
+		return // Spec change -- reported by the caller
+	}
+	for i := range updated.Rules {
+		added, removed := diffStrings(old.Rules[i].Pods, updated.Rules[i].Pods)
+		for _, p := range added {
+			fmt.Fprintf(w, "  networkpolicy %s rule %d now admits pod %s\n", name, i, p)
+		}
+		for _, p := range removed {
+			fmt.Fprintf(w, "  networkpolicy %s rule %d no longer admits pod %s\n", name, i, p)
+		}
+		added, removed = diffStrings(old.Rules[i].Namespaces, updated.Rules[i].Namespaces)
+		for _, ns := range added {
+			fmt.Fprintf(w, "  networkpolicy %s rule %d now admits namespace %s\n", name, i, ns)
+		}
+		for _, ns := range removed {
+			fmt.Fprintf(w, "  networkpolicy %s rule %d no longer admits namespace %s\n", name, i, ns)
+		}
+	}
+}
+
+// NetworkPolicySelectionsHandler serves the resolved NetworkPolicies over HTTP, e.g. /networkpolicies[?namespace=default]
+func NetworkPolicySelectionsHandler(w http.ResponseWriter, r *http.Request) {
+	writeJSON(w, PolicySelections(r.URL.Query().Get("namespace")))
+}
@@ -1,8 +1,13 @@
 package handler
 
 import (
-	apiv1beta1 "github.com/FlorianOtel/client-go/pkg/apis/extensions/v1beta1"
+	"os"
+
 	"github.com/golang/glog"
+	//
+
+	"github.com/FlorianOtel/client-go/pkg/api"
+	apiv1beta1 "github.com/FlorianOtel/client-go/pkg/apis/extensions/v1beta1"
 )
 
 // "github.com/FlorianOtel/client-go/pkg/util/wait"
@@ -10,16 +15,24 @@ import (
 func NetworkPolicyCreated(networkpolicy *apiv1beta1.NetworkPolicy) error {
 	glog.Info("=====> A networkpolicy got created")
 	JsonPrettyPrint("networkpolicy", networkpolicy)
+	PrintPolicySelection(os.Stdout, storePolicy(networkpolicy))
 	return nil
 }
 
 func NetworkPolicyDeleted(networkpolicy *apiv1beta1.NetworkPolicy) error {
 	glog.Info("=====> A networkpolicy got deleted")
 	JsonPrettyPrint("networkpolicy", networkpolicy)
+	forgetPolicy(networkpolicy)
 	return nil
 }
 
-// Still TBD if / when / how to use  -- stub so far
+// Spec changes: re-resolve the policy
 func NetworkPolicyUpdated(old, updated *apiv1beta1.NetworkPolicy) error {
+	if api.Semantic.DeepEqual(old.Spec, updated.Spec) {
+		return nil
+	}
+	glog.Infof("=====> A networkpolicy got updated: %s", objectName(updated.Namespace, updated.Name))
+	JsonPrettyPrint("networkpolicy", updated)
+	PrintPolicySelection(os.Stdout, storePolicy(updated))
 	return nil
 }
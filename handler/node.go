@@ -0,0 +1,29 @@
+package handler
+
+import (
+	"github.com/golang/glog"
+	//
+
+	apiv1 "github.com/FlorianOtel/client-go/pkg/api/v1"
+)
+
+func NodeCreated(node *apiv1.Node) error {
+	glog.Info("=====> A node got created")
+	JsonPrettyPrint("node", node)
+	return nil
+}
+
+func NodeDeleted(node *apiv1.Node) error {
+	glog.Info("=====> A node got deleted")
+	JsonPrettyPrint("node", node)
+	return nil
+}
+
+// When a node gets cordoned (usually the first step of a drain), warn about the PodDisruptionBudgets draining it would violate
+func NodeUpdated(old, updated *apiv1.Node) error {
+	if !old.Spec.Unschedulable && updated.Spec.Unschedulable {
+		glog.Infof("=====> A node got cordoned: %s", updated.Name)
+		warnDrainViolations(updated.Name)
+	}
+	return nil
+}
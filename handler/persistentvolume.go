@@ -0,0 +1,64 @@
+package handler
+
+import (
+	"fmt"
+
+	"github.com/golang/glog"
+	//
+
+	apiv1 "github.com/FlorianOtel/client-go/pkg/api/v1"
+)
+
+// printPersistentVolume prints a one-line summary of a PV: phase, capacity, reclaim policy, claim and storage class
+func printPersistentVolume(pv *apiv1.PersistentVolume) {
+	fmt.Printf("  persistentvolume %s: phase %s, capacity %s, reclaim policy %s, claim %s, storage class %q\n",
+		pv.Name, pv.Status.Phase, storageCapacity(pv.Spec.Capacity), pv.Spec.PersistentVolumeReclaimPolicy, claimRefString(pv.Spec.ClaimRef), pv.Annotations[StorageClassAnnotation])
+}
+
+func PersistentVolumeCreated(pv *apiv1.PersistentVolume) error {
+	glog.Info("=====> A persistentvolume got created")
+	trackPhase(pv.UID, string(pv.Status.Phase))
+	JsonPrettyPrint("persistentvolume", pv)
+	printPersistentVolume(pv)
+	return nil
+}
+
+func PersistentVolumeDeleted(pv *apiv1.PersistentVolume) error {
+	glog.Info("=====> A persistentvolume got deleted")
+	forgetPhase(pv.UID)
+	printPersistentVolume(pv)
+	return nil
+}
+
+// Report phase changes (binding / release), and changes of reclaim policy or capacity
+func PersistentVolumeUpdated(old, updated *apiv1.PersistentVolume) error {
+	trackPhase(updated.UID, string(updated.Status.Phase))
+
+	oldCapacity, newCapacity := storageCapacity(old.Spec.Capacity), storageCapacity(updated.Spec.Capacity)
+
+	if old.Status.Phase == updated.Status.Phase &&
+		old.Spec.PersistentVolumeReclaimPolicy == updated.Spec.PersistentVolumeReclaimPolicy &&
+		oldCapacity == newCapacity {
+		return nil
+	}
+
+	glog.Infof("=====> A persistentvolume got updated: %s", updated.Name)
+
+	if old.Status.Phase != updated.Status.Phase {
+		switch updated.Status.Phase {
+		case apiv1.VolumeBound:
+			fmt.Printf("  persistentvolume %s bound to claim %s\n", updated.Name, claimRefString(updated.Spec.ClaimRef))
+		case apiv1.VolumeReleased:
+			fmt.Printf("  persistentvolume %s released by claim %s (reclaim policy %s)\n", updated.Name, claimRefString(updated.Spec.ClaimRef), updated.Spec.PersistentVolumeReclaimPolicy)
+		default:
+			fmt.Printf("  persistentvolume %s phase %s -> %s %s\n", updated.Name, old.Status.Phase, updated.Status.Phase, updated.Status.Message)
+		}
+	}
+	if old.Spec.PersistentVolumeReclaimPolicy != updated.Spec.PersistentVolumeReclaimPolicy {
+		fmt.Printf("  persistentvolume %s reclaim policy %s -> %s\n", updated.Name, old.Spec.PersistentVolumeReclaimPolicy, updated.Spec.PersistentVolumeReclaimPolicy)
+	}
+	if oldCapacity != newCapacity {
+		fmt.Printf("  persistentvolume %s capacity %s -> %s\n", updated.Name, oldCapacity, newCapacity)
+	}
+	return nil
+}
@@ -0,0 +1,54 @@
+package handler
+
+import (
+	"fmt"
+
+	"github.com/golang/glog"
+	//
+
+	apiv1 "github.com/FlorianOtel/client-go/pkg/api/v1"
+)
+
+// printPersistentVolumeClaim prints a one-line summary of a PVC: phase, requested / bound capacity, volume and storage class -- plus the Pods mounting it
+func printPersistentVolumeClaim(pvc *apiv1.PersistentVolumeClaim) {
+	fmt.Printf("  persistentvolumeclaim %s/%s: phase %s, requested %s, capacity %s, volume %q, storage class %q. Mounted by pods: %v\n",
+		pvc.Namespace, pvc.Name, pvc.Status.Phase, storageCapacity(pvc.Spec.Resources.Requests), storageCapacity(pvc.Status.Capacity),
+		pvc.Spec.VolumeName, pvc.Annotations[StorageClassAnnotation], PodsMountingClaim(pvc.Namespace, pvc.Name))
+}
+
+func PersistentVolumeClaimCreated(pvc *apiv1.PersistentVolumeClaim) error {
+	glog.Info("=====> A persistentvolumeclaim got created")
+	trackPhase(pvc.UID, string(pvc.Status.Phase))
+	JsonPrettyPrint("persistentvolumeclaim", pvc)
+	printPersistentVolumeClaim(pvc)
+	return nil
+}
+
+func PersistentVolumeClaimDeleted(pvc *apiv1.PersistentVolumeClaim) error {
+	glog.Info("=====> A persistentvolumeclaim got deleted")
+	forgetPhase(pvc.UID)
+	printPersistentVolumeClaim(pvc)
+	return nil
+}
+
+// Report claim binding (or losing the bound volume)
+func PersistentVolumeClaimUpdated(old, updated *apiv1.PersistentVolumeClaim) error {
+	trackPhase(updated.UID, string(updated.Status.Phase))
+
+	if old.Status.Phase == updated.Status.Phase && old.Spec.VolumeName == updated.Spec.VolumeName {
+		return nil
+	}
+
+	glog.Infof("=====> A persistentvolumeclaim got updated: %s/%s", updated.Namespace, updated.Name)
+
+	switch updated.Status.Phase {
+	case apiv1.ClaimBound:
+		fmt.Printf("  persistentvolumeclaim %s/%s bound to volume %s (capacity %s)\n", updated.Namespace, updated.Name, updated.Spec.VolumeName, storageCapacity(updated.Status.Capacity))
+	case apiv1.ClaimLost:
+		fmt.Printf("  persistentvolumeclaim %s/%s lost its volume %s\n", updated.Namespace, updated.Name, old.Spec.VolumeName)
+	default:
+		fmt.Printf("  persistentvolumeclaim %s/%s phase %s -> %s\n", updated.Namespace, updated.Name, old.Status.Phase, updated.Status.Phase)
+	}
+	printPersistentVolumeClaim(updated)
+	return nil
+}
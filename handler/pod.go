@@ -1,6 +1,8 @@
 package handler
 
 import (
+	"os"
+
 	"github.com/golang/glog"
 	//
 
@@ -11,16 +13,35 @@ import (
 func PodCreated(pod *apiv1.Pod) error {
 	glog.Info("=====> A pod got created")
 	JsonPrettyPrint("pod", pod)
+	PrintLimitViolations(os.Stdout, CheckPodLimits(pod))
+	auditCreatedPod(pod)
+	recordPodTimeline(pod)
+	checkPodAlerts(nil, pod)
+	policiesPodChanged(nil, pod)
+	servicesPodChanged(nil, pod)
 	return nil
 }
 
 func PodDeleted(pod *apiv1.Pod) error {
 	glog.Info("=====> A pod got deleted")
 	JsonPrettyPrint("pod", pod)
+	recordPodDeleted(pod)
+	forgetPodAlerts(pod)
+	policiesPodChanged(pod, nil)
+	servicesPodChanged(pod, nil)
 	return nil
 }
 
-// Still TBD if / when / how to use  -- stub so far
+// Record the lifecycle changes (scheduling, container starts / restarts / terminations, readiness, ...) in the Pod timeline, and
+// print them. Container failures (crash loops, restart storms, OOM kills, image pull back-offs) are alerted on. Label / readiness
+// changes are passed on to the NetworkPolicy resolver and the Service health checks
 func PodUpdated(old, updated *apiv1.Pod) error {
+	if entries := recordPodTimeline(updated); len(entries) > 0 {
+		glog.Infof("=====> A pod got updated: %s", objectName(updated.Namespace, updated.Name))
+		printTimelineEntries(os.Stdout, entries)
+	}
+	checkPodAlerts(old, updated)
+	policiesPodChanged(old, updated)
+	servicesPodChanged(old, updated)
 	return nil
 }
@@ -0,0 +1,123 @@
+package handler
+
+import (
+	"fmt"
+	"net/http"
+	"sort"
+
+	"github.com/golang/glog"
+	//
+
+	apiv1 "github.com/FlorianOtel/client-go/pkg/api/v1"
+	metav1 "github.com/FlorianOtel/client-go/pkg/apis/meta/v1"
+	policyv1beta1 "github.com/FlorianOtel/client-go/pkg/apis/policy/v1beta1"
+	"github.com/FlorianOtel/client-go/pkg/labels"
+)
+
+// printPodDisruptionBudget prints a one-line summary of a PDB
+func printPodDisruptionBudget(pdb *policyv1beta1.PodDisruptionBudget) {
+	fmt.Printf("  poddisruptionbudget %s/%s: selector %s, minAvailable %s, healthy %d (desired %d, expected pods %d), disruptions allowed %d\n",
+		pdb.Namespace, pdb.Name, metav1.FormatLabelSelector(pdb.Spec.Selector), pdb.Spec.MinAvailable.String(),
+		pdb.Status.CurrentHealthy, pdb.Status.DesiredHealthy, pdb.Status.ExpectedPods, pdb.Status.PodDisruptionsAllowed)
+}
+
+func PodDisruptionBudgetCreated(pdb *policyv1beta1.PodDisruptionBudget) error {
+	glog.Info("=====> A poddisruptionbudget got created")
+	JsonPrettyPrint("poddisruptionbudget", pdb)
+	printPodDisruptionBudget(pdb)
+	return nil
+}
+
+func PodDisruptionBudgetDeleted(pdb *policyv1beta1.PodDisruptionBudget) error {
+	glog.Info("=====> A poddisruptionbudget got deleted")
+	printPodDisruptionBudget(pdb)
+	return nil
+}
+
+// Report when the allowed disruptions reach zero (i.e. no voluntary eviction is possible any more) -- and when they recover
+func PodDisruptionBudgetUpdated(old, updated *policyv1beta1.PodDisruptionBudget) error {
+	if old.Status.PodDisruptionsAllowed == updated.Status.PodDisruptionsAllowed {
+		return nil
+	}
+
+	glog.Infof("=====> A poddisruptionbudget got updated: %s/%s", updated.Namespace, updated.Name)
+	printPodDisruptionBudget(updated)
+
+	switch {
+	case updated.Status.PodDisruptionsAllowed == 0:
+		glog.Warningf("poddisruptionbudget %s/%s: no disruptions allowed any more (healthy %d, desired %d) -- evictions / node drains will be blocked",
+			updated.Namespace, updated.Name, updated.Status.CurrentHealthy, updated.Status.DesiredHealthy)
+	case old.Status.PodDisruptionsAllowed == 0:
+		glog.Infof("poddisruptionbudget %s/%s: disruptions allowed again (%d)", updated.Namespace, updated.Name, updated.Status.PodDisruptionsAllowed)
+	}
+	return nil
+}
+
+// DrainViolation is a PodDisruptionBudget that would be violated by draining a node
+type DrainViolation struct {
+	Node               string   `json:"node"`
+	Namespace          string   `json:"namespace"`
+	Budget             string   `json:"budget"`
+	DisruptionsAllowed int32    `json:"disruptionsAllowed"`
+	Pods               []string `json:"pods"` // The Pods on the node covered by the budget
+}
+
+// DrainViolations returns the PodDisruptionBudgets that would be violated by evicting all the (cached) Pods running on a node
+func DrainViolations(node string) []DrainViolation {
+	var violations []DrainViolation
+
+	if PodStore == nil || PodDisruptionBudgetStore == nil {
+		return violations
+	}
+
+	for _, obj := range PodDisruptionBudgetStore.List() {
+		pdb := obj.(*policyv1beta1.PodDisruptionBudget)
+		selector, err := metav1.LabelSelectorAsSelector(pdb.Spec.Selector)
+		if err != nil {
+			glog.Errorf("Invalid selector in poddisruptionbudget %s/%s. Error: %s", pdb.Namespace, pdb.Name, err)
+			continue
+		}
+
+		var pods []string
+		for _, pobj := range PodStore.List() {
+			pod := pobj.(*apiv1.Pod)
+			if pod.Spec.NodeName != node || pod.Namespace != pdb.Namespace || podTerminated(pod) {
+				continue
+			}
+			if selector.Matches(labels.Set(pod.Labels)) {
+				pods = append(pods, pod.Name)
+			}
+		}
+
+		if int32(len(pods)) > pdb.Status.PodDisruptionsAllowed {
+			sort.Strings(pods)
+			violations = append(violations, DrainViolation{node, pdb.Namespace, pdb.Name, pdb.Status.PodDisruptionsAllowed, pods})
+		}
+	}
+
+	return violations
+}
+
+// podTerminated tells whether a Pod is done running (and so is not affected by a drain)
+func podTerminated(pod *apiv1.Pod) bool {
+	return pod.Status.Phase == apiv1.PodSucceeded || pod.Status.Phase == apiv1.PodFailed
+}
+
+// warnDrainViolations logs a warning for each PodDisruptionBudget draining the node would violate
+func warnDrainViolations(node string) {
+	for _, v := range DrainViolations(node) {
+		glog.Warningf("Draining node %s would violate poddisruptionbudget %s/%s: %d pod(s) on the node %v, only %d disruption(s) allowed",
+			v.Node, v.Namespace, v.Budget, len(v.Pods), v.Pods, v.DisruptionsAllowed)
+	}
+}
+
+// DrainHandler serves node drain checks over HTTP, e.g. /drain?node=node-1
+func DrainHandler(w http.ResponseWriter, r *http.Request) {
+	node := r.URL.Query().Get("node")
+	if node == "" {
+		http.Error(w, "\"node\" is required", http.StatusBadRequest)
+		return
+	}
+	violations := DrainViolations(node)
+	writeJSON(w, map[string]interface{}{"node": node, "safe": len(violations) == 0, "violations": violations})
+}
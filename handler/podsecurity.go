@@ -0,0 +1,378 @@
+package handler
+
+import (
+	"encoding/json"
+	"fmt"
+	"io"
+	"net/http"
+	"os"
+	"reflect"
+	"sort"
+	"strings"
+	"time"
+
+	"github.com/golang/glog"
+	//
+
+	apiv1 "github.com/FlorianOtel/client-go/pkg/api/v1"
+	apiv1beta1 "github.com/FlorianOtel/client-go/pkg/apis/extensions/v1beta1"
+)
+
+// Pod security posture audit, over the cached Pods. The checks are:
+// - "privileged":         a privileged container
+// - "host-namespaces":    hostNetwork, hostPID or hostIPC
+// - "host-path":          a hostPath volume
+// - "run-as-root":        a container running -- or allowed to run -- as root (no runAsNonRoot, no non-zero runAsUser)
+// - "added-capabilities": a container adding capabilities
+// - "missing-limits":     a container without CPU / memory limits
+// - "unpinned-image":     an image using the "latest" tag -- explicitly or implicitly -- or not pinned by digest
+// - "automount-token":    the service account token is mounted in a container. N.B. This API version has no way to opt out
+//                         (no automountServiceAccountToken): the check tells which Pods can talk to the API server
+// - "psp-violation":      the Pod is admitted by none of the (cached) PodSecurityPolicies. Only checked when there are any.
+//                         The authorization to "use" the policies is not taken into account
+//
+// Findings are reported per namespace. The Pods created while we run are audited on creation, and reported as an event -- a JSON
+// line to SecurityLog -- if they are non-compliant.
+
+// SecurityLog is where the events about non-compliant Pods are written. Defaults to stdout
+var SecurityLog io.Writer = os.Stdout
+
+// serviceAccountMountPath is where the service account token is mounted
+const serviceAccountMountPath = "/var/run/secrets/kubernetes.io/serviceaccount"
+
+// SecurityFinding is a pod security finding
+type SecurityFinding struct {
+	Check     string `json:"check"`
+	Namespace string `json:"namespace"`
+	Pod       string `json:"pod"`
+	Container string `json:"container,omitempty"` // Empty for Pod-level findings
+	Detail    string `json:"detail"`
+}
+
+// NamespaceSecurity is the pod security posture of a namespace
+type NamespaceSecurity struct {
+	Namespace    string            `json:"namespace"`
+	Pods         int               `json:"pods"`
+	NonCompliant int               `json:"nonCompliant"`
+	Findings     []SecurityFinding `json:"findings"`
+}
+
+// SecurityEvent is the event reported when a non-compliant Pod gets created
+type SecurityEvent struct {
+	Time      time.Time         `json:"time"`
+	Event     string            `json:"event"` // "non-compliant-pod"
+	Namespace string            `json:"namespace"`
+	Pod       string            `json:"pod"`
+	Owner     string            `json:"owner,omitempty"`
+	Findings  []SecurityFinding `json:"findings"`
+}
+
+// volumeType returns the type of a volume -- the name of its source, e.g. "hostPath" -- as used by PodSecurityPolicies
+func volumeType(v apiv1.Volume) string {
+	source := reflect.ValueOf(v.VolumeSource)
+	for i := 0; i < source.NumField(); i++ {
+		if f := source.Field(i); f.Kind() == reflect.Ptr && !f.IsNil() {
+			return strings.Split(source.Type().Field(i).Tag.Get("json"), ",")[0]
+		}
+	}
+	return ""
+}
+
+// imagePinned tells whether an image is pinned: by digest, or by a tag other than "latest"
+func imagePinned(image string) (byDigest bool, tag string) {
+	if strings.Contains(image, "@") {
+		return true, ""
+	}
+	name := image[strings.LastIndex(image, "/")+1:]
+	if i := strings.LastIndex(name, ":"); i >= 0 {
+		return false, name[i+1:]
+	}
+	return false, "latest"
+}
+
+// runsAsRoot tells whether a container runs -- or may run -- as root, and why
+func runsAsRoot(pod *apiv1.Pod, c apiv1.Container) (bool, string) {
+	var uid *int64
+	var nonRoot *bool
+	if psc := pod.Spec.SecurityContext; psc != nil {
+		uid, nonRoot = psc.RunAsUser, psc.RunAsNonRoot
+	}
+	if sc := c.SecurityContext; sc != nil {
+		if sc.RunAsUser != nil {
+			uid = sc.RunAsUser
+		}
+		if sc.RunAsNonRoot != nil {
+			nonRoot = sc.RunAsNonRoot
+		}
+	}
+	switch {
+	case uid != nil && *uid == 0:
+		return true, "runAsUser 0"
+	case uid != nil:
+		return false, ""
+	case nonRoot != nil && *nonRoot:
+		return false, ""
+	default:
+		return true, "no runAsNonRoot / runAsUser: runs as the image user, possibly root"
+	}
+}
+
+// podContainers returns all the containers of a Pod -- init containers included
+func podContainers(pod *apiv1.Pod) []apiv1.Container {
+	return append(append([]apiv1.Container{}, pod.Spec.InitContainers...), pod.Spec.Containers...)
+}
+
+// AuditPod runs the security checks on a Pod
+func AuditPod(pod *apiv1.Pod) []SecurityFinding {
+	findings := []SecurityFinding{}
+	add := func(check, container, detail string) {
+		findings = append(findings, SecurityFinding{check, pod.Namespace, pod.Name, container, detail})
+	}
+
+	var hostNamespaces []string
+	if pod.Spec.HostNetwork {
+		hostNamespaces = append(hostNamespaces, "hostNetwork")
+	}
+	if pod.Spec.HostPID {
+		hostNamespaces = append(hostNamespaces, "hostPID")
+	}
+	if pod.Spec.HostIPC {
+		hostNamespaces = append(hostNamespaces, "hostIPC")
+	}
+	if len(hostNamespaces) > 0 {
+		add("host-namespaces", "", strings.Join(hostNamespaces, ", "))
+	}
+	for _, v := range pod.Spec.Volumes {
+		if v.HostPath != nil {
+			add("host-path", "", fmt.Sprintf("volume %s mounts host path %s", v.Name, v.HostPath.Path))
+		}
+	}
+
+	for _, c := range podContainers(pod) {
+		sc := c.SecurityContext
+		if sc != nil && sc.Privileged != nil && *sc.Privileged {
+			add("privileged", c.Name, "privileged container")
+		}
+		if root, why := runsAsRoot(pod, c); root {
+			add("run-as-root", c.Name, why)
+		}
+		if sc != nil && sc.Capabilities != nil && len(sc.Capabilities.Add) > 0 {
+			add("added-capabilities", c.Name, fmt.Sprintf("adds %v", sc.Capabilities.Add))
+		}
+		var missing []string
+		for _, r := range []apiv1.ResourceName{apiv1.ResourceCPU, apiv1.ResourceMemory} {
+			if _, ok := c.Resources.Limits[r]; !ok {
+				missing = append(missing, string(r))
+			}
+		}
+		if len(missing) > 0 {
+			add("missing-limits", c.Name, fmt.Sprintf("no %s limit", strings.Join(missing, " / ")))
+		}
+		if byDigest, tag := imagePinned(c.Image); !byDigest {
+			if tag == "latest" {
+				add("unpinned-image", c.Name, fmt.Sprintf("image %s uses the \"latest\" tag", c.Image))
+			} else {
+				add("unpinned-image", c.Name, fmt.Sprintf("image %s not pinned by digest", c.Image))
+			}
+		}
+		for _, m := range c.VolumeMounts {
+			if m.MountPath == serviceAccountMountPath {
+				add("automount-token", c.Name, fmt.Sprintf("token of service account %s mounted", podServiceAccount(pod)))
+			}
+		}
+	}
+
+	if policies := cachedPodSecurityPolicies(); len(policies) > 0 {
+		var violations []string
+		admitted := false
+		for _, psp := range policies {
+			v := pspViolations(psp, pod)
+			if len(v) == 0 {
+				admitted = true
+				break
+			}
+			violations = append(violations, fmt.Sprintf("%s: %s", psp.Name, strings.Join(v, ", ")))
+		}
+		if !admitted {
+			add("psp-violation", "", "admitted by no PodSecurityPolicy -- "+strings.Join(violations, "; "))
+		}
+	}
+
+	return findings
+}
+
+// cachedPodSecurityPolicies returns the cached PodSecurityPolicies, sorted by name
+func cachedPodSecurityPolicies() []*apiv1beta1.PodSecurityPolicy {
+	var policies []*apiv1beta1.PodSecurityPolicy
+	if PodSecurityPolicyStore == nil {
+		return policies
+	}
+	for _, obj := range PodSecurityPolicyStore.List() {
+		policies = append(policies, obj.(*apiv1beta1.PodSecurityPolicy))
+	}
+	sort.Slice(policies, func(i, j int) bool { return policies[i].Name < policies[j].Name })
+	return policies
+}
+
+// pspViolations returns the reasons a PodSecurityPolicy would not admit a Pod -- none if it would
+func pspViolations(psp *apiv1beta1.PodSecurityPolicy, pod *apiv1.Pod) []string {
+	var violations []string
+	spec := psp.Spec
+
+	if pod.Spec.HostNetwork && !spec.HostNetwork {
+		violations = append(violations, "hostNetwork")
+	}
+	if pod.Spec.HostPID && !spec.HostPID {
+		violations = append(violations, "hostPID")
+	}
+	if pod.Spec.HostIPC && !spec.HostIPC {
+		violations = append(violations, "hostIPC")
+	}
+
+	allowedVolumes := make(map[string]bool)
+	for _, fs := range spec.Volumes {
+		allowedVolumes[string(fs)] = true
+	}
+	for _, v := range pod.Spec.Volumes {
+		if t := volumeType(v); !allowedVolumes["*"] && !allowedVolumes[t] {
+			violations = append(violations, fmt.Sprintf("volume type %s (%s)", t, v.Name))
+		}
+	}
+
+	allowedCaps := make(map[apiv1.Capability]bool)
+	for _, c := range append(append([]apiv1.Capability{}, spec.AllowedCapabilities...), spec.DefaultAddCapabilities...) {
+		allowedCaps[c] = true
+	}
+
+	for _, c := range podContainers(pod) {
+		sc := c.SecurityContext
+		if sc != nil && sc.Privileged != nil && *sc.Privileged && !spec.Privileged {
+			violations = append(violations, fmt.Sprintf("privileged (%s)", c.Name))
+		}
+		if sc != nil && sc.Capabilities != nil {
+			for _, cap := range sc.Capabilities.Add {
+				if !allowedCaps[cap] {
+					violations = append(violations, fmt.Sprintf("capability %s (%s)", cap, c.Name))
+				}
+			}
+		}
+		for _, port := range c.Ports {
+			if port.HostPort == 0 {
+				continue
+			}
+			allowed := false
+			for _, r := range spec.HostPorts {
+				allowed = allowed || (port.HostPort >= r.Min && port.HostPort <= r.Max)
+			}
+			if !allowed {
+				violations = append(violations, fmt.Sprintf("hostPort %d (%s)", port.HostPort, c.Name))
+			}
+		}
+		// Unset, the admission defaults readOnlyRootFilesystem to true
+		if spec.ReadOnlyRootFilesystem && sc != nil && sc.ReadOnlyRootFilesystem != nil && !*sc.ReadOnlyRootFilesystem {
+			violations = append(violations, fmt.Sprintf("writable root filesystem (%s)", c.Name))
+		}
+
+		switch spec.RunAsUser.Rule {
+		case apiv1beta1.RunAsUserStrategyMustRunAsNonRoot:
+			if root, _ := runsAsRoot(pod, c); root {
+				violations = append(violations, fmt.Sprintf("may run as root (%s)", c.Name))
+			}
+		case apiv1beta1.RunAsUserStrategyMustRunAs:
+			// Unset, the admission defaults runAsUser to the minimum of the first range
+			uid := containerUID(pod, c)
+			allowed := uid == nil || len(spec.RunAsUser.Ranges) == 0
+			for _, r := range spec.RunAsUser.Ranges {
+				allowed = allowed || (*uid >= r.Min && *uid <= r.Max)
+			}
+			if !allowed {
+				violations = append(violations, fmt.Sprintf("runAsUser outside the allowed ranges (%s)", c.Name))
+			}
+		}
+	}
+
+	return violations
+}
+
+// containerUID returns the user ID a container runs as, if set
+func containerUID(pod *apiv1.Pod, c apiv1.Container) *int64 {
+	if c.SecurityContext != nil && c.SecurityContext.RunAsUser != nil {
+		return c.SecurityContext.RunAsUser
+	}
+	if pod.Spec.SecurityContext != nil {
+		return pod.Spec.SecurityContext.RunAsUser
+	}
+	return nil
+}
+
+// PodSecurityReport audits the cached Pods of a namespace -- or of all namespaces if "namespace" is empty -- per namespace
+func PodSecurityReport(namespace string) []NamespaceSecurity {
+	byNamespace := make(map[string]*NamespaceSecurity)
+	for _, pod := range cachedPods() {
+		if (namespace != "" && pod.Namespace != namespace) || podTerminated(pod) {
+			continue
+		}
+		ns, ok := byNamespace[pod.Namespace]
+		if !ok {
+			ns = &NamespaceSecurity{Namespace: pod.Namespace, Findings: []SecurityFinding{}}
+			byNamespace[pod.Namespace] = ns
+		}
+		ns.Pods++
+		if findings := AuditPod(pod); len(findings) > 0 {
+			ns.NonCompliant++
+			ns.Findings = append(ns.Findings, findings...)
+		}
+	}
+
+	report := []NamespaceSecurity{}
+	for _, ns := range byNamespace {
+		report = append(report, *ns)
+	}
+	sort.Slice(report, func(i, j int) bool { return report[i].Namespace < report[j].Namespace })
+	return report
+}
+
+// PrintPodSecurityReport prints the pod security posture, per namespace
+func PrintPodSecurityReport(w io.Writer, report []NamespaceSecurity) {
+	if len(report) == 0 {
+		fmt.Fprintf(w, "  <no pods>\n")
+	}
+	for _, ns := range report {
+		fmt.Fprintf(w, "Namespace %s: %d of %d pod(s) non-compliant\n", ns.Namespace, ns.NonCompliant, ns.Pods)
+		for _, f := range ns.Findings {
+			what := f.Pod
+			if f.Container != "" {
+				what += " [" + f.Container + "]"
+			}
+			fmt.Fprintf(w, "  [%s] pod %s: %s\n", f.Check, what, f.Detail)
+		}
+	}
+}
+
+// auditCreatedPod audits a Pod created while we run, and reports it to the SecurityLog if it's non-compliant.
+// The Pods that existed before are only covered by the report
+func auditCreatedPod(pod *apiv1.Pod) {
+	if pod.CreationTimestamp.Time.Before(startTime) {
+		return
+	}
+	findings := AuditPod(pod)
+	if len(findings) == 0 {
+		return
+	}
+	glog.Warningf("Non-compliant pod %s: %d security finding(s)", objectName(pod.Namespace, pod.Name), len(findings))
+
+	b, err := json.Marshal(SecurityEvent{Time: time.Now().UTC(), Event: "non-compliant-pod", Namespace: pod.Namespace, Pod: pod.Name,
+		Owner: PodOwner(pod), Findings: findings})
+	if err != nil {
+		glog.Errorf("Error marshalling security event for pod %s. Error: %s", objectName(pod.Namespace, pod.Name), err)
+		return
+	}
+	if _, err := fmt.Fprintf(SecurityLog, "%s\n", b); err != nil {
+		glog.Errorf("Error writing security event. Error: %s", err)
+	}
+}
+
+// PodSecurityHandler serves the pod security posture over HTTP, e.g. /podsecurity[?namespace=default]
+func PodSecurityHandler(w http.ResponseWriter, r *http.Request) {
+	writeJSON(w, PodSecurityReport(r.URL.Query().Get("namespace")))
+}
@@ -0,0 +1,38 @@
+package handler
+
+import (
+	"reflect"
+	"testing"
+
+	apiv1 "github.com/FlorianOtel/client-go/pkg/api/v1"
+	apiv1beta1 "github.com/FlorianOtel/client-go/pkg/apis/extensions/v1beta1"
+)
+
+func TestPSPViolationsDefaults(t *testing.T) {
+	psp := &apiv1beta1.PodSecurityPolicy{Spec: apiv1beta1.PodSecurityPolicySpec{
+		ReadOnlyRootFilesystem: true,
+		RunAsUser: apiv1beta1.RunAsUserStrategyOptions{
+			Rule:   apiv1beta1.RunAsUserStrategyMustRunAs,
+			Ranges: []apiv1beta1.IDRange{{Min: 1000, Max: 2000}},
+		},
+	}}
+	boolPtr := func(b bool) *bool { return &b }
+	uidPtr := func(uid int64) *int64 { return &uid }
+
+	tests := []struct {
+		name     string
+		sc       *apiv1.SecurityContext
+		expected []string
+	}{
+		{"unset -- defaulted by the admission", nil, nil},
+		{"read-only, allowed user", &apiv1.SecurityContext{ReadOnlyRootFilesystem: boolPtr(true), RunAsUser: uidPtr(1500)}, nil},
+		{"writable root filesystem", &apiv1.SecurityContext{ReadOnlyRootFilesystem: boolPtr(false)}, []string{"writable root filesystem (app)"}},
+		{"user outside the ranges", &apiv1.SecurityContext{RunAsUser: uidPtr(0)}, []string{"runAsUser outside the allowed ranges (app)"}},
+	}
+	for _, test := range tests {
+		pod := &apiv1.Pod{Spec: apiv1.PodSpec{Containers: []apiv1.Container{{Name: "app", SecurityContext: test.sc}}}}
+		if violations := pspViolations(psp, pod); !reflect.DeepEqual(violations, test.expected) {
+			t.Errorf("%s: expected %v, got %v", test.name, test.expected, violations)
+		}
+	}
+}
@@ -0,0 +1,31 @@
+package handler
+
+import (
+	"github.com/golang/glog"
+	//
+
+	"github.com/FlorianOtel/client-go/pkg/api"
+	apiv1beta1 "github.com/FlorianOtel/client-go/pkg/apis/extensions/v1beta1"
+)
+
+func PodSecurityPolicyCreated(psp *apiv1beta1.PodSecurityPolicy) error {
+	glog.Info("=====> A podsecuritypolicy got created")
+	JsonPrettyPrint("podsecuritypolicy", psp)
+	return nil
+}
+
+func PodSecurityPolicyDeleted(psp *apiv1beta1.PodSecurityPolicy) error {
+	glog.Info("=====> A podsecuritypolicy got deleted")
+	JsonPrettyPrint("podsecuritypolicy", psp)
+	return nil
+}
+
+// The pod security report is computed on demand -- it picks up the change by itself
+func PodSecurityPolicyUpdated(old, updated *apiv1beta1.PodSecurityPolicy) error {
+	if api.Semantic.DeepEqual(old.Spec, updated.Spec) {
+		return nil
+	}
+	glog.Infof("=====> A podsecuritypolicy got updated: %s", updated.Name)
+	JsonPrettyPrint("podsecuritypolicy", updated)
+	return nil
+}
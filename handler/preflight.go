@@ -0,0 +1,137 @@
+package handler
+
+import (
+	"fmt"
+	"io"
+
+	"github.com/golang/glog"
+	//
+
+	"github.com/FlorianOtel/client-go/kubernetes"
+	authorizationv1beta1 "github.com/FlorianOtel/client-go/pkg/apis/authorization/v1beta1"
+)
+
+// Pre-flight permission check: before starting the controllers, ask the API server (via SelfSubjectAccessReviews) whether we are
+// allowed to "list" and "watch" each of the resources we are about to watch. Without those rights the reflectors just keep logging errors.
+
+// WatchedResource is a resource we list / watch, in a given namespace ("" for all namespaces, or cluster-scoped resources)
+type WatchedResource struct {
+	Group     string // API group. "" for the core API group
+	Resource  string
+	Namespace string
+}
+
+// PreflightVerbs are the verbs needed by a controller
+var PreflightVerbs = []string{"list", "watch"}
+
+// AccessCheck is the result of a SelfSubjectAccessReview for a given resource and verb
+type AccessCheck struct {
+	WatchedResource
+	Verb    string
+	Allowed bool
+	Reason  string
+	Error   error
+}
+
+// CheckAccess issues a SelfSubjectAccessReview for each of the PreflightVerbs on each of the given resources
+func CheckAccess(c *kubernetes.Clientset, resources []WatchedResource) []AccessCheck {
+	var checks []AccessCheck
+
+	for _, res := range resources {
+		for _, verb := range PreflightVerbs {
+			check := AccessCheck{WatchedResource: res, Verb: verb}
+
+			ssar, err := c.Authorization().SelfSubjectAccessReviews().Create(&authorizationv1beta1.SelfSubjectAccessReview{
+				Spec: authorizationv1beta1.SelfSubjectAccessReviewSpec{
+					ResourceAttributes: &authorizationv1beta1.ResourceAttributes{
+						Namespace: res.Namespace,
+						Verb:      verb,
+						Group:     res.Group,
+						Resource:  res.Resource,
+					},
+				},
+			})
+			if err != nil {
+				glog.Errorf("Error issuing SelfSubjectAccessReview for %s %s. Error: %s", verb, ResourceName(res.Group, res.Resource), err)
+				check.Error = err
+			} else {
+				check.Allowed, check.Reason = ssar.Status.Allowed, ssar.Status.Reason
+			}
+			checks = append(checks, check)
+		}
+	}
+
+	return checks
+}
+
+// ResourceName returns the name of a resource qualified with its API group, e.g. "deployments.extensions" -- "pods" for the core API group
+func ResourceName(group, resource string) string {
+	if group == "" {
+		return resource
+	}
+	return resource + "." + group
+}
+
+// DeniedResources returns the resources (by ResourceName) for which any of the PreflightVerbs was denied. Checks that could not be
+// made are not denials -- see UncheckedResources
+func DeniedResources(checks []AccessCheck) map[string]bool {
+	denied := make(map[string]bool)
+	for _, check := range checks {
+		if check.Error == nil && !check.Allowed {
+			denied[ResourceName(check.Group, check.Resource)] = true
+		}
+	}
+	return denied
+}
+
+// UncheckedResources returns the resources (by ResourceName) for which any of the PreflightVerbs could not be checked -- e.g. the
+// SelfSubjectAccessReview API is not available
+func UncheckedResources(checks []AccessCheck) map[string]bool {
+	unchecked := make(map[string]bool)
+	for _, check := range checks {
+		if check.Error != nil {
+			unchecked[ResourceName(check.Group, check.Resource)] = true
+		}
+	}
+	return unchecked
+}
+
+// PrintAccessMatrix prints the result of the pre-flight checks as a matrix: one line per resource, one column per verb
+func PrintAccessMatrix(w io.Writer, checks []AccessCheck) {
+	fmt.Fprintf(w, "%-45s %-20s", "RESOURCE", "NAMESPACE")
+	for _, verb := range PreflightVerbs {
+		fmt.Fprintf(w, " %-10s", verb)
+	}
+	fmt.Fprintf(w, "\n")
+
+	for i := 0; i < len(checks); i += len(PreflightVerbs) {
+		res := checks[i].WatchedResource
+
+		name := ResourceName(res.Group, res.Resource)
+		namespace := res.Namespace
+		if namespace == "" {
+			namespace = "<all>"
+		}
+
+		fmt.Fprintf(w, "%-45s %-20s", name, namespace)
+		var reasons []string
+		for _, check := range checks[i : i+len(PreflightVerbs)] {
+			switch {
+			case check.Error != nil:
+				fmt.Fprintf(w, " %-10s", "ERROR")
+				reasons = append(reasons, fmt.Sprintf("%s: %s", check.Verb, check.Error))
+			case check.Allowed:
+				fmt.Fprintf(w, " %-10s", "granted")
+			default:
+				fmt.Fprintf(w, " %-10s", "DENIED")
+				if check.Reason != "" {
+					reasons = append(reasons, fmt.Sprintf("%s: %s", check.Verb, check.Reason))
+				}
+			}
+		}
+		for _, r := range reasons {
+			fmt.Fprintf(w, " (%s)", r)
+		}
+		fmt.Fprintf(w, "\n")
+	}
+}
@@ -0,0 +1,200 @@
+package handler
+
+import (
+	"encoding/json"
+
+	"github.com/golang/glog"
+	//
+
+	apierrors "github.com/FlorianOtel/client-go/pkg/api/errors"
+	apiv1 "github.com/FlorianOtel/client-go/pkg/api/v1"
+	apiv1beta1 "github.com/FlorianOtel/client-go/pkg/apis/extensions/v1beta1"
+	metav1 "github.com/FlorianOtel/client-go/pkg/apis/meta/v1"
+	"github.com/FlorianOtel/client-go/pkg/labels"
+)
+
+// Baseline NetworkPolicy provisioning: namespaces matching ProvisionSelector get ingress isolation ("DefaultDeny") and the
+// baseline NetworkPolicies (ProvisionPolicies) -- by default, allowing ingress from the namespaces labelled "role=ingress" only.
+//
+// Only namespaces created after the tool started are provisioned -- plus the ones provisioned earlier (marked with the
+// ProvisionedAnnotation), which are reconciled on each restart. Reconciliation is idempotent:
+// - a missing baseline policy is (re-)created
+// - a baseline policy we created, and nobody modified since, is updated to the current template
+// - a baseline policy modified by someone else -- its spec no longer matches the hash in its OwnerAnnotation -- or not created by us, is left alone
+// - an existing isolation annotation on the namespace is never overwritten
+
+// Provisioning modes
+const (
+	ProvisionOff    = "off"
+	ProvisionDryRun = "dry-run"
+	ProvisionOn     = "on"
+)
+
+// OwnerAnnotation marks the NetworkPolicies created by the provisioner. Its value is the hash of the spec as created / last updated
+const OwnerAnnotation = "k8s-client.florianotel.github.com/baseline-spec-hash"
+
+// ProvisionedAnnotation marks the namespaces provisioned with the baseline
+const ProvisionedAnnotation = "k8s-client.florianotel.github.com/baseline-provisioned"
+
+// ProvisionMode is the provisioning mode. One of ProvisionOff, ProvisionDryRun or ProvisionOn
+var ProvisionMode = ProvisionOff
+
+// ProvisionSelector selects the namespaces to provision. Defaults to all namespaces
+var ProvisionSelector = labels.Everything()
+
+// ProvisionPolicies are the baseline NetworkPolicy templates. Their namespace is ignored
+var ProvisionPolicies = []*apiv1beta1.NetworkPolicy{
+	{
+		ObjectMeta: apiv1.ObjectMeta{Name: "baseline-allow-from-ingress"},
+		Spec: apiv1beta1.NetworkPolicySpec{
+			Ingress: []apiv1beta1.NetworkPolicyIngressRule{{
+				From: []apiv1beta1.NetworkPolicyPeer{{
+					NamespaceSelector: &metav1.LabelSelector{MatchLabels: map[string]string{"role": "ingress"}},
+				}},
+			}},
+		},
+	},
+}
+
+// specHash returns the hash of a NetworkPolicy spec. The port protocols are normalized first, as the API server defaults them to TCP
+func specHash(spec apiv1beta1.NetworkPolicySpec) string {
+	tcp := apiv1.ProtocolTCP
+	normalized := apiv1beta1.NetworkPolicySpec{PodSelector: spec.PodSelector}
+	for _, rule := range spec.Ingress {
+		r := apiv1beta1.NetworkPolicyIngressRule{From: rule.From}
+		for _, p := range rule.Ports {
+			if p.Protocol == nil {
+				p.Protocol = &tcp
+			}
+			r.Ports = append(r.Ports, p)
+		}
+		normalized.Ingress = append(normalized.Ingress, r)
+	}
+
+	b, err := json.Marshal(normalized)
+	if err != nil {
+		return ""
+	}
+	return hashValue(b)
+}
+
+// ProvisionNamespace provisions -- or reconciles -- the baseline of a namespace, if it qualifies
+func ProvisionNamespace(ns *apiv1.Namespace) {
+	if ProvisionMode == ProvisionOff || ns.Status.Phase == apiv1.NamespaceTerminating || !ProvisionSelector.Matches(labels.Set(ns.Labels)) {
+		return
+	}
+	_, provisioned := ns.Annotations[ProvisionedAnnotation]
+	if !provisioned && ns.CreationTimestamp.Time.Before(startTime) {
+		return // Pre-existing namespace, never provisioned
+	}
+	if Clientset == nil {
+		glog.Errorf("Cannot provision namespace %s: no client", ns.Name)
+		return
+	}
+
+	for _, template := range ProvisionPolicies {
+		reconcilePolicy(ns.Name, template)
+	}
+	isolateNamespace(ns)
+}
+
+// reconcilePolicy creates / updates the baseline NetworkPolicy of a namespace from its template -- unless it's not ours (anymore)
+func reconcilePolicy(namespace string, template *apiv1beta1.NetworkPolicy) {
+	name := objectName(namespace, template.Name)
+	hash := specHash(template.Spec)
+	client := Clientset.Extensions().NetworkPolicies(namespace)
+
+	existing, err := client.Get(template.Name, metav1.GetOptions{})
+	switch {
+	case apierrors.IsNotFound(err):
+		np := &apiv1beta1.NetworkPolicy{
+			ObjectMeta: apiv1.ObjectMeta{
+				Name:        template.Name,
+				Namespace:   namespace,
+				Labels:      template.Labels,
+				Annotations: map[string]string{OwnerAnnotation: hash},
+			},
+			Spec: template.Spec,
+		}
+		if ProvisionMode == ProvisionDryRun {
+			glog.Infof("[dry-run] Would create baseline networkpolicy %s", name)
+			return
+		}
+		if _, err := client.Create(np); err != nil {
+			glog.Errorf("Error creating baseline networkpolicy %s. Error: %s", name, err)
+			return
+		}
+		glog.Infof("=====> Created baseline networkpolicy %s", name)
+
+	case err != nil:
+		glog.Errorf("Error getting networkpolicy %s. Error: %s", name, err)
+
+	default:
+		owned, ok := existing.Annotations[OwnerAnnotation]
+		switch {
+		case !ok:
+			glog.Warningf("Networkpolicy %s exists but was not created by the baseline provisioner -- leaving it alone", name)
+		case owned != specHash(existing.Spec):
+			glog.Warningf("Baseline networkpolicy %s was modified by someone else -- leaving it alone", name)
+		case owned == hash:
+			glog.V(2).Infof("Baseline networkpolicy %s is up to date", name)
+		default:
+			// Ours, unmodified, but the template changed
+			updated := *existing
+			updated.Annotations = make(map[string]string, len(existing.Annotations))
+			for k, v := range existing.Annotations {
+				updated.Annotations[k] = v
+			}
+			updated.Annotations[OwnerAnnotation] = hash
+			updated.Spec = template.Spec
+			if ProvisionMode == ProvisionDryRun {
+				glog.Infof("[dry-run] Would update baseline networkpolicy %s to the current template", name)
+				return
+			}
+			if _, err := client.Update(&updated); err != nil {
+				glog.Errorf("Error updating baseline networkpolicy %s. Error: %s", name, err)
+				return
+			}
+			glog.Infof("=====> Updated baseline networkpolicy %s to the current template", name)
+		}
+	}
+}
+
+// isolateNamespace enables ingress isolation ("DefaultDeny") on a namespace and marks it as provisioned -- unless it has
+// an isolation annotation already, which is never overwritten
+func isolateNamespace(ns *apiv1.Namespace) {
+	_, hasIsolation := ns.Annotations[NetworkPolicyAnnotation]
+	_, provisioned := ns.Annotations[ProvisionedAnnotation]
+	if hasIsolation && provisioned {
+		return
+	}
+
+	if ProvisionMode == ProvisionDryRun {
+		if !hasIsolation {
+			glog.Infof("[dry-run] Would enable DefaultDeny ingress isolation on namespace %s", ns.Name)
+		}
+		return
+	}
+
+	// Fetch the latest version of the namespace rather than updating the cached one
+	latest, err := Clientset.Core().Namespaces().Get(ns.Name, metav1.GetOptions{})
+	if err != nil {
+		glog.Errorf("Error getting namespace %s. Error: %s", ns.Name, err)
+		return
+	}
+	updated := *latest
+	updated.Annotations = make(map[string]string, len(latest.Annotations)+2)
+	for k, v := range latest.Annotations {
+		updated.Annotations[k] = v
+	}
+	if _, ok := updated.Annotations[NetworkPolicyAnnotation]; !ok {
+		updated.Annotations[NetworkPolicyAnnotation] = `{"ingress":{"isolation":"DefaultDeny"}}`
+	}
+	updated.Annotations[ProvisionedAnnotation] = "true"
+
+	if _, err := Clientset.Core().Namespaces().Update(&updated); err != nil {
+		glog.Errorf("Error enabling ingress isolation on namespace %s. Error: %s", ns.Name, err)
+		return
+	}
+	glog.Infof("=====> Namespace %s provisioned with DefaultDeny ingress isolation", ns.Name)
+}
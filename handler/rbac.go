@@ -0,0 +1,287 @@
+package handler
+
+import (
+	"encoding/json"
+	"fmt"
+	"io"
+	"os"
+	"sort"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/golang/glog"
+	//
+
+	rbacv1alpha1 "github.com/FlorianOtel/client-go/pkg/apis/rbac/v1alpha1"
+)
+
+// Every change to an RBAC object (Role, ClusterRole, RoleBinding, ClusterRoleBinding) produces one security-audit record per
+// granted / revoked rule or subject. The records are written as JSON lines to AuditLog, in addition to the usual (human readable) output
+
+// AuditLog is where the RBAC security-audit records are written. Defaults to stdout
+var AuditLog io.Writer = os.Stdout
+
+var auditMutex sync.Mutex
+
+// AuditRecord is a single security-audit record
+type AuditRecord struct {
+	Time      time.Time `json:"time"`
+	Event     string    `json:"event"` // "created", "updated" or "deleted"
+	Kind      string    `json:"kind"`
+	Namespace string    `json:"namespace,omitempty"`
+	Name      string    `json:"name"`
+	Change    string    `json:"change"` // e.g. "rule added", "verbs removed", "subject added"
+	Detail    string    `json:"detail"`
+	RoleRef   string    `json:"roleRef,omitempty"` // Bindings only
+}
+
+// audit writes an audit record to the AuditLog
+func audit(rec AuditRecord) {
+	rec.Time = time.Now().UTC()
+
+	b, err := json.Marshal(rec)
+	if err != nil {
+		glog.Errorf("Error marshalling audit record %#v. Error: %s", rec, err)
+		return
+	}
+
+	auditMutex.Lock()
+	defer auditMutex.Unlock()
+
+	if _, err := fmt.Fprintf(AuditLog, "%s\n", b); err != nil {
+		glog.Errorf("Error writing audit record. Error: %s", err)
+	}
+}
+
+// ruleString returns a human readable form of a PolicyRule, e.g. "verbs=[get list] apiGroups=[""] resources=[pods]"
+func ruleString(rule rbacv1alpha1.PolicyRule) string {
+	var parts []string
+
+	parts = append(parts, fmt.Sprintf("verbs=%v", rule.Verbs))
+	if len(rule.APIGroups) > 0 {
+		parts = append(parts, fmt.Sprintf("apiGroups=%q", rule.APIGroups))
+	}
+	if len(rule.Resources) > 0 {
+		parts = append(parts, fmt.Sprintf("resources=%v", rule.Resources))
+	}
+	if len(rule.ResourceNames) > 0 {
+		parts = append(parts, fmt.Sprintf("resourceNames=%v", rule.ResourceNames))
+	}
+	if len(rule.NonResourceURLs) > 0 {
+		parts = append(parts, fmt.Sprintf("nonResourceURLs=%v", rule.NonResourceURLs))
+	}
+	return strings.Join(parts, " ")
+}
+
+// subjectString returns a human readable form of a Subject, e.g. "ServiceAccount kube-system/default"
+func subjectString(subject rbacv1alpha1.Subject) string {
+	if subject.Namespace != "" {
+		return fmt.Sprintf("%s %s/%s", subject.Kind, subject.Namespace, subject.Name)
+	}
+	return fmt.Sprintf("%s %s", subject.Kind, subject.Name)
+}
+
+// roleRefString returns a human readable form of a RoleRef, e.g. "ClusterRole admin"
+func roleRefString(ref rbacv1alpha1.RoleRef) string {
+	return fmt.Sprintf("%s %s", ref.Kind, ref.Name)
+}
+
+// diffStrings returns the (sorted) elements that are in "updated" but not in "old", and the other way around
+func diffStrings(old, updated []string) (added, removed []string) {
+	oldSet := make(map[string]bool, len(old))
+	for _, s := range old {
+		oldSet[s] = true
+	}
+	newSet := make(map[string]bool, len(updated))
+	for _, s := range updated {
+		newSet[s] = true
+		if !oldSet[s] {
+			added = append(added, s)
+		}
+	}
+	for _, s := range old {
+		if !newSet[s] {
+			removed = append(removed, s)
+		}
+	}
+	sort.Strings(added)
+	sort.Strings(removed)
+	return added, removed
+}
+
+// ruleChange is a single change of a PolicyRule field (verbs, resources, ...) between two versions of a rule
+type ruleChange struct {
+	change string // e.g. "verbs added"
+	rule   string // The (new) rule the change applies to
+	values []string
+}
+
+// shared returns the number of values two lists have in common
+func shared(a, b []string) int {
+	set := make(map[string]bool, len(a))
+	for _, s := range a {
+		set[s] = true
+	}
+	n := 0
+	for _, s := range b {
+		if set[s] {
+			n++
+			delete(set, s)
+		}
+	}
+	return n
+}
+
+// ruleOverlap tells how much two PolicyRules have in common. Rules sharing no resource (or, for non-resource rules, no URL) are
+// unrelated: 0. Otherwise the number of resources, apiGroups and nonResourceURLs they share
+func ruleOverlap(a, b rbacv1alpha1.PolicyRule) int {
+	resources, urls := shared(a.Resources, b.Resources), shared(a.NonResourceURLs, b.NonResourceURLs)
+	if resources+urls == 0 {
+		return 0
+	}
+	return resources + urls + shared(a.APIGroups, b.APIGroups)
+}
+
+// diffRules compares two sets of PolicyRules. Identical rules are ignored; each remaining old rule is paired with the new rule
+// it overlaps most (see ruleOverlap), and the two are compared field by field (verbs, apiGroups, resources, resourceNames,
+// nonResourceURLs). Unpaired rules are reported as added / removed as a whole.
+func diffRules(old, updated []rbacv1alpha1.PolicyRule) []ruleChange {
+	// Drop the rules present (identically) in both versions
+	unchanged := make(map[string]int)
+	for _, r := range old {
+		unchanged[ruleString(r)]++
+	}
+	var added []rbacv1alpha1.PolicyRule
+	for _, r := range updated {
+		if unchanged[ruleString(r)] > 0 {
+			unchanged[ruleString(r)]--
+			continue
+		}
+		added = append(added, r)
+	}
+	newRules := make(map[string]int)
+	for _, r := range updated {
+		newRules[ruleString(r)]++
+	}
+	var removed []rbacv1alpha1.PolicyRule
+	for _, r := range old {
+		if newRules[ruleString(r)] > 0 {
+			newRules[ruleString(r)]--
+			continue
+		}
+		removed = append(removed, r)
+	}
+
+	var changes []ruleChange
+
+	// Pair the modified rules -- overlapping ones -- and diff them field by field
+	var unpaired []rbacv1alpha1.PolicyRule
+	for _, o := range removed {
+		i, best := -1, 0
+		for j, n := range added {
+			if overlap := ruleOverlap(o, n); overlap > best {
+				i, best = j, overlap
+			}
+		}
+		if i < 0 {
+			unpaired = append(unpaired, o)
+			continue
+		}
+		n := added[i]
+		added = append(added[:i:i], added[i+1:]...)
+
+		fields := []struct {
+			name     string
+			old, new []string
+		}{
+			{"verbs", o.Verbs, n.Verbs},
+			{"apiGroups", o.APIGroups, n.APIGroups},
+			{"resources", o.Resources, n.Resources},
+			{"resourceNames", o.ResourceNames, n.ResourceNames},
+			{"nonResourceURLs", o.NonResourceURLs, n.NonResourceURLs},
+		}
+		for _, f := range fields {
+			plus, minus := diffStrings(f.old, f.new)
+			if len(plus) > 0 {
+				changes = append(changes, ruleChange{f.name + " added", ruleString(n), plus})
+			}
+			if len(minus) > 0 {
+				changes = append(changes, ruleChange{f.name + " removed", ruleString(n), minus})
+			}
+		}
+	}
+	removed = unpaired
+
+	for _, r := range added {
+		changes = append(changes, ruleChange{"rule added", ruleString(r), nil})
+	}
+	for _, r := range removed {
+		changes = append(changes, ruleChange{"rule removed", ruleString(r), nil})
+	}
+	return changes
+}
+
+// reportRules prints and audits the rule changes of a Role / ClusterRole
+func reportRules(event, kind, namespace, name string, old, updated []rbacv1alpha1.PolicyRule) {
+	for _, c := range diffRules(old, updated) {
+		detail := c.rule
+		if c.values != nil {
+			detail = fmt.Sprintf("%v in rule %s", c.values, c.rule)
+		}
+		fmt.Printf("  %s %s: %s %s\n", kind, objectName(namespace, name), c.change, detail)
+		audit(AuditRecord{Event: event, Kind: kind, Namespace: namespace, Name: name, Change: c.change, Detail: detail})
+	}
+}
+
+// reportSubjects prints and audits the subjects added to / removed from a RoleBinding / ClusterRoleBinding
+func reportSubjects(event, kind, namespace, name string, roleRef rbacv1alpha1.RoleRef, old, updated []rbacv1alpha1.Subject) {
+	var oldSubjects, newSubjects []string
+	for _, s := range old {
+		oldSubjects = append(oldSubjects, subjectString(s))
+	}
+	for _, s := range updated {
+		newSubjects = append(newSubjects, subjectString(s))
+	}
+
+	added, removed := diffStrings(oldSubjects, newSubjects)
+	for _, s := range added {
+		fmt.Printf("  %s %s: subject added %s -- granted %s\n", kind, objectName(namespace, name), s, roleRefString(roleRef))
+		audit(AuditRecord{Event: event, Kind: kind, Namespace: namespace, Name: name, Change: "subject added", Detail: s, RoleRef: roleRefString(roleRef)})
+	}
+	for _, s := range removed {
+		fmt.Printf("  %s %s: subject removed %s -- revoked %s\n", kind, objectName(namespace, name), s, roleRefString(roleRef))
+		audit(AuditRecord{Event: event, Kind: kind, Namespace: namespace, Name: name, Change: "subject removed", Detail: s, RoleRef: roleRefString(roleRef)})
+	}
+}
+
+// reportRoleRef prints and audits a change of the role a binding refers to
+func reportRoleRef(kind, namespace, name string, old, updated rbacv1alpha1.RoleRef) {
+	if old == updated {
+		return
+	}
+	detail := fmt.Sprintf("%s -> %s", roleRefString(old), roleRefString(updated))
+	fmt.Printf("  %s %s: roleRef changed %s\n", kind, objectName(namespace, name), detail)
+	audit(AuditRecord{Event: "updated", Kind: kind, Namespace: namespace, Name: name, Change: "roleRef changed", Detail: detail, RoleRef: roleRefString(updated)})
+}
+
+// subjectsEqual tells whether two lists of subjects are the same (disregarding order)
+func subjectsEqual(old, updated []rbacv1alpha1.Subject) bool {
+	var oldSubjects, newSubjects []string
+	for _, s := range old {
+		oldSubjects = append(oldSubjects, subjectString(s))
+	}
+	for _, s := range updated {
+		newSubjects = append(newSubjects, subjectString(s))
+	}
+	added, removed := diffStrings(oldSubjects, newSubjects)
+	return len(added) == 0 && len(removed) == 0
+}
+
+// objectName returns "namespace/name" for namespaced objects, "name" otherwise
+func objectName(namespace, name string) string {
+	if namespace == "" {
+		return name
+	}
+	return namespace + "/" + name
+}
@@ -0,0 +1,82 @@
+package handler
+
+import (
+	"reflect"
+	"testing"
+
+	rbacv1alpha1 "github.com/FlorianOtel/client-go/pkg/apis/rbac/v1alpha1"
+)
+
+func TestDiffRules(t *testing.T) {
+	pods := rbacv1alpha1.PolicyRule{Verbs: []string{"get"}, APIGroups: []string{""}, Resources: []string{"pods"}}
+	podsWrite := rbacv1alpha1.PolicyRule{Verbs: []string{"get", "delete"}, APIGroups: []string{""}, Resources: []string{"pods"}}
+	secrets := rbacv1alpha1.PolicyRule{Verbs: []string{"get"}, APIGroups: []string{""}, Resources: []string{"secrets"}}
+	deployments := rbacv1alpha1.PolicyRule{Verbs: []string{"get"}, APIGroups: []string{"extensions"}, Resources: []string{"deployments"}}
+	podsAndSecrets := rbacv1alpha1.PolicyRule{Verbs: []string{"get"}, APIGroups: []string{""}, Resources: []string{"pods", "secrets"}}
+	podsAndServices := rbacv1alpha1.PolicyRule{Verbs: []string{"get"}, APIGroups: []string{""}, Resources: []string{"pods", "services"}}
+	podsServicesEndpoints := rbacv1alpha1.PolicyRule{Verbs: []string{"get"}, APIGroups: []string{""}, Resources: []string{"pods", "services", "endpoints"}}
+	bothGroupsDeployments := rbacv1alpha1.PolicyRule{Verbs: []string{"get"}, APIGroups: []string{"extensions", "apps"}, Resources: []string{"deployments"}}
+	appsDeployments := rbacv1alpha1.PolicyRule{Verbs: []string{"get"}, APIGroups: []string{"apps"}, Resources: []string{"deployments"}}
+	oneSecret := rbacv1alpha1.PolicyRule{Verbs: []string{"get"}, APIGroups: []string{""}, Resources: []string{"secrets"}, ResourceNames: []string{"db-password"}}
+
+	tests := []struct {
+		name         string
+		old, updated []rbacv1alpha1.PolicyRule
+		expected     []ruleChange
+	}{
+		{"unchanged", []rbacv1alpha1.PolicyRule{pods, secrets}, []rbacv1alpha1.PolicyRule{pods, secrets}, nil},
+		{"reordered", []rbacv1alpha1.PolicyRule{pods, secrets}, []rbacv1alpha1.PolicyRule{secrets, pods}, nil},
+		{"created", nil, []rbacv1alpha1.PolicyRule{pods}, []ruleChange{
+			{"rule added", ruleString(pods), nil},
+		}},
+		{"deleted", []rbacv1alpha1.PolicyRule{pods}, nil, []ruleChange{
+			{"rule removed", ruleString(pods), nil},
+		}},
+		{"verbs added", []rbacv1alpha1.PolicyRule{secrets, pods}, []rbacv1alpha1.PolicyRule{secrets, podsWrite}, []ruleChange{
+			{"verbs added", ruleString(podsWrite), []string{"delete"}},
+		}},
+		{"verbs removed", []rbacv1alpha1.PolicyRule{podsWrite}, []rbacv1alpha1.PolicyRule{pods}, []ruleChange{
+			{"verbs removed", ruleString(pods), []string{"delete"}},
+		}},
+		{"resourceNames removed", []rbacv1alpha1.PolicyRule{oneSecret}, []rbacv1alpha1.PolicyRule{secrets}, []ruleChange{
+			{"resourceNames removed", ruleString(secrets), []string{"db-password"}},
+		}},
+		{"resources added", []rbacv1alpha1.PolicyRule{pods}, []rbacv1alpha1.PolicyRule{podsAndSecrets}, []ruleChange{
+			{"resources added", ruleString(podsAndSecrets), []string{"secrets"}},
+		}},
+		{"resources removed", []rbacv1alpha1.PolicyRule{podsAndSecrets}, []rbacv1alpha1.PolicyRule{secrets}, []ruleChange{
+			{"resources removed", ruleString(secrets), []string{"pods"}},
+		}},
+		{"apiGroups removed", []rbacv1alpha1.PolicyRule{bothGroupsDeployments}, []rbacv1alpha1.PolicyRule{appsDeployments}, []ruleChange{
+			{"apiGroups removed", ruleString(appsDeployments), []string{"extensions"}},
+		}},
+		{"apiGroups replaced", []rbacv1alpha1.PolicyRule{deployments}, []rbacv1alpha1.PolicyRule{appsDeployments}, []ruleChange{
+			{"apiGroups added", ruleString(appsDeployments), []string{"apps"}},
+			{"apiGroups removed", ruleString(appsDeployments), []string{"extensions"}},
+		}},
+		// Paired with the rule it overlaps most
+		{"best overlap", []rbacv1alpha1.PolicyRule{podsAndServices}, []rbacv1alpha1.PolicyRule{pods, podsServicesEndpoints}, []ruleChange{
+			{"resources added", ruleString(podsServicesEndpoints), []string{"endpoints"}},
+			{"rule added", ruleString(pods), nil},
+		}},
+		// Rules sharing no resource are unrelated -- even at the same position, or in the same apiGroup
+		{"resource replaced", []rbacv1alpha1.PolicyRule{pods}, []rbacv1alpha1.PolicyRule{secrets}, []ruleChange{
+			{"rule added", ruleString(secrets), nil},
+			{"rule removed", ruleString(pods), nil},
+		}},
+		{"rule replaced", []rbacv1alpha1.PolicyRule{pods}, []rbacv1alpha1.PolicyRule{deployments}, []ruleChange{
+			{"rule added", ruleString(deployments), nil},
+			{"rule removed", ruleString(pods), nil},
+		}},
+		{"modified and replaced", []rbacv1alpha1.PolicyRule{secrets, pods}, []rbacv1alpha1.PolicyRule{podsWrite, deployments}, []ruleChange{
+			{"verbs added", ruleString(podsWrite), []string{"delete"}},
+			{"rule added", ruleString(deployments), nil},
+			{"rule removed", ruleString(secrets), nil},
+		}},
+	}
+	for _, test := range tests {
+		if got := diffRules(test.old, test.updated); !reflect.DeepEqual(got, test.expected) {
+			t.Errorf("%s: diffRules = %+v, expected %+v", test.name, got, test.expected)
+		}
+	}
+}
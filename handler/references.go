@@ -0,0 +1,112 @@
+package handler
+
+import (
+	"fmt"
+	"sort"
+
+	"github.com/golang/glog"
+	//
+
+	apiv1 "github.com/FlorianOtel/client-go/pkg/api/v1"
+)
+
+// PodReference describes how a Pod uses a given ConfigMap or Secret
+type PodReference struct {
+	Pod       string // Pod name
+	Container string // Container name. Empty for Pod-level references (volumes, imagePullSecrets)
+	Via       string // How it's referenced: "env", "volume" or "imagePullSecret"
+	Detail    string // Env var / volume name, and key if any
+}
+
+// Pods can reference ConfigMaps / Secrets via:
+// - (Init) container env vars ("valueFrom" -- configMapKeyRef / secretKeyRef)
+// - Volumes
+// - imagePullSecrets (Secrets only)
+// N.B. "envFrom" is not available in the vendored (v1.5) API, so it is not taken into account
+
+// PodsReferencingConfigMap returns all the cached Pods that reference a given ConfigMap
+func PodsReferencingConfigMap(namespace, name string) []PodReference {
+	return podReferences(namespace, func(pod *apiv1.Pod) []PodReference {
+		var refs []PodReference
+		for _, c := range podContainers(pod) {
+			for _, env := range c.Env {
+				if env.ValueFrom != nil && env.ValueFrom.ConfigMapKeyRef != nil && env.ValueFrom.ConfigMapKeyRef.Name == name {
+					refs = append(refs, PodReference{pod.Name, c.Name, "env", fmt.Sprintf("%s (key %q)", env.Name, env.ValueFrom.ConfigMapKeyRef.Key)})
+				}
+			}
+		}
+		for _, vol := range pod.Spec.Volumes {
+			if vol.ConfigMap != nil && vol.ConfigMap.Name == name {
+				refs = append(refs, PodReference{pod.Name, "", "volume", vol.Name})
+			}
+		}
+		return refs
+	})
+}
+
+// PodsReferencingSecret returns all the cached Pods that reference a given Secret
+func PodsReferencingSecret(namespace, name string) []PodReference {
+	return podReferences(namespace, func(pod *apiv1.Pod) []PodReference {
+		var refs []PodReference
+		for _, c := range podContainers(pod) {
+			for _, env := range c.Env {
+				if env.ValueFrom != nil && env.ValueFrom.SecretKeyRef != nil && env.ValueFrom.SecretKeyRef.Name == name {
+					refs = append(refs, PodReference{pod.Name, c.Name, "env", fmt.Sprintf("%s (key %q)", env.Name, env.ValueFrom.SecretKeyRef.Key)})
+				}
+			}
+		}
+		for _, vol := range pod.Spec.Volumes {
+			if vol.Secret != nil && vol.Secret.SecretName == name {
+				refs = append(refs, PodReference{pod.Name, "", "volume", vol.Name})
+			}
+		}
+		for _, ips := range pod.Spec.ImagePullSecrets {
+			if ips.Name == name {
+				refs = append(refs, PodReference{pod.Name, "", "imagePullSecret", ips.Name})
+			}
+		}
+		return refs
+	})
+}
+
+// podReferences applies "match" to all cached Pods in a namespace and collects the results, sorted by Pod name
+func podReferences(namespace string, match func(pod *apiv1.Pod) []PodReference) []PodReference {
+	var refs []PodReference
+
+	if PodStore == nil {
+		return refs
+	}
+
+	for _, obj := range PodStore.List() {
+		pod := obj.(*apiv1.Pod)
+		if pod.Namespace != namespace {
+			continue
+		}
+		refs = append(refs, match(pod)...)
+	}
+
+	sort.SliceStable(refs, func(i, j int) bool { return refs[i].Pod < refs[j].Pod })
+	return refs
+}
+
+// printReferences prints which Pods are affected by a change of a ConfigMap / Secret
+func printReferences(resource, namespace, name string, refs []PodReference) {
+	if PodStore == nil {
+		glog.Infof("Pods are not being watched -- cannot tell which Pods reference %s %s/%s", resource, namespace, name)
+		return
+	}
+
+	if len(refs) == 0 {
+		fmt.Printf(" ######## %s %s/%s is not referenced by any Pod ########\n", resource, namespace, name)
+		return
+	}
+
+	fmt.Printf(" ######## %s %s/%s is referenced by ########\n", resource, namespace, name)
+	for _, ref := range refs {
+		if ref.Container != "" {
+			fmt.Printf("  pod %s, container %s, via %s: %s\n", ref.Pod, ref.Container, ref.Via, ref.Detail)
+		} else {
+			fmt.Printf("  pod %s, via %s: %s\n", ref.Pod, ref.Via, ref.Detail)
+		}
+	}
+}
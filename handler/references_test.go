@@ -0,0 +1,49 @@
+package handler
+
+import (
+	"reflect"
+	"testing"
+
+	apiv1 "github.com/FlorianOtel/client-go/pkg/api/v1"
+	"github.com/FlorianOtel/client-go/tools/cache"
+)
+
+// withPods sets up the Pod store with the given Pods for the duration of a test
+func withPods(t *testing.T, pods ...*apiv1.Pod) {
+	saved := PodStore
+	t.Cleanup(func() { PodStore = saved })
+
+	PodStore = cache.NewStore(cache.MetaNamespaceKeyFunc)
+	for _, pod := range pods {
+		if err := PodStore.Add(pod); err != nil {
+			t.Fatal(err)
+		}
+	}
+}
+
+func TestPodsReferencingInitContainers(t *testing.T) {
+	secretEnv := apiv1.EnvVar{Name: "PASSWORD", ValueFrom: &apiv1.EnvVarSource{SecretKeyRef: &apiv1.SecretKeySelector{
+		LocalObjectReference: apiv1.LocalObjectReference{Name: "db"}, Key: "password"}}}
+	configEnv := apiv1.EnvVar{Name: "MODE", ValueFrom: &apiv1.EnvVarSource{ConfigMapKeyRef: &apiv1.ConfigMapKeySelector{
+		LocalObjectReference: apiv1.LocalObjectReference{Name: "settings"}, Key: "mode"}}}
+
+	withPods(t, &apiv1.Pod{
+		ObjectMeta: apiv1.ObjectMeta{Namespace: "default", Name: "web"},
+		Spec: apiv1.PodSpec{
+			InitContainers: []apiv1.Container{{Name: "migrate", Env: []apiv1.EnvVar{secretEnv, configEnv}}},
+			Containers:     []apiv1.Container{{Name: "app", Env: []apiv1.EnvVar{secretEnv}}},
+		},
+	})
+
+	expected := []PodReference{
+		{"web", "migrate", "env", `PASSWORD (key "password")`},
+		{"web", "app", "env", `PASSWORD (key "password")`},
+	}
+	if refs := PodsReferencingSecret("default", "db"); !reflect.DeepEqual(refs, expected) {
+		t.Errorf("PodsReferencingSecret = %+v, expected %+v", refs, expected)
+	}
+	expected = []PodReference{{"web", "migrate", "env", `MODE (key "mode")`}}
+	if refs := PodsReferencingConfigMap("default", "settings"); !reflect.DeepEqual(refs, expected) {
+		t.Errorf("PodsReferencingConfigMap = %+v, expected %+v", refs, expected)
+	}
+}
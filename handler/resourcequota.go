@@ -0,0 +1,51 @@
+package handler
+
+import (
+	"os"
+
+	"github.com/golang/glog"
+	//
+
+	apiv1 "github.com/FlorianOtel/client-go/pkg/api/v1"
+)
+
+func ResourceQuotaCreated(quota *apiv1.ResourceQuota) error {
+	glog.Info("=====> A resourcequota got created")
+	JsonPrettyPrint("resourcequota", quota)
+	PrintQuotaUsages(os.Stdout, quotaUsage(quota))
+	return nil
+}
+
+func ResourceQuotaDeleted(quota *apiv1.ResourceQuota) error {
+	glog.Info("=====> A resourcequota got deleted")
+	JsonPrettyPrint("resourcequota", quota)
+	return nil
+}
+
+// Report the usage when it changes -- and warn when a resource crosses the QuotaThreshold
+func ResourceQuotaUpdated(old, updated *apiv1.ResourceQuota) error {
+	oldUsages, newUsages := quotaUsage(old), quotaUsage(updated)
+
+	changed := len(oldUsages) != len(newUsages)
+	for i := 0; !changed && i < len(newUsages); i++ {
+		changed = oldUsages[i] != newUsages[i]
+	}
+	if !changed {
+		return nil
+	}
+
+	glog.Infof("=====> A resourcequota got updated: %s/%s", updated.Namespace, updated.Name)
+	PrintQuotaUsages(os.Stdout, newUsages)
+
+	// Newly over the threshold
+	over := make(map[string]bool)
+	for _, u := range oldUsages {
+		over[u.Resource] = u.OverThreshold
+	}
+	for _, u := range newUsages {
+		if u.OverThreshold && !over[u.Resource] {
+			glog.Warningf("Namespace %s: usage of %s is above %.0f%% of resourcequota %s (used %s of %s)", u.Namespace, u.Resource, QuotaThreshold*100, u.Quota, u.Used, u.Hard)
+		}
+	}
+	return nil
+}
@@ -0,0 +1,36 @@
+package handler
+
+import (
+	"github.com/golang/glog"
+	//
+
+	rbacv1alpha1 "github.com/FlorianOtel/client-go/pkg/apis/rbac/v1alpha1"
+)
+
+func RoleCreated(role *rbacv1alpha1.Role) error {
+	glog.Info("=====> A role got created")
+	JsonPrettyPrint("role", role)
+	// The Roles listed at startup already existed: only the ones created while we run are audited
+	if role.CreationTimestamp.Time.Before(startTime) {
+		return nil
+	}
+	reportRules("created", "Role", role.Namespace, role.Name, nil, role.Rules)
+	return nil
+}
+
+func RoleDeleted(role *rbacv1alpha1.Role) error {
+	glog.Info("=====> A role got deleted")
+	JsonPrettyPrint("role", role)
+	reportRules("deleted", "Role", role.Namespace, role.Name, role.Rules, nil)
+	return nil
+}
+
+// Report the rule-level changes: rules added / removed, and verbs, apiGroups, resources etc added to / removed from existing rules
+func RoleUpdated(old, updated *rbacv1alpha1.Role) error {
+	if len(diffRules(old.Rules, updated.Rules)) == 0 {
+		return nil
+	}
+	glog.Infof("=====> A role got updated: %s", objectName(updated.Namespace, updated.Name))
+	reportRules("updated", "Role", updated.Namespace, updated.Name, old.Rules, updated.Rules)
+	return nil
+}
@@ -0,0 +1,37 @@
+package handler
+
+import (
+	"github.com/golang/glog"
+	//
+
+	rbacv1alpha1 "github.com/FlorianOtel/client-go/pkg/apis/rbac/v1alpha1"
+)
+
+func RoleBindingCreated(rolebinding *rbacv1alpha1.RoleBinding) error {
+	glog.Info("=====> A rolebinding got created")
+	JsonPrettyPrint("rolebinding", rolebinding)
+	// The RoleBindings listed at startup already existed: only the ones created while we run are audited
+	if rolebinding.CreationTimestamp.Time.Before(startTime) {
+		return nil
+	}
+	reportSubjects("created", "RoleBinding", rolebinding.Namespace, rolebinding.Name, rolebinding.RoleRef, nil, rolebinding.Subjects)
+	return nil
+}
+
+func RoleBindingDeleted(rolebinding *rbacv1alpha1.RoleBinding) error {
+	glog.Info("=====> A rolebinding got deleted")
+	JsonPrettyPrint("rolebinding", rolebinding)
+	reportSubjects("deleted", "RoleBinding", rolebinding.Namespace, rolebinding.Name, rolebinding.RoleRef, rolebinding.Subjects, nil)
+	return nil
+}
+
+// Report who was added to / removed from the binding (and any change of the role it refers to)
+func RoleBindingUpdated(old, updated *rbacv1alpha1.RoleBinding) error {
+	if old.RoleRef == updated.RoleRef && subjectsEqual(old.Subjects, updated.Subjects) {
+		return nil
+	}
+	glog.Infof("=====> A rolebinding got updated: %s", objectName(updated.Namespace, updated.Name))
+	reportRoleRef("RoleBinding", updated.Namespace, updated.Name, old.RoleRef, updated.RoleRef)
+	reportSubjects("updated", "RoleBinding", updated.Namespace, updated.Name, updated.RoleRef, old.Subjects, updated.Subjects)
+	return nil
+}
@@ -0,0 +1,813 @@
+package handler
+
+import (
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"hash/fnv"
+	"net/http"
+	"net/url"
+	"os"
+	"os/exec"
+	"regexp"
+	"sort"
+	"strconv"
+	"strings"
+	"sync"
+	"text/template"
+	"time"
+
+	"github.com/golang/glog"
+	//
+
+	"github.com/FlorianOtel/client-go/pkg/api"
+	"github.com/FlorianOtel/client-go/pkg/api/meta"
+	apiv1 "github.com/FlorianOtel/client-go/pkg/api/v1"
+	metav1 "github.com/FlorianOtel/client-go/pkg/apis/meta/v1"
+	"github.com/FlorianOtel/client-go/pkg/fields"
+	"github.com/FlorianOtel/client-go/pkg/labels"
+	"github.com/FlorianOtel/client-go/pkg/selection"
+	"github.com/FlorianOtel/client-go/pkg/util/yaml"
+	"github.com/FlorianOtel/client-go/rest"
+	"github.com/FlorianOtel/client-go/tools/cache"
+)
+
+// Rules: declarative actions on the watch events of all the watched resources, from a (YAML or JSON) rules file:
+//
+//   rules:
+//   - name: label-new-web-pods
+//     kind: Pod                            # Empty: all kinds. ThirdPartyResource instances by their kind, e.g. CronTab
+//     events: [created, updated, deleted]  # Empty: all events
+//     namespace: default                   # Empty: all namespaces
+//     labelSelector: "app=web,tier!=db"
+//     fieldSelector: "spec.nodeName=node-1,status.phase!=Running"
+//     expressions:                         # All must hold
+//     - "spec.containers[*].image =~ ^nginx:"
+//     - "spec.replicas >= 3"
+//     - "metadata.annotations"             # Exists. "!path": does not exist
+//     dryRun: true                         # Only log what the actions would do
+//     actions:
+//     - log: "{{.Kind}} {{.Namespace}}/{{.Name}} got {{.Event}} on {{.Object.spec.nodeName}}"
+//     - webhook: https://hooks.example.com/k8s     # POSTs the RuleMatch as JSON
+//     - exec: ["/usr/local/bin/notify", "--pod"]   # The object (JSON) on stdin; RULE, EVENT, KIND, NAMESPACE and NAME in the environment
+//     - annotate: {reviewed: "false"}
+//     - label: {team: web}
+//     - event: {type: Warning, reason: Unreviewed, message: "{{.Name}} needs a review"}
+//
+// Paths are dotted JSON field paths over the object, with list indexes -- "[0]", or "[*]" for any element. A field selector
+// requirement or an expression holds if it holds for any of the values of its path. Expression operators: ==, !=, <, <=, >, >=
+// (numeric when both sides are numbers), =~ (regular expression) and "in" (e.g. "status.phase in (Pending,Failed)"). Log and
+// Event messages are Go templates over the RuleMatch.
+//
+// The actions run on worker goroutines, not in the watchers -- an "exec" may take up to 30s, a webhook 5s. The actions on an object
+// run in the order of its events; when the queues are full, the matches are dropped (and counted as failures).
+//
+// "created" only matches objects created while we run, unless the rule sets "existing: true" -- the objects listed at startup are
+// seen as created too. Annotations and labels are only patched when they differ, and the Events emitted by the "event" actions
+// are not passed to the rules, so that rules don't loop. Secret values are never passed on -- only the key names, sizes and
+// hashes. The rules file is reloaded when it changes; a file that fails to load leaves the current rules in place.
+
+// Rule events
+const (
+	RuleCreated = "created"
+	RuleUpdated = "updated"
+	RuleDeleted = "deleted"
+)
+
+// ruleEventComponent is the source component of the Events emitted by the "event" actions
+const ruleEventComponent = "k8s-client"
+
+// ruleExecTimeout is how long the commands of the "exec" actions may run
+const ruleExecTimeout = 30 * time.Second
+
+// RulesDryRun forces all the rules to dry-run
+var RulesDryRun bool
+
+// RulesFile is the content of a rules file
+type RulesFile struct {
+	Rules []Rule `json:"rules"`
+}
+
+// Rule maps watch events to actions
+type Rule struct {
+	Name          string       `json:"name"`
+	Kind          string       `json:"kind,omitempty"`
+	Events        []string     `json:"events,omitempty"`
+	Existing      bool         `json:"existing,omitempty"`
+	Namespace     string       `json:"namespace,omitempty"`
+	LabelSelector string       `json:"labelSelector,omitempty"`
+	FieldSelector string       `json:"fieldSelector,omitempty"`
+	Expressions   []string     `json:"expressions,omitempty"`
+	DryRun        bool         `json:"dryRun,omitempty"`
+	Actions       []RuleAction `json:"actions"`
+}
+
+// RuleAction is an action of a rule. Exactly one of its fields is set
+type RuleAction struct {
+	Log      string            `json:"log,omitempty"`
+	Webhook  string            `json:"webhook,omitempty"`
+	Exec     []string          `json:"exec,omitempty"`
+	Annotate map[string]string `json:"annotate,omitempty"`
+	Label    map[string]string `json:"label,omitempty"`
+	Event    *RuleEventAction  `json:"event,omitempty"`
+
+	message *template.Template // Log / Event message
+}
+
+// RuleEventAction emits a Kubernetes Event about the object
+type RuleEventAction struct {
+	Type    string `json:"type,omitempty"` // "Normal" (default) or "Warning"
+	Reason  string `json:"reason"`
+	Message string `json:"message,omitempty"`
+}
+
+// RuleMatch is a watch event matched by a rule. It is what the message templates are executed on, and what the webhooks get
+type RuleMatch struct {
+	Time      time.Time              `json:"time"`
+	Rule      string                 `json:"rule"`
+	Event     string                 `json:"event"`
+	Kind      string                 `json:"kind"`
+	Namespace string                 `json:"namespace,omitempty"`
+	Name      string                 `json:"name"`
+	Object    map[string]interface{} `json:"object"`
+}
+
+// RuleStatus is a loaded rule, with its match and action failure counts
+type RuleStatus struct {
+	Rule
+	DryRun   bool `json:"dryRun"` // The rule's own setting, or RulesDryRun
+	Matches  int  `json:"matches"`
+	Failures int  `json:"failures"`
+}
+
+// ruleExpression is a parsed rule expression
+type ruleExpression struct {
+	path   string
+	op     string // "exists", "!exists", "==", "!=", "<", "<=", ">", ">=", "=~" or "in"
+	value  string
+	values []string       // "in"
+	regexp *regexp.Regexp // "=~"
+}
+
+// compiledRule is a loaded rule
+type compiledRule struct {
+	Rule
+	events      map[string]bool
+	labels      labels.Selector
+	fields      fields.Selector
+	expressions []ruleExpression
+}
+
+// ruleTarget is how the objects of a kind are patched
+type ruleTarget struct {
+	client   rest.Interface
+	resource string
+}
+
+// Expression operators -- but "in", parsed apart
+var ruleOperators = []string{"==", "!=", "<", "<=", ">", ">=", "=~"}
+
+var (
+	rulesMutex   sync.RWMutex
+	activeRules  []*compiledRule
+	rulesModTime time.Time
+	ruleStats    = make(map[string]*RuleStatus)
+	ruleTargets  = make(map[string]ruleTarget) // By kind
+)
+
+// registerRuleTarget records how the objects of a kind are patched, for the "annotate" and "label" actions
+func registerRuleTarget(kind string, client cache.Getter, resource string) {
+	if c, ok := client.(rest.Interface); ok {
+		rulesMutex.Lock()
+		ruleTargets[kind] = ruleTarget{c, resource}
+		rulesMutex.Unlock()
+	}
+}
+
+// parseRuleExpression parses an expression: "path", "!path" or "path <operator> value"
+func parseRuleExpression(expr string) (ruleExpression, error) {
+	parts := strings.SplitN(strings.TrimSpace(expr), " ", 3)
+	if len(parts) == 1 {
+		if strings.HasPrefix(parts[0], "!") {
+			return ruleExpression{path: parts[0][1:], op: "!exists"}, nil
+		}
+		return ruleExpression{path: parts[0], op: "exists"}, nil
+	}
+	if len(parts) != 3 {
+		return ruleExpression{}, fmt.Errorf("invalid expression %q. Expected: path, !path or \"path <operator> value\"", expr)
+	}
+
+	e := ruleExpression{path: parts[0], op: parts[1], value: strings.TrimSpace(parts[2])}
+	switch e.op {
+	case "=~":
+		re, err := regexp.Compile(e.value)
+		if err != nil {
+			return e, fmt.Errorf("invalid expression %q: %s", expr, err)
+		}
+		e.regexp = re
+	case "in":
+		for _, v := range strings.Split(strings.TrimSuffix(strings.TrimPrefix(e.value, "("), ")"), ",") {
+			e.values = append(e.values, strings.TrimSpace(v))
+		}
+	default:
+		valid := false
+		for _, op := range ruleOperators {
+			valid = valid || op == e.op
+		}
+		if !valid {
+			return e, fmt.Errorf("invalid expression %q: unknown operator %q. Expected one of: %s", expr, e.op, strings.Join(append(ruleOperators, "in"), ", "))
+		}
+	}
+	return e, nil
+}
+
+// compileRule validates a rule, and parses its selectors, expressions and templates
+func compileRule(r Rule) (*compiledRule, error) {
+	if r.Name == "" {
+		return nil, fmt.Errorf("rule without a name")
+	}
+	c := &compiledRule{Rule: r, events: make(map[string]bool), labels: labels.Everything(), fields: fields.Everything()}
+
+	for _, ev := range r.Events {
+		switch ev {
+		case RuleCreated, RuleUpdated, RuleDeleted:
+			c.events[ev] = true
+		default:
+			return nil, fmt.Errorf("rule %q: invalid event %q. Expected one of: %s, %s, %s", r.Name, ev, RuleCreated, RuleUpdated, RuleDeleted)
+		}
+	}
+
+	var err error
+	if r.LabelSelector != "" {
+		if c.labels, err = labels.Parse(r.LabelSelector); err != nil {
+			return nil, fmt.Errorf("rule %q: invalid label selector: %s", r.Name, err)
+		}
+	}
+	if r.FieldSelector != "" {
+		if c.fields, err = fields.ParseSelector(r.FieldSelector); err != nil {
+			return nil, fmt.Errorf("rule %q: invalid field selector: %s", r.Name, err)
+		}
+	}
+	for _, expr := range r.Expressions {
+		e, err := parseRuleExpression(expr)
+		if err != nil {
+			return nil, fmt.Errorf("rule %q: %s", r.Name, err)
+		}
+		c.expressions = append(c.expressions, e)
+	}
+
+	if len(r.Actions) == 0 {
+		return nil, fmt.Errorf("rule %q: no actions", r.Name)
+	}
+	for i := range c.Actions {
+		a := &c.Actions[i]
+		set := 0
+		for _, isSet := range []bool{a.Log != "", a.Webhook != "", len(a.Exec) > 0, len(a.Annotate) > 0, len(a.Label) > 0, a.Event != nil} {
+			if isSet {
+				set++
+			}
+		}
+		if set != 1 {
+			return nil, fmt.Errorf("rule %q: action #%d: expected exactly one of: log, webhook, exec, annotate, label, event", r.Name, i+1)
+		}
+
+		message := a.Log
+		if a.Event != nil {
+			switch a.Event.Type {
+			case "":
+				a.Event.Type = apiv1.EventTypeNormal
+			case apiv1.EventTypeNormal, apiv1.EventTypeWarning:
+			default:
+				return nil, fmt.Errorf("rule %q: action #%d: invalid Event type %q. Expected %s or %s", r.Name, i+1, a.Event.Type, apiv1.EventTypeNormal, apiv1.EventTypeWarning)
+			}
+			if a.Event.Reason == "" {
+				return nil, fmt.Errorf("rule %q: action #%d: Event without a reason", r.Name, i+1)
+			}
+			message = a.Event.Message
+		}
+		if a.Webhook != "" {
+			if u, err := url.Parse(a.Webhook); err != nil || u.Scheme == "" || u.Host == "" {
+				return nil, fmt.Errorf("rule %q: action #%d: invalid webhook URL %q", r.Name, i+1, a.Webhook)
+			}
+		}
+		if a.message, err = template.New(r.Name).Option("missingkey=zero").Parse(message); err != nil {
+			return nil, fmt.Errorf("rule %q: action #%d: invalid message template: %s", r.Name, i+1, err)
+		}
+	}
+	return c, nil
+}
+
+// LoadRules loads a rules file, and replaces the current rules with its rules
+func LoadRules(path string) error {
+	f, err := os.Open(path)
+	if err != nil {
+		return err
+	}
+	defer f.Close()
+	info, err := f.Stat()
+	if err != nil {
+		return err
+	}
+
+	var file RulesFile
+	if err := yaml.NewYAMLOrJSONDecoder(f, 4096).Decode(&file); err != nil {
+		return fmt.Errorf("%s: %s", path, err)
+	}
+	var compiled []*compiledRule
+	names := make(map[string]bool)
+	for _, r := range file.Rules {
+		c, err := compileRule(r)
+		if err != nil {
+			return fmt.Errorf("%s: %s", path, err)
+		}
+		if names[r.Name] {
+			return fmt.Errorf("%s: duplicate rule %q", path, r.Name)
+		}
+		names[r.Name] = true
+		compiled = append(compiled, c)
+	}
+
+	rulesMutex.Lock()
+	defer rulesMutex.Unlock()
+	activeRules = compiled
+	rulesModTime = info.ModTime()
+	stats := make(map[string]*RuleStatus)
+	for _, c := range compiled {
+		s := &RuleStatus{Rule: c.Rule, DryRun: c.DryRun || RulesDryRun}
+		if previous, ok := ruleStats[c.Name]; ok {
+			s.Matches, s.Failures = previous.Matches, previous.Failures
+		}
+		stats[c.Name] = s
+	}
+	ruleStats = stats
+	glog.Infof("Loaded %d rule(s) from %s", len(compiled), path)
+	return nil
+}
+
+// ReloadRules reloads the rules file if it changed since it was last loaded. Meant to be run periodically (e.g. via wait.Until)
+func ReloadRules(path string) {
+	info, err := os.Stat(path)
+	if err != nil {
+		glog.Errorf("Error checking the rules file %s. Error: %s", path, err)
+		return
+	}
+	rulesMutex.RLock()
+	unchanged := info.ModTime().Equal(rulesModTime)
+	rulesMutex.RUnlock()
+	if unchanged {
+		return
+	}
+	if err := LoadRules(path); err != nil {
+		glog.Errorf("Error reloading the rules -- keeping the current ones. Error: %s", err)
+		rulesMutex.Lock()
+		rulesModTime = info.ModTime() // Don't retry until the file changes again
+		rulesMutex.Unlock()
+	}
+}
+
+// lookupPath returns the values at a path of a decoded JSON object -- several ones with "[*]" list indexes
+func lookupPath(object interface{}, path string) []interface{} {
+	values := []interface{}{object}
+	for _, segment := range strings.Split(path, ".") {
+		key, indexes := segment, []string(nil)
+		if i := strings.Index(segment, "["); i >= 0 {
+			key = segment[:i]
+			indexes = strings.Split(strings.TrimSuffix(segment[i+1:], "]"), "][")
+		}
+
+		var next []interface{}
+		for _, v := range values {
+			if key != "" {
+				m, ok := v.(map[string]interface{})
+				if !ok {
+					continue
+				}
+				if v, ok = m[key]; !ok {
+					continue
+				}
+			}
+			current := []interface{}{v}
+			for _, index := range indexes {
+				var indexed []interface{}
+				for _, c := range current {
+					list, ok := c.([]interface{})
+					if !ok {
+						continue
+					}
+					if index == "*" {
+						indexed = append(indexed, list...)
+					} else if n, err := strconv.Atoi(index); err == nil && n >= 0 && n < len(list) {
+						indexed = append(indexed, list[n])
+					}
+				}
+				current = indexed
+			}
+			next = append(next, current...)
+		}
+		values = next
+	}
+	return values
+}
+
+// scalarString returns the string form of a decoded JSON value, for comparisons
+func scalarString(v interface{}) string {
+	switch v := v.(type) {
+	case nil:
+		return ""
+	case string:
+		return v
+	case float64:
+		return strconv.FormatFloat(v, 'f', -1, 64)
+	case bool:
+		return strconv.FormatBool(v)
+	default:
+		b, _ := json.Marshal(v)
+		return string(b)
+	}
+}
+
+// holds tells whether an expression holds for a value
+func (e ruleExpression) holds(v interface{}) bool {
+	s := scalarString(v)
+	switch e.op {
+	case "==":
+		return s == e.value
+	case "!=":
+		return s != e.value
+	case "=~":
+		return e.regexp.MatchString(s)
+	case "in":
+		for _, value := range e.values {
+			if s == value {
+				return true
+			}
+		}
+		return false
+	}
+
+	// Ordering: numeric if both sides are numbers
+	cmp := strings.Compare(s, e.value)
+	if a, err := strconv.ParseFloat(s, 64); err == nil {
+		if b, err := strconv.ParseFloat(e.value, 64); err == nil {
+			switch {
+			case a < b:
+				cmp = -1
+			case a > b:
+				cmp = 1
+			default:
+				cmp = 0
+			}
+		}
+	}
+	switch e.op {
+	case "<":
+		return cmp < 0
+	case "<=":
+		return cmp <= 0
+	case ">":
+		return cmp > 0
+	case ">=":
+		return cmp >= 0
+	}
+	return false
+}
+
+// matchesObject tells whether the field selector and the expressions of a rule hold for an object
+func (c *compiledRule) matchesObject(object map[string]interface{}) bool {
+	for _, req := range c.fields.Requirements() {
+		values := lookupPath(object, req.Field)
+		if len(values) == 0 {
+			values = []interface{}{nil} // A missing field is the empty string
+		}
+		equal := false
+		for _, v := range values {
+			equal = equal || scalarString(v) == req.Value
+		}
+		if equal == (req.Operator == selection.NotEquals) {
+			return false
+		}
+	}
+
+	for _, e := range c.expressions {
+		values := lookupPath(object, e.path)
+		switch e.op {
+		case "exists":
+			if len(values) == 0 {
+				return false
+			}
+		case "!exists":
+			if len(values) > 0 {
+				return false
+			}
+		default:
+			holds := false
+			for _, v := range values {
+				holds = holds || e.holds(v)
+			}
+			if !holds {
+				return false
+			}
+		}
+	}
+	return true
+}
+
+// ruleObject returns the decoded JSON form of an object, as passed to the rules. Secret values are redacted
+func ruleObject(obj interface{}) (map[string]interface{}, error) {
+	if secret, ok := obj.(*apiv1.Secret); ok {
+		return toJSONMap(map[string]interface{}{"metadata": RedactSecretMeta(secret), "type": secret.Type, "data": RedactSecret(secret)})
+	}
+	return toJSONMap(obj)
+}
+
+// applyRules runs the actions of the rules matching a watch event
+func applyRules(kind, event string, obj interface{}) {
+	rulesMutex.RLock()
+	rules := activeRules
+	rulesMutex.RUnlock()
+	if len(rules) == 0 {
+		return
+	}
+
+	if tombstone, ok := obj.(cache.DeletedFinalStateUnknown); ok {
+		obj = tombstone.Obj
+	}
+	// Not our own Events: a rule with an "event" action would match the Events it emits, and emit Events without end
+	if ev, ok := obj.(*apiv1.Event); ok && ev.Source.Component == ruleEventComponent {
+		return
+	}
+	accessor, err := meta.Accessor(obj)
+	if err != nil {
+		glog.Errorf("Error applying the rules to a %s. Error: %s", kind, err)
+		return
+	}
+	existing := event == RuleCreated && accessor.GetCreationTimestamp().Time.Before(startTime)
+
+	var object map[string]interface{}
+	for _, c := range rules {
+		if (c.Kind != "" && c.Kind != kind) || (len(c.events) > 0 && !c.events[event]) || (existing && !c.Existing) ||
+			(c.Namespace != "" && c.Namespace != accessor.GetNamespace()) || !c.labels.Matches(labels.Set(accessor.GetLabels())) {
+			continue
+		}
+		if object == nil {
+			if object, err = ruleObject(obj); err != nil {
+				glog.Errorf("Error marshalling %s %s. Error: %s", kind, objectName(accessor.GetNamespace(), accessor.GetName()), err)
+				return
+			}
+		}
+		if !c.matchesObject(object) {
+			continue
+		}
+
+		match := RuleMatch{Time: time.Now().UTC(), Rule: c.Name, Event: event, Kind: kind, Namespace: accessor.GetNamespace(), Name: accessor.GetName(), Object: object}
+		glog.Infof("Rule %q matched: %s %s got %s", c.Name, kind, objectName(match.Namespace, match.Name), event)
+		failures := 0
+		if !queueRuleJob(ruleJob{c, match, accessor}) {
+			glog.Errorf("Rule %q: action queue full, dropping the actions on %s %s", c.Name, kind, objectName(match.Namespace, match.Name))
+			failures = len(c.Actions)
+		}
+
+		rulesMutex.Lock()
+		if s, ok := ruleStats[c.Name]; ok {
+			s.Matches++
+			s.Failures += failures
+		}
+		rulesMutex.Unlock()
+	}
+}
+
+// ruleJob is a rule match whose actions are to be run
+type ruleJob struct {
+	rule     *compiledRule
+	match    RuleMatch
+	accessor meta.Object
+}
+
+// ruleWorkers is the number of goroutines running the actions, each with a queue of up to ruleQueueSize matches
+const (
+	ruleWorkers   = 4
+	ruleQueueSize = 1000
+)
+
+var (
+	ruleQueuesOnce sync.Once
+	ruleQueues     []chan ruleJob
+)
+
+// startRuleWorkers starts the goroutines running the actions of the rule matches of their queue
+func startRuleWorkers() {
+	for i := 0; i < ruleWorkers; i++ {
+		q := make(chan ruleJob, ruleQueueSize)
+		ruleQueues = append(ruleQueues, q)
+		go func(q chan ruleJob) {
+			for job := range q {
+				runRuleActions(job)
+			}
+		}(q)
+	}
+}
+
+// queueRuleJob queues a rule match for its worker -- always the same for an object, so that the actions on an object run in the
+// order of its events. Returns false if the queue is full
+func queueRuleJob(job ruleJob) bool {
+	ruleQueuesOnce.Do(startRuleWorkers)
+	h := fnv.New32a()
+	h.Write([]byte(job.match.Kind + " " + objectName(job.match.Namespace, job.match.Name)))
+	select {
+	case ruleQueues[h.Sum32()%uint32(len(ruleQueues))] <- job:
+		return true
+	default:
+		return false
+	}
+}
+
+// runRuleActions runs the actions of a rule match, in order
+func runRuleActions(job ruleJob) {
+	c, match := job.rule, job.match
+	failures := 0
+	for _, a := range c.Actions {
+		if err := runRuleAction(c, a, match, job.accessor); err != nil {
+			glog.Errorf("Rule %q: error running action on %s %s. Error: %s", c.Name, match.Kind, objectName(match.Namespace, match.Name), err)
+			failures++
+		}
+	}
+	if failures == 0 {
+		return
+	}
+	rulesMutex.Lock()
+	if s, ok := ruleStats[c.Name]; ok {
+		s.Failures += failures
+	}
+	rulesMutex.Unlock()
+}
+
+// runRuleAction runs an action of a rule -- or only logs what it would do, in dry-run
+func runRuleAction(c *compiledRule, a RuleAction, match RuleMatch, accessor meta.Object) error {
+	dryRun := c.DryRun || RulesDryRun
+	what := match.Kind + " " + objectName(match.Namespace, match.Name)
+
+	var message bytes.Buffer
+	if err := a.message.Execute(&message, match); err != nil {
+		return fmt.Errorf("error executing the message template: %s", err)
+	}
+
+	switch {
+	case a.Log != "":
+		if dryRun {
+			glog.Infof("[dry-run] Rule %q would log: %s", c.Name, message.String())
+			return nil
+		}
+		glog.Infof("Rule %q: %s", c.Name, message.String())
+		return nil
+
+	case a.Webhook != "":
+		if dryRun {
+			glog.Infof("[dry-run] Rule %q would POST %s to %s", c.Name, what, a.Webhook)
+			return nil
+		}
+		return postRuleMatch(a.Webhook, match)
+
+	case len(a.Exec) > 0:
+		if dryRun {
+			glog.Infof("[dry-run] Rule %q would run %q on %s", c.Name, a.Exec, what)
+			return nil
+		}
+		return execRuleCommand(a.Exec, match)
+
+	case len(a.Annotate) > 0, len(a.Label) > 0:
+		field, values, current := "annotations", a.Annotate, accessor.GetAnnotations()
+		if len(a.Label) > 0 {
+			field, values, current = "labels", a.Label, accessor.GetLabels()
+		}
+		if match.Event == RuleDeleted {
+			glog.Infof("Rule %q: not patching the %s of %s -- it got deleted", c.Name, field, what)
+			return nil
+		}
+		changed := make(map[string]string)
+		for k, v := range values {
+			if existing, ok := current[k]; !ok || existing != v {
+				changed[k] = v
+			}
+		}
+		if len(changed) == 0 {
+			return nil // Already set -- don't trigger another update
+		}
+		if dryRun {
+			glog.Infof("[dry-run] Rule %q would set the %s %v on %s", c.Name, field, changed, what)
+			return nil
+		}
+		return patchRuleObject(match, field, changed)
+
+	case a.Event != nil:
+		if dryRun {
+			glog.Infof("[dry-run] Rule %q would emit a %s Event %q about %s: %s", c.Name, a.Event.Type, a.Event.Reason, what, message.String())
+			return nil
+		}
+		return emitRuleEvent(a.Event, message.String(), match, accessor)
+	}
+	return nil
+}
+
+// ruleHTTPClient POSTs the rule matches to the webhooks
+var ruleHTTPClient = &http.Client{Timeout: 5 * time.Second}
+
+// postRuleMatch POSTs a rule match (as JSON) to a webhook
+func postRuleMatch(url string, match RuleMatch) error {
+	b, err := json.Marshal(match)
+	if err != nil {
+		return err
+	}
+	resp, err := ruleHTTPClient.Post(url, "application/json", bytes.NewReader(b))
+	if err != nil {
+		return err
+	}
+	defer resp.Body.Close()
+	if resp.StatusCode >= 300 {
+		return fmt.Errorf("unexpected HTTP status %s from %s", resp.Status, url)
+	}
+	return nil
+}
+
+// execRuleCommand runs a command with the object (JSON) on its stdin. It is killed after ruleExecTimeout
+func execRuleCommand(command []string, match RuleMatch) error {
+	b, err := json.Marshal(match.Object)
+	if err != nil {
+		return err
+	}
+	var output bytes.Buffer
+	cmd := exec.Command(command[0], command[1:]...)
+	cmd.Stdin = bytes.NewReader(b)
+	cmd.Stdout = &output
+	cmd.Stderr = &output
+	cmd.Env = append(os.Environ(), "RULE="+match.Rule, "EVENT="+match.Event, "KIND="+match.Kind, "NAMESPACE="+match.Namespace, "NAME="+match.Name)
+
+	if err := cmd.Start(); err != nil {
+		return err
+	}
+	timer := time.AfterFunc(ruleExecTimeout, func() { cmd.Process.Kill() })
+	err = cmd.Wait()
+	timer.Stop()
+	if err != nil {
+		return fmt.Errorf("%q: %s. Output: %s", command, err, strings.TrimSpace(output.String()))
+	}
+	glog.V(2).Infof("Rule %q: %q output: %s", match.Rule, command, strings.TrimSpace(output.String()))
+	return nil
+}
+
+// patchRuleObject sets annotations or labels ("field") on the object of a rule match, with a JSON merge patch
+func patchRuleObject(match RuleMatch, field string, values map[string]string) error {
+	rulesMutex.RLock()
+	target, ok := ruleTargets[match.Kind]
+	rulesMutex.RUnlock()
+	if !ok {
+		return fmt.Errorf("cannot patch %s objects", match.Kind)
+	}
+	patch, err := json.Marshal(map[string]interface{}{"metadata": map[string]interface{}{field: values}})
+	if err != nil {
+		return err
+	}
+	return target.client.Patch(api.MergePatchType).Namespace(match.Namespace).Resource(target.resource).Name(match.Name).Body(patch).Do().Error()
+}
+
+// emitRuleEvent creates a Kubernetes Event about the object of a rule match
+func emitRuleEvent(action *RuleEventAction, message string, match RuleMatch, accessor meta.Object) error {
+	if Clientset == nil {
+		return fmt.Errorf("no client")
+	}
+	namespace := match.Namespace
+	if namespace == "" {
+		namespace = apiv1.NamespaceDefault // Events about cluster-scoped objects
+	}
+	now := metav1.Now()
+	ev := &apiv1.Event{
+		ObjectMeta: apiv1.ObjectMeta{GenerateName: match.Name + ".", Namespace: namespace},
+		InvolvedObject: apiv1.ObjectReference{
+			Kind:            match.Kind,
+			Namespace:       match.Namespace,
+			Name:            match.Name,
+			UID:             accessor.GetUID(),
+			ResourceVersion: accessor.GetResourceVersion(),
+		},
+		Reason:         action.Reason,
+		Message:        message,
+		Type:           action.Type,
+		Source:         apiv1.EventSource{Component: ruleEventComponent},
+		FirstTimestamp: now,
+		LastTimestamp:  now,
+		Count:          1,
+	}
+	_, err := Clientset.Core().Events(namespace).Create(ev)
+	return err
+}
+
+// RulesHandler serves the loaded rules, with their match and failure counts, over HTTP: /rules
+func RulesHandler(w http.ResponseWriter, r *http.Request) {
+	rulesMutex.RLock()
+	defer rulesMutex.RUnlock()
+	status := []RuleStatus{}
+	for _, s := range ruleStats {
+		status = append(status, *s)
+	}
+	sort.Slice(status, func(i, j int) bool { return status[i].Name < status[j].Name })
+	writeJSON(w, status)
+}
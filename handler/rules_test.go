@@ -0,0 +1,178 @@
+package handler
+
+import (
+	"encoding/json"
+	"reflect"
+	"strings"
+	"testing"
+
+	apiv1 "github.com/FlorianOtel/client-go/pkg/api/v1"
+	metav1 "github.com/FlorianOtel/client-go/pkg/apis/meta/v1"
+)
+
+func TestParseRuleExpression(t *testing.T) {
+	tests := []struct {
+		expr     string
+		expected ruleExpression // Without the regexp
+		invalid  bool
+	}{
+		{expr: "metadata.annotations", expected: ruleExpression{path: "metadata.annotations", op: "exists"}},
+		{expr: "!metadata.annotations", expected: ruleExpression{path: "metadata.annotations", op: "!exists"}},
+		{expr: "  spec.replicas >= 3 ", expected: ruleExpression{path: "spec.replicas", op: ">=", value: "3"}},
+		{expr: "spec.nodeName != node-1", expected: ruleExpression{path: "spec.nodeName", op: "!=", value: "node-1"}},
+		{expr: "metadata.annotations.note == two words", expected: ruleExpression{path: "metadata.annotations.note", op: "==", value: "two words"}},
+		{expr: "spec.containers[*].image =~ ^nginx:", expected: ruleExpression{path: "spec.containers[*].image", op: "=~", value: "^nginx:"}},
+		{expr: "status.phase in (Pending, Failed)", expected: ruleExpression{path: "status.phase", op: "in", value: "(Pending, Failed)", values: []string{"Pending", "Failed"}}},
+		{expr: "status.phase in Running", expected: ruleExpression{path: "status.phase", op: "in", value: "Running", values: []string{"Running"}}},
+		{expr: "spec.replicas >=", invalid: true},
+		{expr: "spec.replicas => 3", invalid: true},
+		{expr: "spec.containers[*].image =~ ^nginx:(", invalid: true},
+	}
+	for _, test := range tests {
+		e, err := parseRuleExpression(test.expr)
+		if test.invalid {
+			if err == nil {
+				t.Errorf("parseRuleExpression(%q): expected an error", test.expr)
+			}
+			continue
+		}
+		if err != nil {
+			t.Errorf("parseRuleExpression(%q): unexpected error: %s", test.expr, err)
+			continue
+		}
+		if (e.op == "=~") != (e.regexp != nil) {
+			t.Errorf("parseRuleExpression(%q): regexp %v", test.expr, e.regexp)
+		}
+		e.regexp = nil
+		if !reflect.DeepEqual(e, test.expected) {
+			t.Errorf("parseRuleExpression(%q) = %+v, expected %+v", test.expr, e, test.expected)
+		}
+	}
+}
+
+func TestLookupPath(t *testing.T) {
+	var object map[string]interface{}
+	if err := json.Unmarshal([]byte(`{
+		"metadata": {"name": "web", "labels": {"app": "web"}},
+		"spec": {
+			"replicas": 3,
+			"containers": [{"name": "nginx", "image": "nginx:1.11", "ports": [{"containerPort": 80}, {"containerPort": 443}]}, {"name": "sidecar", "image": "envoy"}],
+			"matrix": [[1, 2], [3]]
+		}
+	}`), &object); err != nil {
+		t.Fatal(err)
+	}
+
+	tests := []struct {
+		path     string
+		expected []interface{}
+	}{
+		{"metadata.name", []interface{}{"web"}},
+		{"spec.replicas", []interface{}{float64(3)}},
+		{"metadata.labels", []interface{}{map[string]interface{}{"app": "web"}}},
+		{"spec.containers[0].image", []interface{}{"nginx:1.11"}},
+		{"spec.containers[*].image", []interface{}{"nginx:1.11", "envoy"}},
+		{"spec.containers[*].ports[*].containerPort", []interface{}{float64(80), float64(443)}},
+		{"spec.matrix[*][0]", []interface{}{float64(1), float64(3)}},
+		{"spec.matrix[0][1]", []interface{}{float64(2)}},
+		// Missing
+		{"metadata.namespace", nil},
+		{"spec.containers[2].image", nil},
+		{"spec.containers[-1].image", nil},
+		{"spec.containers[x].image", nil},
+		{"metadata.name.first", nil},
+		{"spec.replicas[0]", nil},
+	}
+	for _, test := range tests {
+		if got := lookupPath(object, test.path); !reflect.DeepEqual(got, test.expected) {
+			t.Errorf("lookupPath(%q) = %#v, expected %#v", test.path, got, test.expected)
+		}
+	}
+}
+
+func TestRuleExpressionHolds(t *testing.T) {
+	tests := []struct {
+		expr     string
+		value    interface{}
+		expected bool
+	}{
+		{"p == Running", "Running", true},
+		{"p == Running", "Pending", false},
+		{"p == 3", float64(3), true},
+		{"p == true", true, true},
+		{"p != Running", "Pending", true},
+		{"p != Running", "Running", false},
+		{"p != Running", nil, true}, // A null is the empty string
+		// Numeric ordering when both sides are numbers, lexicographic otherwise
+		{"p > 9", float64(10), true},
+		{"p > 9", "10", true},
+		{"p >= 3", float64(3), true},
+		{"p < 2.5", float64(2), true},
+		{"p <= 2.5", float64(3), false},
+		{"p > a", "b", true},
+		{"p < 9", "10a", true},
+		{"p =~ ^nginx:", "nginx:1.11", true},
+		{"p =~ ^nginx:", "my/nginx:1.11", false},
+		{"p in (Pending,Failed)", "Failed", true},
+		{"p in (Pending,Failed)", "Running", false},
+	}
+	for _, test := range tests {
+		e, err := parseRuleExpression(test.expr)
+		if err != nil {
+			t.Errorf("parseRuleExpression(%q): unexpected error: %s", test.expr, err)
+			continue
+		}
+		if holds := e.holds(test.value); holds != test.expected {
+			t.Errorf("%q holds for %#v: %v, expected %v", test.expr, test.value, holds, test.expected)
+		}
+	}
+}
+
+func TestRuleObjectRedactsSecrets(t *testing.T) {
+	object, err := ruleObject(appliedSecret())
+	if err != nil {
+		t.Fatal(err)
+	}
+	b, err := json.Marshal(object)
+	if err != nil {
+		t.Fatal(err)
+	}
+	for _, leak := range []string{"c2VjcmV0", LastAppliedConfigAnnotation} {
+		if strings.Contains(string(b), leak) {
+			t.Errorf("ruleObject: the object holds %q: %s", leak, b)
+		}
+	}
+	if values := lookupPath(object, "metadata.annotations.owner"); !reflect.DeepEqual(values, []interface{}{"team"}) {
+		t.Errorf("ruleObject: annotation owner = %v, expected team", values)
+	}
+}
+
+func TestApplyRulesSkipsOwnEvents(t *testing.T) {
+	// A rule on all kinds, emitting an Event
+	c, err := compileRule(Rule{Name: "flag-everything", DryRun: true, Actions: []RuleAction{{Event: &RuleEventAction{Reason: "Flagged"}}}})
+	if err != nil {
+		t.Fatal(err)
+	}
+	rulesMutex.Lock()
+	savedRules, savedStats := activeRules, ruleStats
+	activeRules, ruleStats = []*compiledRule{c}, map[string]*RuleStatus{c.Name: {Rule: c.Rule}}
+	rulesMutex.Unlock()
+	t.Cleanup(func() {
+		rulesMutex.Lock()
+		activeRules, ruleStats = savedRules, savedStats
+		rulesMutex.Unlock()
+	})
+
+	now := metav1.Now()
+	own := &apiv1.Event{ObjectMeta: apiv1.ObjectMeta{Namespace: "default", Name: "web.1", CreationTimestamp: now}, Source: apiv1.EventSource{Component: ruleEventComponent}}
+	other := &apiv1.Event{ObjectMeta: apiv1.ObjectMeta{Namespace: "default", Name: "web.2", CreationTimestamp: now}, Source: apiv1.EventSource{Component: "kubelet"}}
+	applyRules("Event", RuleCreated, own)
+	applyRules("Event", RuleCreated, other)
+
+	rulesMutex.RLock()
+	matches := ruleStats[c.Name].Matches
+	rulesMutex.RUnlock()
+	if matches != 1 {
+		t.Errorf("rule %q: %d match(es), expected 1 -- only the Event not emitted by the rules", c.Name, matches)
+	}
+}
@@ -0,0 +1,110 @@
+package handler
+
+import (
+	"crypto/sha256"
+	"encoding/hex"
+	"fmt"
+	"sort"
+
+	"github.com/golang/glog"
+	//
+
+	apiv1 "github.com/FlorianOtel/client-go/pkg/api/v1"
+)
+
+// Secret data is NEVER printed. All we report about a Secret key is its name, its size and the SHA-256 of its value. The
+// metadata is redacted too: "kubectl apply" records the whole manifest -- data included -- in an annotation.
+
+// SecretKeyInfo is the redacted form of a Secret data entry
+type SecretKeyInfo struct {
+	Key    string `json:"key"`
+	Size   int    `json:"size"`
+	SHA256 string `json:"sha256"`
+}
+
+// RedactSecret returns the redacted form of the Secret data (sorted by key), plus its type
+func RedactSecret(secret *apiv1.Secret) map[string]interface{} {
+	keys := []SecretKeyInfo{}
+
+	for k, v := range secret.Data {
+		keys = append(keys, SecretKeyInfo{Key: k, Size: len(v), SHA256: hashValue(v)})
+	}
+	sort.Slice(keys, func(i, j int) bool { return keys[i].Key < keys[j].Key })
+
+	return map[string]interface{}{
+		"type": secret.Type,
+		"data": keys,
+	}
+}
+
+// LastAppliedConfigAnnotation is set by "kubectl apply" to the whole manifest it applied -- for a Secret, its data included
+const LastAppliedConfigAnnotation = "kubectl.kubernetes.io/last-applied-configuration"
+
+// RedactSecretMeta returns a copy of the Secret metadata without the annotations that may hold the Secret data
+func RedactSecretMeta(secret *apiv1.Secret) apiv1.ObjectMeta {
+	meta := secret.ObjectMeta
+	if _, ok := meta.Annotations[LastAppliedConfigAnnotation]; ok {
+		meta.Annotations = make(map[string]string, len(secret.Annotations))
+		for k, v := range secret.Annotations {
+			if k != LastAppliedConfigAnnotation {
+				meta.Annotations[k] = v
+			}
+		}
+	}
+	return meta
+}
+
+// hashValue returns the hex-encoded SHA-256 of a value
+func hashValue(v []byte) string {
+	sum := sha256.Sum256(v)
+	return hex.EncodeToString(sum[:])
+}
+
+// secretHashes maps each key of the Secret to the SHA-256 of its value
+func secretHashes(secret *apiv1.Secret) map[string]string {
+	hashes := make(map[string]string, len(secret.Data))
+	for k, v := range secret.Data {
+		hashes[k] = hashValue(v)
+	}
+	return hashes
+}
+
+func SecretCreated(secret *apiv1.Secret) error {
+	glog.Info("=====> A secret got created")
+	JsonPrettyPrint("secret", secret)
+	printReferences("secret", secret.Namespace, secret.Name, PodsReferencingSecret(secret.Namespace, secret.Name))
+	return nil
+}
+
+func SecretDeleted(secret *apiv1.Secret) error {
+	glog.Info("=====> A secret got deleted")
+	JsonPrettyPrint("secret", secret)
+	printReferences("secret", secret.Namespace, secret.Name, PodsReferencingSecret(secret.Namespace, secret.Name))
+	return nil
+}
+
+// Report which keys were added, removed or changed (based on the value hashes) -- and which Pods are affected by the change
+func SecretUpdated(old, updated *apiv1.Secret) error {
+	oldHashes, newHashes := secretHashes(old), secretHashes(updated)
+	added, removed, changed := diffKeys(oldHashes, newHashes)
+
+	// Periodic resyncs / metadata-only updates
+	if len(added)+len(removed)+len(changed) == 0 {
+		return nil
+	}
+
+	glog.Infof("=====> A secret got updated: %s/%s", updated.Namespace, updated.Name)
+
+	for _, k := range added {
+		fmt.Printf("  key %q added (size %d, sha256 %s)\n", k, len(updated.Data[k]), newHashes[k])
+	}
+	for _, k := range removed {
+		fmt.Printf("  key %q removed\n", k)
+	}
+	for _, k := range changed {
+		fmt.Printf("  key %q changed (size %d -> %d, sha256 %s -> %s)\n", k, len(old.Data[k]), len(updated.Data[k]), oldHashes[k], newHashes[k])
+	}
+
+	printReferences("secret", updated.Namespace, updated.Name, PodsReferencingSecret(updated.Namespace, updated.Name))
+	return nil
+}
@@ -0,0 +1,33 @@
+package handler
+
+import (
+	"reflect"
+	"testing"
+
+	apiv1 "github.com/FlorianOtel/client-go/pkg/api/v1"
+)
+
+// appliedSecret returns a Secret created with "kubectl apply": its data is in the last-applied-configuration annotation too
+func appliedSecret() *apiv1.Secret {
+	return &apiv1.Secret{
+		ObjectMeta: apiv1.ObjectMeta{Namespace: "default", Name: "db", Annotations: map[string]string{
+			LastAppliedConfigAnnotation: `{"apiVersion":"v1","kind":"Secret","data":{"password":"c2VjcmV0"}}`,
+			"owner":                     "team",
+		}},
+		Data: map[string][]byte{"password": []byte("secret")},
+	}
+}
+
+func TestRedactSecretMeta(t *testing.T) {
+	secret := appliedSecret()
+	meta := RedactSecretMeta(secret)
+	if expected := map[string]string{"owner": "team"}; !reflect.DeepEqual(meta.Annotations, expected) {
+		t.Errorf("RedactSecretMeta: annotations %v, expected %v", meta.Annotations, expected)
+	}
+	if _, ok := secret.Annotations[LastAppliedConfigAnnotation]; !ok {
+		t.Errorf("RedactSecretMeta modified the Secret")
+	}
+	if meta.Name != "db" || meta.Namespace != "default" {
+		t.Errorf("RedactSecretMeta: %s/%s, expected default/db", meta.Namespace, meta.Name)
+	}
+}
@@ -4,6 +4,7 @@ import (
 	"github.com/golang/glog"
 	//
 
+	"github.com/FlorianOtel/client-go/pkg/api"
 	apiv1 "github.com/FlorianOtel/client-go/pkg/api/v1"
 	// "github.com/FlorianOtel/client-go/pkg/util/wait"
 )
@@ -11,16 +12,25 @@ import (
 func ServiceCreated(service *apiv1.Service) error {
 	glog.Info("=====> A service got created")
 	JsonPrettyPrint("service", service)
+	servicesChanged()
 	return nil
 }
 
 func ServiceDeleted(service *apiv1.Service) error {
 	glog.Info("=====> A service got deleted")
 	JsonPrettyPrint("service", service)
+	forgetService(service)
+	servicesChanged()
 	return nil
 }
 
-// Still TBD if / when / how to use  -- stub so far
+// Spec changes: re-run the health checks
 func ServiceUpdated(old, updated *apiv1.Service) error {
+	if api.Semantic.DeepEqual(old.Spec, updated.Spec) {
+		return nil
+	}
+	glog.Infof("=====> A service got updated: %s", objectName(updated.Namespace, updated.Name))
+	JsonPrettyPrint("service", updated)
+	servicesChanged()
 	return nil
 }
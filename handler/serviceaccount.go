@@ -0,0 +1,263 @@
+package handler
+
+import (
+	"fmt"
+	"io"
+	"net/http"
+	"os"
+	"reflect"
+	"sort"
+
+	"github.com/golang/glog"
+	//
+
+	apiv1 "github.com/FlorianOtel/client-go/pkg/api/v1"
+)
+
+// ServiceAccount inventory: each ServiceAccount is correlated with its token Secrets, its imagePullSecrets and the Pods running as it.
+// From that we flag:
+// - unused ServiceAccounts (no Pod runs as them). The "default" ServiceAccount is never flagged, it always exists
+// - Pods running as "default" in namespaces where a dedicated ServiceAccount exists
+// - token Secrets without an owning ServiceAccount (their "kubernetes.io/service-account.name" annotation points to no -- or another -- account)
+
+// DefaultServiceAccount is the ServiceAccount Pods run as when they don't specify one
+const DefaultServiceAccount = "default"
+
+// ServiceAccountInfo is the inventory entry of a ServiceAccount
+type ServiceAccountInfo struct {
+	Namespace        string   `json:"namespace"`
+	Name             string   `json:"name"`
+	TokenSecrets     []string `json:"tokenSecrets"`
+	ImagePullSecrets []string `json:"imagePullSecrets"`
+	Pods             []string `json:"pods"`
+}
+
+// ServiceAccountFinding is something worth a look in the least-privilege cleanup
+type ServiceAccountFinding struct {
+	Type      string `json:"type"` // "unused-serviceaccount", "default-serviceaccount" or "orphaned-token"
+	Namespace string `json:"namespace"`
+	Name      string `json:"name"` // The ServiceAccount, Pod or Secret name, depending on the type
+	Detail    string `json:"detail"`
+}
+
+// podServiceAccount returns the ServiceAccount a Pod runs as
+func podServiceAccount(pod *apiv1.Pod) string {
+	if pod.Spec.ServiceAccountName == "" {
+		return DefaultServiceAccount
+	}
+	return pod.Spec.ServiceAccountName
+}
+
+// tokenOwner returns the ServiceAccount a token Secret belongs to. Empty if the Secret is not a ServiceAccount token
+func tokenOwner(secret *apiv1.Secret) string {
+	if secret.Type != apiv1.SecretTypeServiceAccountToken {
+		return ""
+	}
+	return secret.Annotations[apiv1.ServiceAccountNameKey]
+}
+
+// ServiceAccountInventory returns the inventory of the cached ServiceAccounts in a namespace -- or in all namespaces if "namespace" is empty
+func ServiceAccountInventory(namespace string) []ServiceAccountInfo {
+	var inventory []ServiceAccountInfo
+
+	if ServiceAccountStore == nil {
+		return inventory
+	}
+
+	for _, obj := range ServiceAccountStore.List() {
+		sa := obj.(*apiv1.ServiceAccount)
+		if namespace != "" && sa.Namespace != namespace {
+			continue
+		}
+		inventory = append(inventory, serviceAccountInfo(sa))
+	}
+
+	sort.Slice(inventory, func(i, j int) bool {
+		if inventory[i].Namespace != inventory[j].Namespace {
+			return inventory[i].Namespace < inventory[j].Namespace
+		}
+		return inventory[i].Name < inventory[j].Name
+	})
+	return inventory
+}
+
+// serviceAccountInfo correlates a ServiceAccount with its token Secrets -- both the ones it lists and the (cached) ones annotated
+// as belonging to it --, its imagePullSecrets and the (cached) Pods running as it
+func serviceAccountInfo(sa *apiv1.ServiceAccount) ServiceAccountInfo {
+	info := ServiceAccountInfo{Namespace: sa.Namespace, Name: sa.Name, TokenSecrets: []string{}, ImagePullSecrets: []string{}, Pods: []string{}}
+
+	tokens := make(map[string]bool)
+	for _, ref := range sa.Secrets {
+		tokens[ref.Name] = true
+	}
+	if SecretStore != nil {
+		for _, obj := range SecretStore.List() {
+			secret := obj.(*apiv1.Secret)
+			if secret.Namespace == sa.Namespace && tokenOwner(secret) == sa.Name {
+				tokens[secret.Name] = true
+			}
+		}
+	}
+	for name := range tokens {
+		info.TokenSecrets = append(info.TokenSecrets, name)
+	}
+	sort.Strings(info.TokenSecrets)
+
+	for _, ref := range sa.ImagePullSecrets {
+		info.ImagePullSecrets = append(info.ImagePullSecrets, ref.Name)
+	}
+
+	if PodStore != nil {
+		for _, obj := range PodStore.List() {
+			pod := obj.(*apiv1.Pod)
+			if pod.Namespace == sa.Namespace && podServiceAccount(pod) == sa.Name {
+				info.Pods = append(info.Pods, pod.Name)
+			}
+		}
+	}
+	sort.Strings(info.Pods)
+
+	return info
+}
+
+// ServiceAccountFindings returns the findings for a namespace -- or for all namespaces if "namespace" is empty.
+// N.B. Only as good as the caches: Pods and Secrets are only correlated if they are watched (in the same namespaces)
+func ServiceAccountFindings(namespace string) []ServiceAccountFinding {
+	var findings []ServiceAccountFinding
+
+	if ServiceAccountStore == nil {
+		return findings
+	}
+
+	accounts := make(map[string]*apiv1.ServiceAccount) // "namespace/name" -> ServiceAccount
+	dedicated := make(map[string][]string)             // namespace -> its non-default ServiceAccounts
+
+	for _, obj := range ServiceAccountStore.List() {
+		sa := obj.(*apiv1.ServiceAccount)
+		accounts[objectName(sa.Namespace, sa.Name)] = sa
+		if namespace != "" && sa.Namespace != namespace {
+			continue
+		}
+		if sa.Name != DefaultServiceAccount {
+			dedicated[sa.Namespace] = append(dedicated[sa.Namespace], sa.Name)
+		}
+	}
+
+	for _, info := range ServiceAccountInventory(namespace) {
+		if info.Name != DefaultServiceAccount && len(info.Pods) == 0 && PodStore != nil {
+			findings = append(findings, ServiceAccountFinding{"unused-serviceaccount", info.Namespace, info.Name,
+				fmt.Sprintf("no pod runs as it (%d token secret(s))", len(info.TokenSecrets))})
+		}
+	}
+
+	if PodStore != nil {
+		for _, obj := range PodStore.List() {
+			pod := obj.(*apiv1.Pod)
+			if namespace != "" && pod.Namespace != namespace {
+				continue
+			}
+			if podServiceAccount(pod) == DefaultServiceAccount && len(dedicated[pod.Namespace]) > 0 {
+				sort.Strings(dedicated[pod.Namespace])
+				findings = append(findings, ServiceAccountFinding{"default-serviceaccount", pod.Namespace, pod.Name,
+					fmt.Sprintf("runs as %q, but the namespace has dedicated service account(s) %v", DefaultServiceAccount, dedicated[pod.Namespace])})
+			}
+		}
+	}
+
+	if SecretStore != nil {
+		for _, obj := range SecretStore.List() {
+			secret := obj.(*apiv1.Secret)
+			if namespace != "" && secret.Namespace != namespace {
+				continue
+			}
+			if detail := orphanedToken(secret, accounts); detail != "" {
+				findings = append(findings, ServiceAccountFinding{"orphaned-token", secret.Namespace, secret.Name, detail})
+			}
+		}
+	}
+
+	sort.SliceStable(findings, func(i, j int) bool {
+		if findings[i].Type != findings[j].Type {
+			return findings[i].Type < findings[j].Type
+		}
+		if findings[i].Namespace != findings[j].Namespace {
+			return findings[i].Namespace < findings[j].Namespace
+		}
+		return findings[i].Name < findings[j].Name
+	})
+	return findings
+}
+
+// orphanedToken tells why a token Secret has no owning ServiceAccount. Empty if it's not a token Secret, or if it has an owner
+func orphanedToken(secret *apiv1.Secret, accounts map[string]*apiv1.ServiceAccount) string {
+	if secret.Type != apiv1.SecretTypeServiceAccountToken {
+		return ""
+	}
+	owner := tokenOwner(secret)
+	if owner == "" {
+		return fmt.Sprintf("no %s annotation", apiv1.ServiceAccountNameKey)
+	}
+	sa, ok := accounts[objectName(secret.Namespace, owner)]
+	if !ok {
+		return fmt.Sprintf("service account %q does not exist", owner)
+	}
+	// Same name, but a re-created account: the token belongs to its predecessor
+	if uid := secret.Annotations[apiv1.ServiceAccountUIDKey]; uid != "" && uid != string(sa.UID) {
+		return fmt.Sprintf("belongs to a previous incarnation of service account %q (uid %s)", owner, uid)
+	}
+	return ""
+}
+
+// PrintServiceAccountInfo prints the inventory entry of a ServiceAccount
+func PrintServiceAccountInfo(w io.Writer, info ServiceAccountInfo) {
+	fmt.Fprintf(w, "  serviceaccount %s: token secrets %v, imagePullSecrets %v, pods %v\n",
+		objectName(info.Namespace, info.Name), info.TokenSecrets, info.ImagePullSecrets, info.Pods)
+}
+
+// PrintServiceAccountFindings prints the findings, one per line
+func PrintServiceAccountFindings(w io.Writer, findings []ServiceAccountFinding) {
+	if len(findings) == 0 {
+		fmt.Fprintf(w, "  <no findings>\n")
+	}
+	for _, f := range findings {
+		fmt.Fprintf(w, "  [%s] %s: %s\n", f.Type, objectName(f.Namespace, f.Name), f.Detail)
+	}
+}
+
+// ServiceAccountsHandler serves the ServiceAccount inventory and findings over HTTP, e.g. /serviceaccounts[?namespace=default]
+func ServiceAccountsHandler(w http.ResponseWriter, r *http.Request) {
+	namespace := r.URL.Query().Get("namespace")
+	writeJSON(w, map[string]interface{}{
+		"serviceAccounts": ServiceAccountInventory(namespace),
+		"findings":        ServiceAccountFindings(namespace),
+	})
+}
+
+func ServiceAccountCreated(sa *apiv1.ServiceAccount) error {
+	glog.Info("=====> A serviceaccount got created")
+	JsonPrettyPrint("serviceaccount", sa)
+	PrintServiceAccountInfo(os.Stdout, serviceAccountInfo(sa))
+	return nil
+}
+
+// Pods still running as a deleted ServiceAccount lose their API access once its tokens are gone
+func ServiceAccountDeleted(sa *apiv1.ServiceAccount) error {
+	glog.Info("=====> A serviceaccount got deleted")
+	JsonPrettyPrint("serviceaccount", sa)
+	info := serviceAccountInfo(sa)
+	PrintServiceAccountInfo(os.Stdout, info)
+	if len(info.Pods) > 0 {
+		glog.Warningf("Deleted serviceaccount %s is still used by pod(s) %v", objectName(sa.Namespace, sa.Name), info.Pods)
+	}
+	return nil
+}
+
+// Only report changes of the token Secrets / imagePullSecrets
+func ServiceAccountUpdated(old, updated *apiv1.ServiceAccount) error {
+	if reflect.DeepEqual(old.Secrets, updated.Secrets) && reflect.DeepEqual(old.ImagePullSecrets, updated.ImagePullSecrets) {
+		return nil
+	}
+	glog.Infof("=====> A serviceaccount got updated: %s", objectName(updated.Namespace, updated.Name))
+	PrintServiceAccountInfo(os.Stdout, serviceAccountInfo(updated))
+	return nil
+}
@@ -0,0 +1,259 @@
+package handler
+
+import (
+	"fmt"
+	"io"
+	"net/http"
+	"os"
+	"reflect"
+	"sort"
+	"sync"
+
+	apiv1 "github.com/FlorianOtel/client-go/pkg/api/v1"
+	"github.com/FlorianOtel/client-go/pkg/labels"
+	"github.com/FlorianOtel/client-go/pkg/util/intstr"
+)
+
+// Service health checks: the selector of each Service is evaluated against the cached Pods. The problems reported are:
+// - "no-pods":             the selector matches no Pods
+// - "unexposed-port":      a targetPort (name or number) is not exposed by any container of the selected Pods
+// - "no-ready-pods":       none of the selected Pods is ready
+// - "mixed-readiness":     some of the selected Pods are ready, some are not
+// - "nodeport-conflict":   a NodePort is used by another Service too
+// - "externalip-conflict": an external IP / port / protocol is used by another Service too
+// The checks are re-evaluated as Pods and Services come and go -- reporting the problems that appear and the ones that are resolved.
+// Services without a selector (i.e. with manually managed endpoints) are only checked for conflicts. The checks only start once
+// the Pod cache has synced (EnableServiceHealth) -- until then all the Services would seem to have no Pods.
+
+// ServiceProblem is a problem of a Service
+type ServiceProblem struct {
+	Check  string `json:"check"`
+	Detail string `json:"detail"`
+}
+
+// ServiceHealth is the result of the health checks of a Service
+type ServiceHealth struct {
+	Namespace string           `json:"namespace"`
+	Name      string           `json:"name"`
+	Pods      []string         `json:"pods"`  // Selected Pods
+	Ready     int              `json:"ready"` // Number of ready selected Pods
+	Problems  []ServiceProblem `json:"problems"`
+}
+
+var (
+	serviceHealthMutex sync.Mutex
+	serviceHealth      = make(map[string]ServiceHealth) // "namespace/name" -> last health check result
+	serviceHealthOn    bool                             // Set once the Pod cache has synced
+)
+
+// EnableServiceHealth starts the Service checks, and runs them on all the cached Services. To be called once the Pod cache has
+// synced
+func EnableServiceHealth() {
+	serviceHealthMutex.Lock()
+	serviceHealthOn = true
+	serviceHealthMutex.Unlock()
+	servicesChanged()
+}
+
+// podReady tells whether a Pod is ready
+func podReady(pod *apiv1.Pod) bool {
+	for _, c := range pod.Status.Conditions {
+		if c.Type == apiv1.PodReady {
+			return c.Status == apiv1.ConditionTrue
+		}
+	}
+	return false
+}
+
+// cachedServices returns the cached Services, sorted by namespace / name
+func cachedServices() []*apiv1.Service {
+	var services []*apiv1.Service
+	if ServiceStore == nil {
+		return services
+	}
+	for _, obj := range ServiceStore.List() {
+		services = append(services, obj.(*apiv1.Service))
+	}
+	sort.Slice(services, func(i, j int) bool {
+		return objectName(services[i].Namespace, services[i].Name) < objectName(services[j].Namespace, services[j].Name)
+	})
+	return services
+}
+
+// serviceSelects tells whether a Service selects a Pod
+func serviceSelects(svc *apiv1.Service, pod *apiv1.Pod) bool {
+	return len(svc.Spec.Selector) > 0 && pod.Namespace == svc.Namespace &&
+		labels.SelectorFromSet(labels.Set(svc.Spec.Selector)).Matches(labels.Set(pod.Labels))
+}
+
+// targetPortExposed tells whether any of the Pods exposes the targetPort of a ServicePort
+func targetPortExposed(sp apiv1.ServicePort, pods []*apiv1.Pod) bool {
+	protocol := sp.Protocol
+	if protocol == "" {
+		protocol = apiv1.ProtocolTCP
+	}
+	target := sp.TargetPort
+	if target.Type == intstr.Int && target.IntVal == 0 {
+		target = intstr.FromInt(int(sp.Port)) // targetPort defaults to port
+	}
+	for _, pod := range pods {
+		if target.Type == intstr.String {
+			if _, ok := containerPort(pod, target.StrVal, protocol); ok {
+				return true
+			}
+			continue
+		}
+		for _, p := range declaredPorts(pod) {
+			if p.Protocol == protocol && p.Port == target.IntVal {
+				return true
+			}
+		}
+	}
+	return false
+}
+
+// CheckService runs the health checks of a Service against the cached Pods and Services
+func CheckService(svc *apiv1.Service) ServiceHealth {
+	h := ServiceHealth{Namespace: svc.Namespace, Name: svc.Name, Pods: []string{}, Problems: []ServiceProblem{}}
+
+	if len(svc.Spec.Selector) > 0 {
+		var selected []*apiv1.Pod
+		for _, pod := range cachedPods() {
+			if serviceSelects(svc, pod) && !podTerminated(pod) {
+				selected = append(selected, pod)
+				h.Pods = append(h.Pods, objectName(pod.Namespace, pod.Name))
+				if podReady(pod) {
+					h.Ready++
+				}
+			}
+		}
+
+		if len(selected) == 0 {
+			h.Problems = append(h.Problems, ServiceProblem{"no-pods", fmt.Sprintf("selector %v matches no pods", svc.Spec.Selector)})
+		} else {
+			for _, sp := range svc.Spec.Ports {
+				if !targetPortExposed(sp, selected) {
+					h.Problems = append(h.Problems, ServiceProblem{"unexposed-port",
+						fmt.Sprintf("port %d (%s): targetPort %s not exposed by any container of the selected pods", sp.Port, sp.Name, sp.TargetPort.String())})
+				}
+			}
+			if h.Ready == 0 {
+				h.Problems = append(h.Problems, ServiceProblem{"no-ready-pods", fmt.Sprintf("none of the %d selected pods ready", len(selected))})
+			} else if h.Ready < len(selected) {
+				h.Problems = append(h.Problems, ServiceProblem{"mixed-readiness", fmt.Sprintf("%d of %d selected pods ready", h.Ready, len(selected))})
+			}
+		}
+	}
+
+	for _, other := range cachedServices() {
+		if other.Namespace == svc.Namespace && other.Name == svc.Name {
+			continue
+		}
+		for _, sp := range svc.Spec.Ports {
+			for _, op := range other.Spec.Ports {
+				if sp.NodePort != 0 && sp.NodePort == op.NodePort && sp.Protocol == op.Protocol {
+					h.Problems = append(h.Problems, ServiceProblem{"nodeport-conflict",
+						fmt.Sprintf("nodePort %s/%d also used by service %s", sp.Protocol, sp.NodePort, objectName(other.Namespace, other.Name))})
+				}
+				if sp.Port != op.Port || sp.Protocol != op.Protocol {
+					continue
+				}
+				for _, ip := range svc.Spec.ExternalIPs {
+					for _, oip := range other.Spec.ExternalIPs {
+						if ip == oip {
+							h.Problems = append(h.Problems, ServiceProblem{"externalip-conflict",
+								fmt.Sprintf("external IP %s:%s/%d also used by service %s", ip, sp.Protocol, sp.Port, objectName(other.Namespace, other.Name))})
+						}
+					}
+				}
+			}
+		}
+	}
+
+	return h
+}
+
+// refreshServiceHealth re-checks the cached Services accepted by "affected", and reports the problems that appeared / got resolved
+func refreshServiceHealth(w io.Writer, affected func(svc *apiv1.Service) bool) {
+	serviceHealthMutex.Lock()
+	defer serviceHealthMutex.Unlock()
+	if !serviceHealthOn {
+		return
+	}
+
+	for _, svc := range cachedServices() {
+		if !affected(svc) {
+			continue
+		}
+		key := objectName(svc.Namespace, svc.Name)
+		old := serviceHealth[key]
+		updated := CheckService(svc)
+		serviceHealth[key] = updated
+
+		for _, p := range updated.Problems {
+			if !hasProblem(old.Problems, p) {
+				fmt.Fprintf(w, "  service %s: [%s] %s\n", key, p.Check, p.Detail)
+			}
+		}
+		for _, p := range old.Problems {
+			if !hasProblem(updated.Problems, p) {
+				fmt.Fprintf(w, "  service %s: resolved [%s] %s\n", key, p.Check, p.Detail)
+			}
+		}
+	}
+}
+
+// problemKey identifies a problem, to tell the problems that appeared / got resolved. The counts of the "mixed-readiness" and
+// "no-ready-pods" problems change as Pods come and go, so are not part of their identity
+func problemKey(p ServiceProblem) string {
+	if p.Check == "mixed-readiness" || p.Check == "no-ready-pods" {
+		return p.Check
+	}
+	return p.Check + " " + p.Detail
+}
+
+// hasProblem tells whether a list of problems contains a given one
+func hasProblem(problems []ServiceProblem, p ServiceProblem) bool {
+	for _, q := range problems {
+		if problemKey(q) == problemKey(p) {
+			return true
+		}
+	}
+	return false
+}
+
+// forgetService drops the health check result of a deleted Service
+func forgetService(svc *apiv1.Service) {
+	serviceHealthMutex.Lock()
+	defer serviceHealthMutex.Unlock()
+	delete(serviceHealth, objectName(svc.Namespace, svc.Name))
+}
+
+// servicesPodChanged re-checks the Services a Pod change may affect: the ones selecting it before or after the change.
+// Only label and readiness changes matter for existing Pods
+func servicesPodChanged(old, updated *apiv1.Pod) {
+	if old != nil && updated != nil && reflect.DeepEqual(old.Labels, updated.Labels) && podReady(old) == podReady(updated) &&
+		podTerminated(old) == podTerminated(updated) {
+		return
+	}
+	refreshServiceHealth(os.Stdout, func(svc *apiv1.Service) bool {
+		return (old != nil && serviceSelects(svc, old)) || (updated != nil && serviceSelects(svc, updated))
+	})
+}
+
+// servicesChanged re-checks all the Services -- a Service change may create / resolve conflicts with the other ones
+func servicesChanged() {
+	refreshServiceHealth(os.Stdout, func(svc *apiv1.Service) bool { return true })
+}
+
+// ServiceHealthHandler serves the Service health checks over HTTP, e.g. /servicehealth[?namespace=default]
+func ServiceHealthHandler(w http.ResponseWriter, r *http.Request) {
+	namespace := r.URL.Query().Get("namespace")
+	results := []ServiceHealth{}
+	for _, svc := range cachedServices() {
+		if namespace == "" || svc.Namespace == namespace {
+			results = append(results, CheckService(svc))
+		}
+	}
+	writeJSON(w, results)
+}
@@ -0,0 +1,84 @@
+package handler
+
+import (
+	"bytes"
+	"reflect"
+	"strings"
+	"testing"
+
+	apiv1 "github.com/FlorianOtel/client-go/pkg/api/v1"
+	"github.com/FlorianOtel/client-go/tools/cache"
+)
+
+// svcPod returns a Pod labelled app=web, ready or not
+func svcPod(name string, ready bool) *apiv1.Pod {
+	status := apiv1.ConditionFalse
+	if ready {
+		status = apiv1.ConditionTrue
+	}
+	return &apiv1.Pod{
+		ObjectMeta: apiv1.ObjectMeta{Namespace: "default", Name: name, Labels: map[string]string{"app": "web"}},
+		Status:     apiv1.PodStatus{Conditions: []apiv1.PodCondition{{Type: apiv1.PodReady, Status: status}}},
+	}
+}
+
+// svcWeb is a Service selecting app=web, without ports
+var svcWeb = &apiv1.Service{
+	ObjectMeta: apiv1.ObjectMeta{Namespace: "default", Name: "web"},
+	Spec:       apiv1.ServiceSpec{Selector: map[string]string{"app": "web"}},
+}
+
+func TestCheckServiceReadiness(t *testing.T) {
+	tests := []struct {
+		name     string
+		pods     []*apiv1.Pod
+		expected []ServiceProblem
+	}{
+		{"no pods", nil, []ServiceProblem{{"no-pods", "selector map[app:web] matches no pods"}}},
+		{"none ready", []*apiv1.Pod{svcPod("web-1", false), svcPod("web-2", false)}, []ServiceProblem{{"no-ready-pods", "none of the 2 selected pods ready"}}},
+		{"some ready", []*apiv1.Pod{svcPod("web-1", true), svcPod("web-2", false)}, []ServiceProblem{{"mixed-readiness", "1 of 2 selected pods ready"}}},
+		{"all ready", []*apiv1.Pod{svcPod("web-1", true), svcPod("web-2", true)}, []ServiceProblem{}},
+	}
+	for _, test := range tests {
+		withPods(t, test.pods...)
+		if h := CheckService(svcWeb); !reflect.DeepEqual(h.Problems, test.expected) {
+			t.Errorf("%s: CheckService problems = %+v, expected %+v", test.name, h.Problems, test.expected)
+		}
+	}
+}
+
+func TestRefreshServiceHealthAfterSync(t *testing.T) {
+	savedStore, savedOn, savedHealth := ServiceStore, serviceHealthOn, serviceHealth
+	t.Cleanup(func() { ServiceStore, serviceHealthOn, serviceHealth = savedStore, savedOn, savedHealth })
+	ServiceStore = cache.NewStore(cache.MetaNamespaceKeyFunc)
+	if err := ServiceStore.Add(svcWeb); err != nil {
+		t.Fatal(err)
+	}
+	serviceHealth = make(map[string]ServiceHealth)
+	all := func(svc *apiv1.Service) bool { return true }
+
+	// Before the Pod cache has synced: not checked
+	serviceHealthOn = false
+	withPods(t)
+	var out bytes.Buffer
+	refreshServiceHealth(&out, all)
+	if out.Len() > 0 {
+		t.Errorf("refreshServiceHealth before the sync: %q, expected nothing", out.String())
+	}
+
+	// Synced
+	serviceHealthOn = true
+	withPods(t, svcPod("web-1", false))
+	refreshServiceHealth(&out, all)
+	if !strings.Contains(out.String(), "[no-ready-pods]") || strings.Contains(out.String(), "[no-pods]") {
+		t.Errorf("refreshServiceHealth after the sync: %q, expected a no-ready-pods problem only", out.String())
+	}
+
+	// More pods, still none ready: not reported again
+	out.Reset()
+	withPods(t, svcPod("web-1", false), svcPod("web-2", false))
+	refreshServiceHealth(&out, all)
+	if out.Len() > 0 {
+		t.Errorf("refreshServiceHealth: %q, expected nothing new", out.String())
+	}
+}
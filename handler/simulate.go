@@ -0,0 +1,205 @@
+package handler
+
+import (
+	"fmt"
+	"io"
+	"net/http"
+	"os"
+	"sort"
+
+	apiv1 "github.com/FlorianOtel/client-go/pkg/api/v1"
+	apiv1beta1 "github.com/FlorianOtel/client-go/pkg/apis/extensions/v1beta1"
+	"github.com/FlorianOtel/client-go/pkg/util/yaml"
+)
+
+// NetworkPolicy simulation: the impact of proposed NetworkPolicies on the current (cached) cluster state, without touching the cluster.
+// A proposed policy replaces the cached policy with the same namespace / name, if any -- otherwise it is added.
+// The impact is given as the Pods newly (no longer) selected by any policy, and the flows -- between all the cached Pods, on given
+// ports -- newly blocked or newly allowed.
+
+// FlowChange is a flow whose verdict changes
+type FlowChange struct {
+	Source      string   `json:"source"`
+	Destination string   `json:"destination"`
+	Port        string   `json:"port"`
+	AdmittedBy  []string `json:"admittedBy,omitempty"` // For newly allowed flows: the rules admitting them
+}
+
+// SimulationResult is the impact of proposed NetworkPolicies
+type SimulationResult struct {
+	Added         []string     `json:"added"`    // Proposed policies that are new
+	Replaced      []string     `json:"replaced"` // Proposed policies replacing a cached one
+	NewlySelected []string     `json:"newlySelected"`
+	Unselected    []string     `json:"unselected"`
+	NewlyBlocked  []FlowChange `json:"newlyBlocked"`
+	NewlyAllowed  []FlowChange `json:"newlyAllowed"`
+	Notes         []string     `json:"notes"`
+}
+
+// DecodeNetworkPolicies decodes the NetworkPolicies in a YAML or JSON stream -- possibly several YAML documents.
+// Policies without a namespace are put in the "default" namespace
+func DecodeNetworkPolicies(r io.Reader) ([]*apiv1beta1.NetworkPolicy, error) {
+	var policies []*apiv1beta1.NetworkPolicy
+
+	decoder := yaml.NewYAMLOrJSONDecoder(r, 4096)
+	for {
+		np := &apiv1beta1.NetworkPolicy{}
+		if err := decoder.Decode(np); err == io.EOF {
+			break
+		} else if err != nil {
+			return nil, err
+		}
+		if np.Kind == "" && np.Name == "" {
+			continue // Empty document
+		}
+		if np.Kind != "" && np.Kind != "NetworkPolicy" {
+			return nil, fmt.Errorf("unexpected kind %q (%s). Expected NetworkPolicy", np.Kind, np.Name)
+		}
+		if np.Name == "" {
+			return nil, fmt.Errorf("NetworkPolicy without a name")
+		}
+		if np.Namespace == "" {
+			np.Namespace = apiv1.NamespaceDefault
+		}
+		policies = append(policies, np)
+	}
+
+	if len(policies) == 0 {
+		return nil, fmt.Errorf("no NetworkPolicy found")
+	}
+	return policies, nil
+}
+
+// LoadNetworkPolicies decodes the NetworkPolicies in a YAML or JSON file
+func LoadNetworkPolicies(path string) ([]*apiv1beta1.NetworkPolicy, error) {
+	f, err := os.Open(path)
+	if err != nil {
+		return nil, err
+	}
+	defer f.Close()
+	return DecodeNetworkPolicies(f)
+}
+
+// SimulateNetworkPolicies computes the impact of proposed NetworkPolicies on the cached cluster state, on the given ports
+func SimulateNetworkPolicies(proposed []*apiv1beta1.NetworkPolicy, ports []FlowPort) SimulationResult {
+	res := SimulationResult{Added: []string{}, Replaced: []string{}, NewlySelected: []string{}, Unselected: []string{},
+		NewlyBlocked: []FlowChange{}, NewlyAllowed: []FlowChange{}, Notes: []string{}}
+
+	current := CachedNetworkPolicies()
+
+	// The policy set once the proposed policies are applied
+	byName := make(map[string]*apiv1beta1.NetworkPolicy)
+	for _, np := range current {
+		byName[objectName(np.Namespace, np.Name)] = np
+	}
+	for _, np := range proposed {
+		name := objectName(np.Namespace, np.Name)
+		if _, exists := byName[name]; exists {
+			res.Replaced = append(res.Replaced, name)
+		} else {
+			res.Added = append(res.Added, name)
+		}
+		byName[name] = np
+
+		if NamespaceStore != nil && cachedNamespace(np.Namespace) == nil {
+			res.Notes = append(res.Notes, fmt.Sprintf("namespace %s of %s is unknown", np.Namespace, name))
+		} else if !namespaceIsolated(np.Namespace) {
+			res.Notes = append(res.Notes, fmt.Sprintf("namespace %s is not isolated: %s would have no effect", np.Namespace, name))
+		}
+	}
+	var after []*apiv1beta1.NetworkPolicy
+	for _, np := range byName {
+		after = append(after, np)
+	}
+	sort.Slice(after, func(i, j int) bool {
+		return objectName(after[i].Namespace, after[i].Name) < objectName(after[j].Namespace, after[j].Name)
+	})
+
+	var pods []*apiv1.Pod
+	for _, pod := range cachedPods() {
+		if !podTerminated(pod) {
+			pods = append(pods, pod)
+		}
+	}
+
+	selected := func(policies []*apiv1beta1.NetworkPolicy, pod *apiv1.Pod) bool {
+		for _, np := range policies {
+			if policySelectsPod(np, pod) {
+				return true
+			}
+		}
+		return false
+	}
+	for _, pod := range pods {
+		before, now := selected(current, pod), selected(after, pod)
+		switch {
+		case !before && now:
+			res.NewlySelected = append(res.NewlySelected, objectName(pod.Namespace, pod.Name))
+		case before && !now:
+			res.Unselected = append(res.Unselected, objectName(pod.Namespace, pod.Name))
+		}
+	}
+
+	for _, port := range ports {
+		for _, src := range pods {
+			for _, dst := range pods {
+				if src == dst {
+					continue
+				}
+				before, now := EvaluateIngress(current, src, dst, port), EvaluateIngress(after, src, dst, port)
+				change := FlowChange{Source: objectName(src.Namespace, src.Name), Destination: objectName(dst.Namespace, dst.Name), Port: port.String()}
+				switch {
+				case before.Allowed && !now.Allowed:
+					res.NewlyBlocked = append(res.NewlyBlocked, change)
+				case !before.Allowed && now.Allowed:
+					change.AdmittedBy = now.AdmittedBy
+					res.NewlyAllowed = append(res.NewlyAllowed, change)
+				}
+			}
+		}
+	}
+
+	return res
+}
+
+// PrintSimulation prints the impact of proposed NetworkPolicies
+func PrintSimulation(w io.Writer, res SimulationResult) {
+	fmt.Fprintf(w, "Proposed NetworkPolicies: added %v, replaced %v\n", res.Added, res.Replaced)
+	for _, n := range res.Notes {
+		fmt.Fprintf(w, "  N.B. %s\n", n)
+	}
+	for _, p := range res.NewlySelected {
+		fmt.Fprintf(w, "  pod %s: newly selected by a NetworkPolicy\n", p)
+	}
+	for _, p := range res.Unselected {
+		fmt.Fprintf(w, "  pod %s: no longer selected by any NetworkPolicy\n", p)
+	}
+	for _, f := range res.NewlyBlocked {
+		fmt.Fprintf(w, "  newly BLOCKED: %s -> %s on %s\n", f.Source, f.Destination, f.Port)
+	}
+	for _, f := range res.NewlyAllowed {
+		fmt.Fprintf(w, "  newly allowed: %s -> %s on %s (by %v)\n", f.Source, f.Destination, f.Port, f.AdmittedBy)
+	}
+	if len(res.NewlySelected)+len(res.Unselected)+len(res.NewlyBlocked)+len(res.NewlyAllowed) == 0 {
+		fmt.Fprintf(w, "  <no change>\n")
+	}
+}
+
+// SimulateHandler simulates the NetworkPolicies POSTed (as YAML or JSON) over HTTP, e.g. /simulate?ports=TCP/80,UDP/53
+func SimulateHandler(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodPost {
+		http.Error(w, "POST the proposed NetworkPolicies", http.StatusMethodNotAllowed)
+		return
+	}
+	ports, err := ParseFlowPorts(r.URL.Query().Get("ports"))
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusBadRequest)
+		return
+	}
+	proposed, err := DecodeNetworkPolicies(r.Body)
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusBadRequest)
+		return
+	}
+	writeJSON(w, SimulateNetworkPolicies(proposed, ports))
+}
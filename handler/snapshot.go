@@ -0,0 +1,374 @@
+package handler
+
+import (
+	"bufio"
+	"compress/gzip"
+	"encoding/json"
+	"fmt"
+	"io"
+	"net/http"
+	"os"
+	"reflect"
+	"sort"
+	"strings"
+	"time"
+
+	apiv1 "github.com/FlorianOtel/client-go/pkg/api/v1"
+	"github.com/FlorianOtel/client-go/pkg/version"
+	"github.com/FlorianOtel/client-go/tools/cache"
+)
+
+// Cluster snapshots: every cached object of the watched resources, dumped as JSON Lines -- a header line (format version, time,
+// API server version and discovered resources), then one line per object. Snapshot files ending in ".gz" are gzip'ed.
+// Secret values are never written -- only the key names, sizes and hashes (as printed), which is enough to tell changes apart.
+// Events and ThirdPartyResource instances are left out.
+//
+// Two snapshots are compared offline: objects created, deleted and modified -- with the field-level changes. The
+// metadata.resourceVersion is ignored, as it changes on each update anyway.
+
+// SnapshotFormat is the version of the snapshot format
+const SnapshotFormat = "k8s-client-snapshot/v1"
+
+// ServerVersion and APIResources ("groupVersion/resource") are recorded in the snapshot headers. Set by the caller after discovery
+var (
+	ServerVersion *version.Info
+	APIResources  []string
+)
+
+// SnapshotHeader is the first line of a snapshot
+type SnapshotHeader struct {
+	Format        string        `json:"format"`
+	Time          time.Time     `json:"time"`
+	ServerVersion *version.Info `json:"serverVersion,omitempty"`
+	Resources     []string      `json:"resources"`
+	Objects       int           `json:"objects"`
+}
+
+// SnapshotObject is an object of a snapshot
+type SnapshotObject struct {
+	Kind      string          `json:"kind"`
+	Namespace string          `json:"namespace,omitempty"`
+	Name      string          `json:"name"`
+	Object    json.RawMessage `json:"object"`
+}
+
+// Snapshot is a snapshot, as loaded
+type Snapshot struct {
+	Header  SnapshotHeader
+	Objects map[string]SnapshotObject // "Kind namespace/name" -> object
+}
+
+// FieldChange is a field-level change of an object
+type FieldChange struct {
+	Path string      `json:"path"` // E.g. "spec.containers[0].image"
+	Old  interface{} `json:"old,omitempty"`
+	New  interface{} `json:"new,omitempty"`
+}
+
+// ObjectDiff is an object created, deleted or modified between two snapshots
+type ObjectDiff struct {
+	Change    string        `json:"change"` // "created", "deleted" or "modified"
+	Kind      string        `json:"kind"`
+	Namespace string        `json:"namespace,omitempty"`
+	Name      string        `json:"name"`
+	Fields    []FieldChange `json:"fields,omitempty"` // Modified objects only
+}
+
+// SnapshotDiff is the difference between two snapshots
+type SnapshotDiff struct {
+	Old     SnapshotHeader `json:"old"`
+	New     SnapshotHeader `json:"new"`
+	Objects []ObjectDiff   `json:"objects"`
+}
+
+// snapshotStores returns the stores of the watched resources, by kind
+func snapshotStores() map[string]cache.Store {
+	stores := map[string]cache.Store{
+		"Pod":                       PodStore,
+		"Service":                   ServiceStore,
+		"Namespace":                 NamespaceStore,
+		"NetworkPolicy":             NetworkPolicyStore,
+		"Node":                      NodeStore,
+		"PodDisruptionBudget":       PodDisruptionBudgetStore,
+		"PersistentVolume":          PersistentVolumeStore,
+		"PersistentVolumeClaim":     PersistentVolumeClaimStore,
+		"ResourceQuota":             ResourceQuotaStore,
+		"LimitRange":                LimitRangeStore,
+		"ConfigMap":                 ConfigMapStore,
+		"Secret":                    SecretStore,
+		"ServiceAccount":            ServiceAccountStore,
+		"StorageClass":              StorageClassStore,
+		"HorizontalPodAutoscaler":   HorizontalPodAutoscalerStore,
+		"CertificateSigningRequest": CertificateSigningRequestStore,
+		"PodSecurityPolicy":         PodSecurityPolicyStore,
+		"Deployment":                DeploymentStore,
+		"DaemonSet":                 DaemonSetStore,
+		"StatefulSet":               StatefulSetStore,
+		"Role":                      RoleStore,
+		"ClusterRole":               ClusterRoleStore,
+		"RoleBinding":               RoleBindingStore,
+		"ClusterRoleBinding":        ClusterRoleBindingStore,
+	}
+	for kind, store := range stores {
+		if store == nil {
+			delete(stores, kind)
+		}
+	}
+	return stores
+}
+
+// snapshotKey returns the key of an object in a snapshot
+func snapshotKey(kind, namespace, name string) string {
+	return kind + " " + objectName(namespace, name)
+}
+
+// WriteSnapshot writes a snapshot of all the cached objects
+func WriteSnapshot(w io.Writer) error {
+	var objects []SnapshotObject
+	for kind, store := range snapshotStores() {
+		for _, obj := range store.List() {
+			key, err := cache.MetaNamespaceKeyFunc(obj)
+			if err != nil {
+				return err
+			}
+			var v interface{} = obj
+			if secret, ok := obj.(*apiv1.Secret); ok {
+				v = map[string]interface{}{"metadata": RedactSecretMeta(secret), "type": secret.Type, "data": RedactSecret(secret)}
+			}
+			b, err := json.Marshal(v)
+			if err != nil {
+				return fmt.Errorf("error marshalling %s %s: %s", kind, key, err)
+			}
+			namespace, name, _ := cache.SplitMetaNamespaceKey(key)
+			objects = append(objects, SnapshotObject{Kind: kind, Namespace: namespace, Name: name, Object: b})
+		}
+	}
+	sort.Slice(objects, func(i, j int) bool {
+		return snapshotKey(objects[i].Kind, objects[i].Namespace, objects[i].Name) < snapshotKey(objects[j].Kind, objects[j].Namespace, objects[j].Name)
+	})
+
+	header := SnapshotHeader{Format: SnapshotFormat, Time: time.Now().UTC(), ServerVersion: ServerVersion, Resources: APIResources, Objects: len(objects)}
+	if header.Resources == nil {
+		header.Resources = []string{}
+	}
+
+	enc := json.NewEncoder(w)
+	if err := enc.Encode(header); err != nil {
+		return err
+	}
+	for _, o := range objects {
+		if err := enc.Encode(o); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// SaveSnapshot writes a snapshot of all the cached objects to a file -- gzip'ed if its name ends in ".gz"
+func SaveSnapshot(path string) error {
+	f, err := os.OpenFile(path, os.O_CREATE|os.O_TRUNC|os.O_WRONLY, 0600)
+	if err != nil {
+		return err
+	}
+	defer f.Close()
+
+	if !strings.HasSuffix(path, ".gz") {
+		return WriteSnapshot(f)
+	}
+	gz := gzip.NewWriter(f)
+	if err := WriteSnapshot(gz); err != nil {
+		return err
+	}
+	return gz.Close()
+}
+
+// LoadSnapshot reads a snapshot file -- gzip'ed if its name ends in ".gz"
+func LoadSnapshot(path string) (*Snapshot, error) {
+	f, err := os.Open(path)
+	if err != nil {
+		return nil, err
+	}
+	defer f.Close()
+
+	var r io.Reader = f
+	if strings.HasSuffix(path, ".gz") {
+		gz, err := gzip.NewReader(f)
+		if err != nil {
+			return nil, err
+		}
+		defer gz.Close()
+		r = gz
+	}
+
+	scanner := bufio.NewScanner(r)
+	scanner.Buffer(make([]byte, 64*1024), 64*1024*1024)
+
+	s := &Snapshot{Objects: make(map[string]SnapshotObject)}
+	if !scanner.Scan() {
+		if err := scanner.Err(); err != nil {
+			return nil, err
+		}
+		return nil, fmt.Errorf("%s: empty snapshot", path)
+	}
+	if err := json.Unmarshal(scanner.Bytes(), &s.Header); err != nil {
+		return nil, fmt.Errorf("%s: invalid snapshot header: %s", path, err)
+	}
+	if s.Header.Format != SnapshotFormat {
+		return nil, fmt.Errorf("%s: unsupported snapshot format %q. Expected %q", path, s.Header.Format, SnapshotFormat)
+	}
+	for line := 2; scanner.Scan(); line++ {
+		var o SnapshotObject
+		if err := json.Unmarshal(scanner.Bytes(), &o); err != nil {
+			return nil, fmt.Errorf("%s:%d: invalid object: %s", path, line, err)
+		}
+		s.Objects[snapshotKey(o.Kind, o.Namespace, o.Name)] = o
+	}
+	return s, scanner.Err()
+}
+
+// diffFields appends the field-level changes between two decoded JSON values
+func diffFields(path string, old, updated interface{}, changes *[]FieldChange) {
+	if path == "metadata.resourceVersion" {
+		return
+	}
+	oldMap, oldIsMap := old.(map[string]interface{})
+	newMap, newIsMap := updated.(map[string]interface{})
+	if oldIsMap && newIsMap {
+		keys := make(map[string]bool)
+		for k := range oldMap {
+			keys[k] = true
+		}
+		for k := range newMap {
+			keys[k] = true
+		}
+		var sorted []string
+		for k := range keys {
+			sorted = append(sorted, k)
+		}
+		sort.Strings(sorted)
+		for _, k := range sorted {
+			p := k
+			if path != "" {
+				p = path + "." + k
+			}
+			diffFields(p, oldMap[k], newMap[k], changes)
+		}
+		return
+	}
+
+	oldList, oldIsList := old.([]interface{})
+	newList, newIsList := updated.([]interface{})
+	if oldIsList && newIsList {
+		for i := 0; i < len(oldList) || i < len(newList); i++ {
+			var o, n interface{}
+			if i < len(oldList) {
+				o = oldList[i]
+			}
+			if i < len(newList) {
+				n = newList[i]
+			}
+			diffFields(fmt.Sprintf("%s[%d]", path, i), o, n, changes)
+		}
+		return
+	}
+
+	if !reflect.DeepEqual(old, updated) {
+		*changes = append(*changes, FieldChange{Path: path, Old: old, New: updated})
+	}
+}
+
+// DiffSnapshots compares two snapshots
+func DiffSnapshots(old, updated *Snapshot) (SnapshotDiff, error) {
+	diff := SnapshotDiff{Old: old.Header, New: updated.Header, Objects: []ObjectDiff{}}
+
+	for key, o := range old.Objects {
+		if _, ok := updated.Objects[key]; !ok {
+			diff.Objects = append(diff.Objects, ObjectDiff{Change: "deleted", Kind: o.Kind, Namespace: o.Namespace, Name: o.Name})
+		}
+	}
+	for key, n := range updated.Objects {
+		o, ok := old.Objects[key]
+		if !ok {
+			diff.Objects = append(diff.Objects, ObjectDiff{Change: "created", Kind: n.Kind, Namespace: n.Namespace, Name: n.Name})
+			continue
+		}
+		var oldValue, newValue interface{}
+		if err := json.Unmarshal(o.Object, &oldValue); err != nil {
+			return diff, fmt.Errorf("%s: %s", key, err)
+		}
+		if err := json.Unmarshal(n.Object, &newValue); err != nil {
+			return diff, fmt.Errorf("%s: %s", key, err)
+		}
+		var changes []FieldChange
+		diffFields("", oldValue, newValue, &changes)
+		if len(changes) > 0 {
+			diff.Objects = append(diff.Objects, ObjectDiff{Change: "modified", Kind: n.Kind, Namespace: n.Namespace, Name: n.Name, Fields: changes})
+		}
+	}
+
+	sort.Slice(diff.Objects, func(i, j int) bool {
+		a, b := diff.Objects[i], diff.Objects[j]
+		return snapshotKey(a.Kind, a.Namespace, a.Name) < snapshotKey(b.Kind, b.Namespace, b.Name)
+	})
+	return diff, nil
+}
+
+// fieldValue returns a compact form of a field value, for printing
+func fieldValue(v interface{}) string {
+	if v == nil {
+		return "<none>"
+	}
+	b, err := json.Marshal(v)
+	if err != nil {
+		return fmt.Sprintf("%v", v)
+	}
+	if s := string(b); len(s) <= 120 {
+		return s
+	}
+	return string(b[:117]) + "..."
+}
+
+// serverVersion returns the API server version of a snapshot header, for printing
+func serverVersion(h SnapshotHeader) string {
+	if h.ServerVersion == nil {
+		return "<unknown>"
+	}
+	return h.ServerVersion.GitVersion
+}
+
+// PrintSnapshotDiff prints the difference between two snapshots
+func PrintSnapshotDiff(w io.Writer, diff SnapshotDiff) {
+	fmt.Fprintf(w, "Old snapshot: %s, %d object(s), API server %s\n", diff.Old.Time.Format(time.RFC3339), diff.Old.Objects, serverVersion(diff.Old))
+	fmt.Fprintf(w, "New snapshot: %s, %d object(s), API server %s\n", diff.New.Time.Format(time.RFC3339), diff.New.Objects, serverVersion(diff.New))
+	if len(diff.Objects) == 0 {
+		fmt.Fprintf(w, "  <no change>\n")
+	}
+	for _, o := range diff.Objects {
+		fmt.Fprintf(w, "  %s %s %s\n", o.Change, o.Kind, objectName(o.Namespace, o.Name))
+		for _, f := range o.Fields {
+			fmt.Fprintf(w, "      %s: %s -> %s\n", f.Path, fieldValue(f.Old), fieldValue(f.New))
+		}
+	}
+}
+
+// WriteSnapshotDiff writes the difference between two snapshots as "text" or "json"
+func WriteSnapshotDiff(w io.Writer, diff SnapshotDiff, format string) error {
+	switch format {
+	case "json":
+		return writeIndentedJSON(w, diff)
+	case "text":
+		PrintSnapshotDiff(w, diff)
+		return nil
+	default:
+		return fmt.Errorf("invalid format %q. Expected one of: text, json", format)
+	}
+}
+
+// SnapshotHandler serves a snapshot of all the cached objects over HTTP: /snapshot
+func SnapshotHandler(w http.ResponseWriter, r *http.Request) {
+	w.Header().Set("Content-Type", "application/x-ndjson")
+	w.Header().Set("Content-Disposition", fmt.Sprintf("attachment; filename=snapshot-%s.jsonl", time.Now().UTC().Format("20060102-150405")))
+	if err := WriteSnapshot(w); err != nil {
+		http.Error(w, err.Error(), http.StatusInternalServerError)
+	}
+}
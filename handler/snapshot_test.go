@@ -0,0 +1,31 @@
+package handler
+
+import (
+	"bytes"
+	"strings"
+	"testing"
+
+	"github.com/FlorianOtel/client-go/tools/cache"
+)
+
+func TestWriteSnapshotRedactsSecrets(t *testing.T) {
+	saved := SecretStore
+	t.Cleanup(func() { SecretStore = saved })
+	SecretStore = cache.NewStore(cache.MetaNamespaceKeyFunc)
+	if err := SecretStore.Add(appliedSecret()); err != nil {
+		t.Fatal(err)
+	}
+
+	var b bytes.Buffer
+	if err := WriteSnapshot(&b); err != nil {
+		t.Fatal(err)
+	}
+	for _, leak := range []string{"c2VjcmV0", LastAppliedConfigAnnotation} {
+		if strings.Contains(b.String(), leak) {
+			t.Errorf("WriteSnapshot: the snapshot holds %q:\n%s", leak, b.String())
+		}
+	}
+	if !strings.Contains(b.String(), `"owner":"team"`) {
+		t.Errorf("WriteSnapshot: the other annotations are missing:\n%s", b.String())
+	}
+}
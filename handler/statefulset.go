@@ -0,0 +1,33 @@
+package handler
+
+import (
+	"github.com/golang/glog"
+	//
+
+	appsv1beta1 "github.com/FlorianOtel/client-go/pkg/apis/apps/v1beta1"
+)
+
+func StatefulSetCreated(ss *appsv1beta1.StatefulSet) error {
+	glog.Info("=====> A statefulset got created")
+	JsonPrettyPrint("statefulset", ss)
+	return nil
+}
+
+func StatefulSetDeleted(ss *appsv1beta1.StatefulSet) error {
+	glog.Info("=====> A statefulset got deleted")
+	JsonPrettyPrint("statefulset", ss)
+	return nil
+}
+
+// Only image changes are reported -- scaling and status updates are left out
+func StatefulSetUpdated(old, updated *appsv1beta1.StatefulSet) error {
+	changes := templateImageChanges(old.Spec.Template, updated.Spec.Template)
+	if len(changes) == 0 {
+		return nil
+	}
+	glog.Infof("=====> A statefulset got updated: %s", objectName(updated.Namespace, updated.Name))
+	for _, c := range changes {
+		glog.Infof("  %s", c)
+	}
+	return nil
+}
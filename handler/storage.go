@@ -0,0 +1,156 @@
+package handler
+
+import (
+	"fmt"
+	"sort"
+	"sync"
+	"time"
+
+	"github.com/golang/glog"
+	//
+
+	apiv1 "github.com/FlorianOtel/client-go/pkg/api/v1"
+	"github.com/FlorianOtel/client-go/pkg/types"
+)
+
+// StorageClassAnnotation is the (beta) annotation used for specifying the StorageClass of a PVC / PV
+const StorageClassAnnotation = "volume.beta.kubernetes.io/storage-class"
+
+// StuckStorageThreshold is how long a PVC can stay Pending -- or a PV can stay Pending / Released -- before being reported as stuck
+var StuckStorageThreshold = 5 * time.Minute
+
+// The API does not record when a PV / PVC entered its current phase, so we keep track of it ourselves: UID -> phase, first seen at
+type phaseSince struct {
+	phase string
+	since time.Time
+}
+
+var (
+	storagePhasesMutex sync.Mutex
+	storagePhases      = make(map[types.UID]phaseSince)
+)
+
+// trackPhase records the phase of a PV / PVC, keeping the original timestamp if the phase did not change
+func trackPhase(uid types.UID, phase string) {
+	storagePhasesMutex.Lock()
+	defer storagePhasesMutex.Unlock()
+
+	if p, ok := storagePhases[uid]; ok && p.phase == phase {
+		return
+	}
+	storagePhases[uid] = phaseSince{phase, time.Now()}
+}
+
+func forgetPhase(uid types.UID) {
+	storagePhasesMutex.Lock()
+	defer storagePhasesMutex.Unlock()
+	delete(storagePhases, uid)
+}
+
+// phaseAge returns for how long a PV / PVC has been in its current phase (as far as we know)
+func phaseAge(uid types.UID) time.Duration {
+	storagePhasesMutex.Lock()
+	defer storagePhasesMutex.Unlock()
+
+	if p, ok := storagePhases[uid]; ok {
+		return time.Since(p.since)
+	}
+	return 0
+}
+
+// storageCapacity returns the storage capacity from a ResourceList, or "-" if unset
+func storageCapacity(rl apiv1.ResourceList) string {
+	if q, ok := rl[apiv1.ResourceStorage]; ok {
+		return q.String()
+	}
+	return "-"
+}
+
+// PodsMountingClaim returns the names of the cached Pods mounting a given PVC
+func PodsMountingClaim(namespace, claim string) []string {
+	var pods []string
+
+	if PodStore == nil {
+		return pods
+	}
+
+	for _, obj := range PodStore.List() {
+		pod := obj.(*apiv1.Pod)
+		if pod.Namespace != namespace {
+			continue
+		}
+		for _, vol := range pod.Spec.Volumes {
+			if vol.PersistentVolumeClaim != nil && vol.PersistentVolumeClaim.ClaimName == claim {
+				pods = append(pods, pod.Name)
+				break
+			}
+		}
+	}
+
+	sort.Strings(pods)
+	return pods
+}
+
+// reportedStuck is the PVs / PVCs last reported as stuck: "UID phase" -> description. Only used by ReportStuckStorage
+var reportedStuck = make(map[string]string)
+
+// ReportStuckStorage reports PVCs stuck in Pending, and PVs stuck in Pending or Released, for longer than StuckStorageThreshold.
+// Each is reported once, when it gets stuck -- and again when it no longer is (phase changed, or deleted).
+// Meant to be run periodically (e.g. via wait.Until)
+func ReportStuckStorage() {
+	stuck := make(map[string]string)
+
+	if PersistentVolumeClaimStore != nil {
+		for _, obj := range PersistentVolumeClaimStore.List() {
+			pvc := obj.(*apiv1.PersistentVolumeClaim)
+			if pvc.Status.Phase != apiv1.ClaimPending {
+				continue
+			}
+			age := phaseAge(pvc.UID)
+			if age <= StuckStorageThreshold {
+				continue
+			}
+			key := fmt.Sprintf("%s %s", pvc.UID, pvc.Status.Phase)
+			stuck[key] = fmt.Sprintf("PersistentVolumeClaim %s/%s in phase %s", pvc.Namespace, pvc.Name, pvc.Status.Phase)
+			if _, reported := reportedStuck[key]; !reported {
+				glog.Warningf("PersistentVolumeClaim %s/%s stuck in phase %s for %s (requested %s, storage class %q). Mounted by pods: %v",
+					pvc.Namespace, pvc.Name, pvc.Status.Phase, age.Round(time.Second), storageCapacity(pvc.Spec.Resources.Requests),
+					pvc.Annotations[StorageClassAnnotation], PodsMountingClaim(pvc.Namespace, pvc.Name))
+			}
+		}
+	}
+
+	if PersistentVolumeStore != nil {
+		for _, obj := range PersistentVolumeStore.List() {
+			pv := obj.(*apiv1.PersistentVolume)
+			if pv.Status.Phase != apiv1.VolumePending && pv.Status.Phase != apiv1.VolumeReleased {
+				continue
+			}
+			age := phaseAge(pv.UID)
+			if age <= StuckStorageThreshold {
+				continue
+			}
+			key := fmt.Sprintf("%s %s", pv.UID, pv.Status.Phase)
+			stuck[key] = fmt.Sprintf("PersistentVolume %s in phase %s", pv.Name, pv.Status.Phase)
+			if _, reported := reportedStuck[key]; !reported {
+				glog.Warningf("PersistentVolume %s stuck in phase %s for %s (reclaim policy %s, claim %s). %s",
+					pv.Name, pv.Status.Phase, age.Round(time.Second), pv.Spec.PersistentVolumeReclaimPolicy, claimRefString(pv.Spec.ClaimRef), pv.Status.Message)
+			}
+		}
+	}
+
+	for key, what := range reportedStuck {
+		if _, ok := stuck[key]; !ok {
+			glog.Infof("%s no longer stuck", what)
+		}
+	}
+	reportedStuck = stuck
+}
+
+// claimRefString formats the claim a PV is bound to as "namespace/name", or "<none>"
+func claimRefString(ref *apiv1.ObjectReference) string {
+	if ref == nil {
+		return "<none>"
+	}
+	return fmt.Sprintf("%s/%s", ref.Namespace, ref.Name)
+}
@@ -0,0 +1,48 @@
+package handler
+
+import (
+	"fmt"
+
+	"github.com/golang/glog"
+	//
+
+	storagev1beta1 "github.com/FlorianOtel/client-go/pkg/apis/storage/v1beta1"
+)
+
+func StorageClassCreated(sc *storagev1beta1.StorageClass) error {
+	glog.Info("=====> A storageclass got created")
+	JsonPrettyPrint("storageclass", sc)
+	return nil
+}
+
+func StorageClassDeleted(sc *storagev1beta1.StorageClass) error {
+	glog.Info("=====> A storageclass got deleted")
+	JsonPrettyPrint("storageclass", sc)
+	return nil
+}
+
+// Report changes of provisioner or parameters
+func StorageClassUpdated(old, updated *storagev1beta1.StorageClass) error {
+	added, removed, changed := diffKeys(old.Parameters, updated.Parameters)
+
+	// Periodic resyncs / metadata-only updates
+	if old.Provisioner == updated.Provisioner && len(added)+len(removed)+len(changed) == 0 {
+		return nil
+	}
+
+	glog.Infof("=====> A storageclass got updated: %s", updated.Name)
+
+	if old.Provisioner != updated.Provisioner {
+		fmt.Printf("  storageclass %s provisioner %s -> %s\n", updated.Name, old.Provisioner, updated.Provisioner)
+	}
+	for _, k := range added {
+		fmt.Printf("  storageclass %s parameter %q added: %q\n", updated.Name, k, updated.Parameters[k])
+	}
+	for _, k := range removed {
+		fmt.Printf("  storageclass %s parameter %q removed (was %q)\n", updated.Name, k, old.Parameters[k])
+	}
+	for _, k := range changed {
+		fmt.Printf("  storageclass %s parameter %q %q -> %q\n", updated.Name, k, old.Parameters[k], updated.Parameters[k])
+	}
+	return nil
+}
@@ -0,0 +1,292 @@
+package handler
+
+import (
+	"fmt"
+	"reflect"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/golang/glog"
+	//
+
+	"github.com/FlorianOtel/client-go/kubernetes"
+	"github.com/FlorianOtel/client-go/pkg/api"
+	apiv1 "github.com/FlorianOtel/client-go/pkg/api/v1"
+	apiv1beta1 "github.com/FlorianOtel/client-go/pkg/apis/extensions/v1beta1"
+	"github.com/FlorianOtel/client-go/pkg/apis/meta/v1/unstructured"
+	"github.com/FlorianOtel/client-go/pkg/runtime"
+	"github.com/FlorianOtel/client-go/pkg/runtime/schema"
+	"github.com/FlorianOtel/client-go/pkg/watch"
+	"github.com/FlorianOtel/client-go/rest"
+	"github.com/FlorianOtel/client-go/tools/cache"
+)
+
+// ThirdPartyResources (TPRs) are watched dynamically: for each TPR definition (and each of its versions) an "unstructured" watcher is
+// started for the TPR instances -- and stopped again when the TPR definition is deleted. No typed client is needed for that.
+
+// ClientConfig is the REST client configuration used to create the (dynamic) clients for TPR instances. Set by the caller
+var ClientConfig *rest.Config
+
+// Clientset is used by the handlers that need to talk back to the API server -- e.g. the pre-flight permission checks of the
+// dynamic TPR watchers, or the CSR approvals. Set by the caller
+var Clientset *kubernetes.Clientset
+
+// TPRNamespace is the namespace the TPR instances are watched in. Empty for all namespaces
+var TPRNamespace = ""
+
+var (
+	tprWatchersMutex sync.Mutex
+	tprWatchers      = make(map[string]chan struct{}) // TPR "resource.group/version" -> stop channel of its instance watcher
+)
+
+// tprResource returns the group, kind and (plural, lowercase) resource name of a TPR.
+// E.g. "cron-tab.stable.example.com" is served as kind "CronTab", resource "crontabs", in API group "stable.example.com"
+func tprResource(tpr *apiv1beta1.ThirdPartyResource) (group, kind, resource string, err error) {
+	parts := strings.SplitN(tpr.Name, ".", 2)
+	if len(parts) != 2 {
+		return "", "", "", fmt.Errorf("invalid ThirdPartyResource name %q. Expected <kind>.<domain>", tpr.Name)
+	}
+
+	for _, word := range strings.Split(parts[0], "-") {
+		if word != "" {
+			kind += strings.ToUpper(word[:1]) + word[1:]
+		}
+	}
+	return parts[1], kind, strings.ToLower(kind) + "s", nil
+}
+
+// unstructuredSerializer decodes everything as unstructured objects -- but uses the standard (typed) stream serializer for the watch events themselves
+type unstructuredSerializer struct {
+	info runtime.SerializerInfo
+}
+
+func newUnstructuredSerializer() unstructuredSerializer {
+	var info runtime.SerializerInfo
+	for _, i := range api.Codecs.SupportedMediaTypes() {
+		if i.MediaType == runtime.ContentTypeJSON {
+			info = i
+			break
+		}
+	}
+	info.Serializer = unstructured.UnstructuredJSONScheme
+	info.PrettySerializer = nil
+	return unstructuredSerializer{info}
+}
+
+func (s unstructuredSerializer) SupportedMediaTypes() []runtime.SerializerInfo {
+	return []runtime.SerializerInfo{s.info}
+}
+
+func (s unstructuredSerializer) EncoderForVersion(serializer runtime.Encoder, gv runtime.GroupVersioner) runtime.Encoder {
+	return serializer
+}
+
+func (s unstructuredSerializer) DecoderToVersion(serializer runtime.Decoder, gv runtime.GroupVersioner) runtime.Decoder {
+	return serializer
+}
+
+// createUnstructuredController creates a controller for an arbitrary resource, whose objects are decoded as unstructured.Unstructured.
+// Like CreateResourceController, the rules are applied to its watch events -- as the given kind
+func createUnstructuredController(gv schema.GroupVersion, kind, resource, namespace string,
+	addFunc func(addedObj interface{}), deleteFunc func(deletedObj interface{}), updateFunc func(oldObj, updatedObj interface{})) (cache.Store, *cache.Controller, error) {
+
+	config := *ClientConfig
+	config.APIPath = "/apis"
+	config.GroupVersion = &gv
+	config.ContentType = runtime.ContentTypeJSON
+	config.AcceptContentTypes = runtime.ContentTypeJSON
+	config.NegotiatedSerializer = newUnstructuredSerializer()
+
+	client, err := rest.RESTClientFor(&config)
+	if err != nil {
+		return nil, nil, err
+	}
+
+	// N.B. Not using cache.NewListWatchFromClient: the standard parameter codec does not know how to convert the ListOptions to an unknown group / version
+	listWatch := &cache.ListWatch{
+		ListFunc: func(options apiv1.ListOptions) (runtime.Object, error) {
+			return client.Get().
+				Namespace(namespace).
+				Resource(resource).
+				Param("resourceVersion", options.ResourceVersion).
+				Do().
+				Get()
+		},
+		WatchFunc: func(options apiv1.ListOptions) (watch.Interface, error) {
+			req := client.Get().
+				Prefix("watch").
+				Namespace(namespace).
+				Resource(resource).
+				Param("resourceVersion", options.ResourceVersion)
+			if options.TimeoutSeconds != nil {
+				req = req.Param("timeoutSeconds", strconv.FormatInt(*options.TimeoutSeconds, 10))
+			}
+			return req.Watch()
+		},
+	}
+
+	registerRuleTarget(kind, client, resource)
+
+	handlers := cache.ResourceEventHandlerFuncs{
+		AddFunc: func(addedObj interface{}) {
+			addFunc(addedObj)
+			applyRules(kind, RuleCreated, addedObj)
+		},
+		DeleteFunc: func(deletedObj interface{}) {
+			deleteFunc(deletedObj)
+			applyRules(kind, RuleDeleted, deletedObj)
+		},
+		UpdateFunc: func(oldObj, updatedObj interface{}) {
+			updateFunc(oldObj, updatedObj)
+			applyRules(kind, RuleUpdated, updatedObj)
+		},
+	}
+
+	store, controller := cache.NewInformer(listWatch, &unstructured.Unstructured{}, time.Millisecond*0, handlers)
+	return store, controller, nil
+}
+
+// startTPRWatchers starts an instance watcher for each version of a TPR (unless already running)
+func startTPRWatchers(tpr *apiv1beta1.ThirdPartyResource) {
+	group, kind, resource, err := tprResource(tpr)
+	if err != nil {
+		glog.Errorf("Cannot watch ThirdPartyResource instances. Error: %s", err)
+		return
+	}
+
+	tprWatchersMutex.Lock()
+	defer tprWatchersMutex.Unlock()
+
+	for _, version := range tpr.Versions {
+		key := resource + "." + group + "/" + version.Name
+		if _, running := tprWatchers[key]; running {
+			continue
+		}
+
+		if Clientset != nil {
+			denied := DeniedResources(CheckAccess(Clientset, []WatchedResource{{Group: group, Resource: resource, Namespace: TPRNamespace}}))
+			if denied[ResourceName(group, resource)] {
+				glog.Warningf("Not watching %s instances (%s) -- missing list / watch permissions", kind, key)
+				continue
+			}
+		}
+
+		_, controller, err := createUnstructuredController(schema.GroupVersion{Group: group, Version: version.Name}, kind, resource, TPRNamespace,
+			func(addedObj interface{}) {
+				if err := ThirdPartyObjectCreated(addedObj.(*unstructured.Unstructured)); err != nil {
+					glog.Infof("Error while handling Add %s: %s ", kind, err)
+				}
+			},
+			func(deletedObj interface{}) {
+				if err := ThirdPartyObjectDeleted(deletedObj.(*unstructured.Unstructured)); err != nil {
+					glog.Infof("Error while handling Delete %s: %s ", kind, err)
+				}
+			},
+			func(oldObj, updatedObj interface{}) {
+				if err := ThirdPartyObjectUpdated(oldObj.(*unstructured.Unstructured), updatedObj.(*unstructured.Unstructured)); err != nil {
+					glog.Infof("Error while handling Update %s: %s ", kind, err)
+				}
+			})
+		if err != nil {
+			glog.Errorf("Error creating watcher for %s instances (%s). Error: %s", kind, key, err)
+			continue
+		}
+
+		stop := make(chan struct{})
+		tprWatchers[key] = stop
+		go controller.Run(stop)
+		glog.Infof(" ====> Watching %s instances (%s)", kind, key)
+	}
+}
+
+// stopTPRWatchers stops the instance watchers of a TPR. If "keep" is given, the watchers for those versions are left running
+func stopTPRWatchers(tpr *apiv1beta1.ThirdPartyResource, keep []apiv1beta1.APIVersion) {
+	group, _, resource, err := tprResource(tpr)
+	if err != nil {
+		return
+	}
+
+	tprWatchersMutex.Lock()
+	defer tprWatchersMutex.Unlock()
+
+	kept := make(map[string]bool)
+	for _, version := range keep {
+		kept[version.Name] = true
+	}
+
+	for _, version := range tpr.Versions {
+		key := resource + "." + group + "/" + version.Name
+		if stop, running := tprWatchers[key]; running && !kept[version.Name] {
+			close(stop)
+			delete(tprWatchers, key)
+			glog.Infof(" ====> Stopped watching %s", key)
+		}
+	}
+}
+
+func ThirdPartyResourceCreated(tpr *apiv1beta1.ThirdPartyResource) error {
+	glog.Info("=====> A thirdpartyresource got created")
+	JsonPrettyPrint("thirdpartyresource", tpr)
+	startTPRWatchers(tpr)
+	return nil
+}
+
+func ThirdPartyResourceDeleted(tpr *apiv1beta1.ThirdPartyResource) error {
+	glog.Info("=====> A thirdpartyresource got deleted")
+	JsonPrettyPrint("thirdpartyresource", tpr)
+	stopTPRWatchers(tpr, nil)
+	return nil
+}
+
+// Versions may be added to / removed from a TPR: start / stop the corresponding instance watchers
+func ThirdPartyResourceUpdated(old, updated *apiv1beta1.ThirdPartyResource) error {
+	if reflect.DeepEqual(old.Versions, updated.Versions) {
+		return nil
+	}
+	glog.Infof("=====> A thirdpartyresource got updated: %s", updated.Name)
+	stopTPRWatchers(old, updated.Versions)
+	startTPRWatchers(updated)
+	return nil
+}
+
+// Handlers for the TPR instances
+
+func ThirdPartyObjectCreated(obj *unstructured.Unstructured) error {
+	glog.Infof("=====> A %s got created", obj.GetKind())
+	JsonPrettyPrint("unstructured", obj)
+	return nil
+}
+
+func ThirdPartyObjectDeleted(obj *unstructured.Unstructured) error {
+	glog.Infof("=====> A %s got deleted", obj.GetKind())
+	JsonPrettyPrint("unstructured", obj)
+	return nil
+}
+
+// Only report updates of the object content -- not of its metadata (e.g. resourceVersion)
+func ThirdPartyObjectUpdated(old, updated *unstructured.Unstructured) error {
+	if reflect.DeepEqual(unstructuredContent(old), unstructuredContent(updated)) {
+		return nil
+	}
+	glog.Infof("=====> A %s got updated: %s", updated.GetKind(), objectName(updated.GetNamespace(), updated.GetName()))
+	JsonPrettyPrint("unstructured", updated)
+	return nil
+}
+
+// unstructuredContent returns the content of an unstructured object -- its "spec" if it has one, else everything but the type and object metadata
+func unstructuredContent(obj *unstructured.Unstructured) interface{} {
+	if spec, ok := obj.Object["spec"]; ok {
+		return spec
+	}
+	content := make(map[string]interface{})
+	for k, v := range obj.Object {
+		switch k {
+		case "apiVersion", "kind", "metadata":
+		default:
+			content[k] = v
+		}
+	}
+	return content
+}
@@ -0,0 +1,399 @@
+package handler
+
+import (
+	"fmt"
+	"io"
+	"net/http"
+	"sort"
+	"strings"
+	"sync"
+	"time"
+
+	apiv1 "github.com/FlorianOtel/client-go/pkg/api/v1"
+	metav1 "github.com/FlorianOtel/client-go/pkg/apis/meta/v1"
+)
+
+// Pod lifecycle timelines: per Pod, what happened and when -- from the Pod updates we observe, plus the Events about the Pod:
+// - "created", "scheduled" (to a node), "phase" (changes), "terminating" and "deleted"
+// - per container: "waiting" (with the reason, e.g. ContainerCreating or ImagePullBackOff), "started", "ready",
+//   "terminated" (with the exit code and reason) and "restarted"
+// - the Events, under their reason: e.g. "Pulling" / "Pulled" (image pulls), "Killing", "BackOff", "FailedScheduling"
+//
+// The Pods that already exist when we start have their timeline reconstructed from their status -- the timestamps it carries
+// (creation, scheduling, readiness, container starts / terminations) -- and the Events the API server still retains.
+// The entries without a timestamp of their own (e.g. "waiting", "phase") are timed when first observed.
+// Deleted Pods keep their timeline for TimelineRetention, and so do the Pods known from Events only (e.g. deleted before we started)
+// after their last entry. The timeline of a Pod replaced by another one with the same name is reset.
+
+// TimelineRetention is how long the timeline of a deleted -- or never observed -- Pod is kept
+var TimelineRetention = time.Hour
+
+// maxTimelineEntries caps the number of entries per Pod -- the oldest ones are dropped first
+const maxTimelineEntries = 500
+
+// TimelineEntry is an entry of a Pod timeline
+type TimelineEntry struct {
+	Time      time.Time `json:"time"`
+	Event     string    `json:"event"`
+	Container string    `json:"container,omitempty"`
+	Detail    string    `json:"detail,omitempty"`
+	Source    string    `json:"source"` // "pod" (observed Pod status) or "event"
+}
+
+// PodTimeline is the lifecycle timeline of a Pod
+type PodTimeline struct {
+	Namespace string          `json:"namespace"`
+	Name      string          `json:"name"`
+	UID       string          `json:"uid"`
+	Entries   []TimelineEntry `json:"entries"`
+}
+
+// podTimeline is a PodTimeline being recorded
+type podTimeline struct {
+	PodTimeline
+	keys     []string        // Keys of the Entries
+	seen     map[string]bool // Keys of the recorded entries -- so repeated observations are recorded once
+	observed map[string]bool // Keys derived from the last observed state of the Pod. nil if never observed
+	updated  time.Time       // When the last entry was recorded
+	deleted  time.Time
+}
+
+// timelineItem is a candidate timeline entry, with the key identifying it across observations
+type timelineItem struct {
+	key   string
+	entry TimelineEntry
+}
+
+var (
+	timelineMutex sync.Mutex
+	timelines     = make(map[string]*podTimeline) // "namespace/name" -> timeline
+)
+
+// timestamp returns the time of a timestamp -- or "now" if it's not set
+func timestamp(t metav1.Time, now time.Time) time.Time {
+	if t.IsZero() {
+		return now
+	}
+	return t.Time
+}
+
+// terminationDetail describes how a container terminated
+func terminationDetail(t *apiv1.ContainerStateTerminated) string {
+	detail := fmt.Sprintf("exit code %d", t.ExitCode)
+	if t.Signal != 0 {
+		detail += fmt.Sprintf(", signal %d", t.Signal)
+	}
+	if t.Reason != "" {
+		detail += " (" + t.Reason + ")"
+	}
+	if t.Message != "" {
+		detail += ": " + t.Message
+	}
+	return detail
+}
+
+// podTimelineItems derives the timeline entries from the current state of a Pod
+func podTimelineItems(pod *apiv1.Pod, now time.Time) []timelineItem {
+	var items []timelineItem
+	add := func(key string, e TimelineEntry) {
+		e.Source = "pod"
+		items = append(items, timelineItem{key, e})
+	}
+
+	add("created", TimelineEntry{Time: timestamp(pod.CreationTimestamp, now), Event: "created"})
+
+	var readyAt time.Time
+	for _, c := range pod.Status.Conditions {
+		switch {
+		case c.Type == apiv1.PodScheduled && c.Status == apiv1.ConditionTrue:
+			add("scheduled", TimelineEntry{Time: timestamp(c.LastTransitionTime, now), Event: "scheduled", Detail: "to node " + pod.Spec.NodeName})
+		case c.Type == apiv1.PodReady:
+			event, detail := "ready", ""
+			if c.Status != apiv1.ConditionTrue {
+				event, detail = "not-ready", strings.TrimSpace(c.Reason+" "+c.Message)
+			} else {
+				readyAt = timestamp(c.LastTransitionTime, now)
+			}
+			add(fmt.Sprintf("%s|%s", event, c.LastTransitionTime), TimelineEntry{Time: timestamp(c.LastTransitionTime, now), Event: event, Detail: detail})
+		}
+	}
+	if pod.Spec.NodeName != "" {
+		// Pods bound directly to a node (e.g. static Pods) may have no PodScheduled condition
+		add("scheduled", TimelineEntry{Time: now, Event: "scheduled", Detail: "to node " + pod.Spec.NodeName})
+	}
+	if pod.Status.Phase != "" {
+		add("phase|"+string(pod.Status.Phase), TimelineEntry{Time: now, Event: "phase", Detail: string(pod.Status.Phase)})
+	}
+
+	statuses := append(append([]apiv1.ContainerStatus{}, pod.Status.InitContainerStatuses...), pod.Status.ContainerStatuses...)
+	for _, cs := range statuses {
+		prefix := fmt.Sprintf("%s|%d|", cs.Name, cs.RestartCount)
+
+		if t := cs.LastTerminationState.Terminated; t != nil {
+			add(fmt.Sprintf("terminated|%s|%s|%s", cs.Name, t.ContainerID, t.FinishedAt), TimelineEntry{Time: timestamp(t.FinishedAt, now),
+				Event: "terminated", Container: cs.Name, Detail: terminationDetail(t)})
+		}
+		if cs.RestartCount > 0 {
+			restartedAt := now
+			if t := cs.LastTerminationState.Terminated; t != nil {
+				restartedAt = timestamp(t.FinishedAt, now)
+			}
+			add("restarted|"+prefix, TimelineEntry{Time: restartedAt, Event: "restarted", Container: cs.Name, Detail: fmt.Sprintf("restart #%d", cs.RestartCount)})
+		}
+
+		switch {
+		case cs.State.Waiting != nil:
+			w := cs.State.Waiting
+			add("waiting|"+prefix+w.Reason, TimelineEntry{Time: now, Event: "waiting", Container: cs.Name, Detail: strings.TrimSpace(w.Reason + " " + w.Message)})
+		case cs.State.Running != nil:
+			add(fmt.Sprintf("started|%s|%s", cs.Name, cs.State.Running.StartedAt), TimelineEntry{Time: timestamp(cs.State.Running.StartedAt, now),
+				Event: "started", Container: cs.Name, Detail: "image " + cs.Image})
+		case cs.State.Terminated != nil:
+			t := cs.State.Terminated
+			add(fmt.Sprintf("terminated|%s|%s|%s", cs.Name, t.ContainerID, t.FinishedAt), TimelineEntry{Time: timestamp(t.FinishedAt, now),
+				Event: "terminated", Container: cs.Name, Detail: terminationDetail(t)})
+		}
+
+		if cs.Ready {
+			// Containers have no readiness timestamp: use the Pod's, if it's ready
+			at := now
+			if !readyAt.IsZero() {
+				at = readyAt
+			}
+			add("ready|"+prefix, TimelineEntry{Time: at, Event: "ready", Container: cs.Name})
+		}
+	}
+
+	if pod.DeletionTimestamp != nil {
+		detail := ""
+		if pod.DeletionGracePeriodSeconds != nil {
+			detail = fmt.Sprintf("grace period %ds", *pod.DeletionGracePeriodSeconds)
+		}
+		add("terminating", TimelineEntry{Time: now, Event: "terminating", Detail: detail})
+	}
+
+	return items
+}
+
+// eventContainer returns the container an Event is about, if any -- from its field path, e.g. "spec.containers{web}"
+func eventContainer(fieldPath string) string {
+	start, end := strings.Index(fieldPath, "{"), strings.LastIndex(fieldPath, "}")
+	if start < 0 || end < start {
+		return ""
+	}
+	return fieldPath[start+1 : end]
+}
+
+// timelineFor returns the timeline of a Pod, created -- or reset, if the Pod was replaced -- as needed. The timelineMutex must be held
+func timelineFor(namespace, name, uid string) *podTimeline {
+	key := objectName(namespace, name)
+	t, ok := timelines[key]
+	if !ok || (uid != "" && t.UID != "" && t.UID != uid) {
+		t = &podTimeline{PodTimeline: PodTimeline{Namespace: namespace, Name: name, UID: uid}, seen: make(map[string]bool)}
+		timelines[key] = t
+	}
+	if t.UID == "" {
+		t.UID = uid
+	}
+	return t
+}
+
+// record adds the items not recorded yet to a timeline, and returns the corresponding entries. The timelineMutex must be held
+//
+// Past maxTimelineEntries, the keys of the dropped entries are forgotten too -- except the ones derived from the last observed
+// state of the Pod (e.g. "created"), which would otherwise be recorded again on the next Pod update
+func (t *podTimeline) record(items []timelineItem, now time.Time) []TimelineEntry {
+	var added []TimelineEntry
+	for _, item := range items {
+		if t.seen[item.key] {
+			continue
+		}
+		t.seen[item.key] = true
+		t.Entries = append(t.Entries, item.entry)
+		t.keys = append(t.keys, item.key)
+		added = append(added, item.entry)
+	}
+	if len(added) > 0 {
+		t.updated = now
+	}
+	if len(t.Entries) > maxTimelineEntries {
+		drop := len(t.Entries) - maxTimelineEntries
+		for _, key := range t.keys[:drop] {
+			if !t.observed[key] {
+				delete(t.seen, key)
+			}
+		}
+		t.Entries = append([]TimelineEntry{}, t.Entries[drop:]...)
+		t.keys = append([]string{}, t.keys[drop:]...)
+	}
+	return added
+}
+
+// observe records the items derived from the current state of a Pod. The timelineMutex must be held
+func (t *podTimeline) observe(items []timelineItem, now time.Time) []TimelineEntry {
+	t.observed = make(map[string]bool, len(items))
+	for _, item := range items {
+		t.observed[item.key] = true
+	}
+	return t.record(items, now)
+}
+
+// expireTimelines drops the timelines of the Pods deleted more than TimelineRetention ago, and of the Pods known from Events
+// only with no entry for TimelineRetention. The timelineMutex must be held
+func expireTimelines(now time.Time) {
+	for key, t := range timelines {
+		if (!t.deleted.IsZero() && now.Sub(t.deleted) > TimelineRetention) ||
+			(t.observed == nil && now.Sub(t.updated) > TimelineRetention) {
+			delete(timelines, key)
+		}
+	}
+}
+
+// recordPodTimeline records the timeline entries derived from the current state of a Pod, and returns the new ones
+func recordPodTimeline(pod *apiv1.Pod) []TimelineEntry {
+	timelineMutex.Lock()
+	defer timelineMutex.Unlock()
+	now := time.Now()
+	return timelineFor(pod.Namespace, pod.Name, string(pod.UID)).observe(podTimelineItems(pod, now), now)
+}
+
+// recordPodDeleted records the deletion of a Pod, and expires the timelines past their retention
+func recordPodDeleted(pod *apiv1.Pod) {
+	timelineMutex.Lock()
+	defer timelineMutex.Unlock()
+
+	now := time.Now()
+	t := timelineFor(pod.Namespace, pod.Name, string(pod.UID))
+	t.observe(append(podTimelineItems(pod, now), timelineItem{"deleted", TimelineEntry{Time: now, Event: "deleted", Source: "pod"}}), now)
+	t.deleted = now
+	expireTimelines(now)
+}
+
+// recordPodEvent records an Event about a Pod. Events about a previous Pod with the same name are ignored
+func recordPodEvent(ev *apiv1.Event) {
+	obj := ev.InvolvedObject
+	if obj.Kind != "Pod" {
+		return
+	}
+
+	timelineMutex.Lock()
+	defer timelineMutex.Unlock()
+
+	if t, ok := timelines[objectName(obj.Namespace, obj.Name)]; ok && obj.UID != "" && t.UID != "" && t.UID != string(obj.UID) {
+		return
+	}
+	detail := ev.Message
+	if ev.Count > 1 {
+		detail += fmt.Sprintf(" (x%d)", ev.Count)
+	}
+	now := time.Now()
+	timelineFor(obj.Namespace, obj.Name, string(obj.UID)).record([]timelineItem{{
+		key: fmt.Sprintf("event|%s|%d", ev.Name, ev.Count),
+		entry: TimelineEntry{Time: timestamp(ev.LastTimestamp, now), Event: ev.Reason, Container: eventContainer(obj.FieldPath),
+			Detail: detail, Source: "event"},
+	}}, now)
+	expireTimelines(now)
+}
+
+// snapshot returns a copy of a timeline, with the entries sorted by time. The timelineMutex must be held
+func (t *podTimeline) snapshot() PodTimeline {
+	s := t.PodTimeline
+	s.Entries = append([]TimelineEntry{}, t.Entries...)
+	sort.SliceStable(s.Entries, func(i, j int) bool { return s.Entries[i].Time.Before(s.Entries[j].Time) })
+	return s
+}
+
+// GetPodTimeline returns the timeline of a Pod, given as "namespace/name"
+func GetPodTimeline(pod string) (PodTimeline, error) {
+	parts := strings.Split(pod, "/")
+	if len(parts) != 2 || parts[0] == "" || parts[1] == "" {
+		return PodTimeline{}, fmt.Errorf("invalid pod %q. Expected: namespace/name", pod)
+	}
+
+	timelineMutex.Lock()
+	defer timelineMutex.Unlock()
+
+	t, ok := timelines[pod]
+	if !ok {
+		return PodTimeline{}, fmt.Errorf("no timeline for pod %s", pod)
+	}
+	return t.snapshot(), nil
+}
+
+// PodTimelines returns the timelines of the Pods of a namespace -- or of all namespaces if "namespace" is empty
+func PodTimelines(namespace string) []PodTimeline {
+	timelineMutex.Lock()
+	defer timelineMutex.Unlock()
+
+	result := []PodTimeline{}
+	for _, t := range timelines {
+		if namespace == "" || t.Namespace == namespace {
+			result = append(result, t.snapshot())
+		}
+	}
+	sort.Slice(result, func(i, j int) bool {
+		return objectName(result[i].Namespace, result[i].Name) < objectName(result[j].Namespace, result[j].Name)
+	})
+	return result
+}
+
+// printTimelineEntries prints timeline entries, one per line
+func printTimelineEntries(w io.Writer, entries []TimelineEntry) {
+	for _, e := range entries {
+		what := e.Event
+		if e.Container != "" {
+			what += " [" + e.Container + "]"
+		}
+		if e.Detail != "" {
+			what += ": " + e.Detail
+		}
+		fmt.Fprintf(w, "  %s  %-6s %s\n", e.Time.UTC().Format(time.RFC3339), e.Source, what)
+	}
+}
+
+// PrintPodTimeline prints the timeline of a Pod
+func PrintPodTimeline(w io.Writer, t PodTimeline) {
+	fmt.Fprintf(w, "Timeline of pod %s (uid %s):\n", objectName(t.Namespace, t.Name), t.UID)
+	if len(t.Entries) == 0 {
+		fmt.Fprintf(w, "  <no entries>\n")
+	}
+	printTimelineEntries(w, t.Entries)
+}
+
+// WritePodTimeline writes the timeline of a Pod as "text" or "json"
+func WritePodTimeline(w io.Writer, t PodTimeline, format string) error {
+	switch format {
+	case "json":
+		return writeIndentedJSON(w, t)
+	case "text":
+		PrintPodTimeline(w, t)
+		return nil
+	default:
+		return fmt.Errorf("invalid format %q. Expected one of: text, json", format)
+	}
+}
+
+// PodTimelineHandler serves the Pod timelines over HTTP: /timeline?pod=namespace/name[&format=text] for a Pod, or
+// /timeline[?namespace=default] for all the Pods
+func PodTimelineHandler(w http.ResponseWriter, r *http.Request) {
+	q := r.URL.Query()
+	if q.Get("pod") == "" {
+		writeJSON(w, PodTimelines(q.Get("namespace")))
+		return
+	}
+
+	t, err := GetPodTimeline(q.Get("pod"))
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusNotFound)
+		return
+	}
+	switch q.Get("format") {
+	case "", "json":
+		writeJSON(w, t)
+	case "text":
+		w.Header().Set("Content-Type", "text/plain")
+		PrintPodTimeline(w, t)
+	default:
+		http.Error(w, fmt.Sprintf("invalid format %q. Expected one of: text, json", q.Get("format")), http.StatusBadRequest)
+	}
+}
@@ -0,0 +1,96 @@
+package handler
+
+import (
+	"fmt"
+	"testing"
+	"time"
+
+	apiv1 "github.com/FlorianOtel/client-go/pkg/api/v1"
+)
+
+// withTimelines replaces the recorded timelines for the duration of a test
+func withTimelines(t *testing.T) {
+	timelineMutex.Lock()
+	saved := timelines
+	timelines = make(map[string]*podTimeline)
+	timelineMutex.Unlock()
+	t.Cleanup(func() {
+		timelineMutex.Lock()
+		timelines = saved
+		timelineMutex.Unlock()
+	})
+}
+
+// podEvent returns an Event about the Pod default/name
+func podEvent(name, pod string) *apiv1.Event {
+	return &apiv1.Event{
+		ObjectMeta:     apiv1.ObjectMeta{Namespace: "default", Name: name},
+		InvolvedObject: apiv1.ObjectReference{Kind: "Pod", Namespace: "default", Name: pod},
+		Reason:         "BackOff",
+		Count:          1,
+	}
+}
+
+func TestExpireTimelines(t *testing.T) {
+	withTimelines(t)
+	now := time.Now()
+	old := now.Add(-TimelineRetention - time.Minute)
+
+	timelineMutex.Lock()
+	defer timelineMutex.Unlock()
+	timelineFor("default", "events-only", "").record([]timelineItem{{key: "event|a|1"}}, old)
+	timelineFor("default", "events-recent", "").record([]timelineItem{{key: "event|b|1"}}, now)
+	timelineFor("default", "running", "1").observe([]timelineItem{{key: "created"}}, old)
+	deleted := timelineFor("default", "deleted", "2")
+	deleted.observe([]timelineItem{{key: "created"}}, old)
+	deleted.deleted = old
+
+	expireTimelines(now)
+	for name, kept := range map[string]bool{"events-only": false, "events-recent": true, "running": true, "deleted": false} {
+		if _, ok := timelines[objectName("default", name)]; ok != kept {
+			t.Errorf("%s: expected kept %v, got %v", name, kept, ok)
+		}
+	}
+}
+
+func TestRecordPodEventExpiresTimelines(t *testing.T) {
+	withTimelines(t)
+	timelineMutex.Lock()
+	timelineFor("default", "gone", "").record([]timelineItem{{key: "event|a|1"}}, time.Now().Add(-TimelineRetention-time.Minute))
+	timelineMutex.Unlock()
+
+	recordPodEvent(podEvent("b", "web"))
+
+	timelineMutex.Lock()
+	defer timelineMutex.Unlock()
+	if _, ok := timelines[objectName("default", "gone")]; ok {
+		t.Errorf("expected the stale events-only timeline to be dropped")
+	}
+	if _, ok := timelines[objectName("default", "web")]; !ok {
+		t.Errorf("expected a timeline for default/web")
+	}
+}
+
+func TestRecordPrunesSeen(t *testing.T) {
+	withTimelines(t)
+	timelineMutex.Lock()
+	defer timelineMutex.Unlock()
+
+	now := time.Now()
+	tl := timelineFor("default", "web", "1")
+	tl.observe([]timelineItem{{key: "created", entry: TimelineEntry{Event: "created"}}}, now)
+	for i := 0; i < 2*maxTimelineEntries; i++ {
+		tl.record([]timelineItem{{key: fmt.Sprintf("event|a|%d", i)}}, now)
+	}
+
+	if len(tl.Entries) != maxTimelineEntries || len(tl.keys) != maxTimelineEntries {
+		t.Fatalf("expected %d entries, got %d (%d keys)", maxTimelineEntries, len(tl.Entries), len(tl.keys))
+	}
+	// The retained entries, plus "created" -- still derived from the Pod
+	if len(tl.seen) != maxTimelineEntries+1 {
+		t.Errorf("expected %d seen keys, got %d", maxTimelineEntries+1, len(tl.seen))
+	}
+	if added := tl.observe([]timelineItem{{key: "created", entry: TimelineEntry{Event: "created"}}}, now); len(added) != 0 {
+		t.Errorf("expected \"created\" not to be recorded again, got %v", added)
+	}
+}
@@ -0,0 +1,207 @@
+package handler
+
+import (
+	"fmt"
+	"io"
+	"net/http"
+	"sort"
+	"strings"
+
+	apiv1 "github.com/FlorianOtel/client-go/pkg/api/v1"
+	"github.com/FlorianOtel/client-go/pkg/labels"
+)
+
+// Topology graph: namespaces, Services, Pods and (cluster) Nodes -- from the caches -- and how they relate:
+// - "contains":  a namespace contains a Service / Pod
+// - "selects":   a Service selects a Pod (selector membership)
+// - "placed-on": a Pod is scheduled on a Node
+// - "allows":    a NetworkPolicy admits traffic from a Pod to another one, on the ports the destination containers declare.
+//                Flows to Pods in non-isolated namespaces -- i.e. everything -- are left out, so the graph stays readable
+
+// GraphNode is a node of the topology graph
+type GraphNode struct {
+	ID        string `json:"id"`   // E.g. "pod:default/web-1"
+	Kind      string `json:"kind"` // "namespace", "service", "pod" or "node"
+	Name      string `json:"name"`
+	Namespace string `json:"namespace,omitempty"`
+}
+
+// GraphEdge is an edge of the topology graph
+type GraphEdge struct {
+	From  string `json:"from"`
+	To    string `json:"to"`
+	Kind  string `json:"kind"` // "contains", "selects", "placed-on" or "allows"
+	Label string `json:"label,omitempty"`
+}
+
+// TopologyGraph is the topology graph, in a node / edge format suitable for (web) visualisers
+type TopologyGraph struct {
+	Nodes []GraphNode `json:"nodes"`
+	Edges []GraphEdge `json:"edges"`
+}
+
+// graphID returns the ID of a graph node
+func graphID(kind, namespace, name string) string {
+	return kind + ":" + objectName(namespace, name)
+}
+
+// BuildTopology builds the topology graph of a namespace -- or of all namespaces if "namespace" is empty
+func BuildTopology(namespace string) TopologyGraph {
+	g := TopologyGraph{Nodes: []GraphNode{}, Edges: []GraphEdge{}}
+	known := make(map[string]bool)
+
+	addNode := func(kind, ns, name string) string {
+		id := graphID(kind, ns, name)
+		if !known[id] {
+			known[id] = true
+			g.Nodes = append(g.Nodes, GraphNode{ID: id, Kind: kind, Name: name, Namespace: ns})
+		}
+		return id
+	}
+
+	var pods []*apiv1.Pod
+	for _, pod := range cachedPods() {
+		if (namespace == "" || pod.Namespace == namespace) && !podTerminated(pod) {
+			pods = append(pods, pod)
+		}
+	}
+
+	for _, pod := range pods {
+		id := addNode("pod", pod.Namespace, pod.Name)
+		g.Edges = append(g.Edges, GraphEdge{From: addNode("namespace", "", pod.Namespace), To: id, Kind: "contains"})
+		if pod.Spec.NodeName != "" {
+			g.Edges = append(g.Edges, GraphEdge{From: id, To: addNode("node", "", pod.Spec.NodeName), Kind: "placed-on"})
+		}
+	}
+
+	if ServiceStore != nil {
+		var services []*apiv1.Service
+		for _, obj := range ServiceStore.List() {
+			svc := obj.(*apiv1.Service)
+			if namespace == "" || svc.Namespace == namespace {
+				services = append(services, svc)
+			}
+		}
+		sort.Slice(services, func(i, j int) bool {
+			return objectName(services[i].Namespace, services[i].Name) < objectName(services[j].Namespace, services[j].Name)
+		})
+
+		for _, svc := range services {
+			id := addNode("service", svc.Namespace, svc.Name)
+			g.Edges = append(g.Edges, GraphEdge{From: addNode("namespace", "", svc.Namespace), To: id, Kind: "contains"})
+			if len(svc.Spec.Selector) == 0 {
+				continue // Services without selectors have manually managed endpoints
+			}
+			selector := labels.SelectorFromSet(labels.Set(svc.Spec.Selector))
+			for _, pod := range pods {
+				if pod.Namespace == svc.Namespace && selector.Matches(labels.Set(pod.Labels)) {
+					g.Edges = append(g.Edges, GraphEdge{From: id, To: graphID("pod", pod.Namespace, pod.Name), Kind: "selects"})
+				}
+			}
+		}
+	}
+
+	// Also list the Nodes without any (cached) Pods
+	if NodeStore != nil && namespace == "" {
+		for _, obj := range NodeStore.List() {
+			addNode("node", "", obj.(*apiv1.Node).Name)
+		}
+	}
+
+	policies := CachedNetworkPolicies()
+	for _, dst := range pods {
+		if !namespaceIsolated(dst.Namespace) {
+			continue
+		}
+		ports := declaredPorts(dst)
+		for _, src := range pods {
+			if src == dst {
+				continue
+			}
+			var allowed []string
+			for _, port := range ports {
+				if EvaluateIngress(policies, src, dst, port).Allowed {
+					allowed = append(allowed, port.String())
+				}
+			}
+			if len(allowed) > 0 {
+				g.Edges = append(g.Edges, GraphEdge{From: graphID("pod", src.Namespace, src.Name), To: graphID("pod", dst.Namespace, dst.Name),
+					Kind: "allows", Label: strings.Join(allowed, ",")})
+			}
+		}
+	}
+
+	sort.SliceStable(g.Nodes, func(i, j int) bool { return g.Nodes[i].ID < g.Nodes[j].ID })
+	return g
+}
+
+// declaredPorts returns the ports declared by the containers of a Pod
+func declaredPorts(pod *apiv1.Pod) []FlowPort {
+	var ports []FlowPort
+	for _, c := range pod.Spec.Containers {
+		for _, p := range c.Ports {
+			protocol := p.Protocol
+			if protocol == "" {
+				protocol = apiv1.ProtocolTCP
+			}
+			ports = append(ports, FlowPort{protocol, p.ContainerPort})
+		}
+	}
+	return ports
+}
+
+// graphShapes are the Graphviz shapes of the graph nodes, per kind
+var graphShapes = map[string]string{
+	"namespace": "folder",
+	"service":   "ellipse",
+	"pod":       "box",
+	"node":      "box3d",
+}
+
+// graphStyles are the Graphviz styles of the graph edges, per kind
+var graphStyles = map[string]string{
+	"contains":  "dotted",
+	"selects":   "solid",
+	"placed-on": "dashed",
+	"allows":    "bold",
+}
+
+// WriteTopology writes the topology graph as "dot" (Graphviz) or "json"
+func WriteTopology(w io.Writer, g TopologyGraph, format string) error {
+	switch format {
+	case "json":
+		return writeIndentedJSON(w, g)
+	case "dot":
+		fmt.Fprintf(w, "digraph topology {\n")
+		for _, n := range g.Nodes {
+			fmt.Fprintf(w, "  %q [label=%q, shape=%s];\n", n.ID, n.Kind+"\n"+objectName(n.Namespace, n.Name), graphShapes[n.Kind])
+		}
+		for _, e := range g.Edges {
+			label := e.Kind
+			if e.Label != "" {
+				label += " " + e.Label
+			}
+			fmt.Fprintf(w, "  %q -> %q [label=%q, style=%s];\n", e.From, e.To, label, graphStyles[e.Kind])
+		}
+		fmt.Fprintf(w, "}\n")
+		return nil
+	default:
+		return fmt.Errorf("invalid format %q. Expected one of: dot, json", format)
+	}
+}
+
+// TopologyHandler serves the topology graph over HTTP, e.g. /topology[?namespace=default][&format=dot]
+func TopologyHandler(w http.ResponseWriter, r *http.Request) {
+	q := r.URL.Query()
+	g := BuildTopology(q.Get("namespace"))
+
+	switch q.Get("format") {
+	case "", "json":
+		writeJSON(w, g)
+	case "dot":
+		w.Header().Set("Content-Type", "text/vnd.graphviz")
+		WriteTopology(w, g, "dot")
+	default:
+		http.Error(w, fmt.Sprintf("invalid format %q. Expected one of: dot, json", q.Get("format")), http.StatusBadRequest)
+	}
+}
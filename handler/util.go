@@ -3,12 +3,23 @@ package handler
 import (
 	"encoding/json"
 	"fmt"
+	"io"
+	"net/http"
+	"sort"
+	"strings"
 
 	"github.com/golang/glog"
 	//
 
 	apiv1 "github.com/FlorianOtel/client-go/pkg/api/v1"
+	appsv1beta1 "github.com/FlorianOtel/client-go/pkg/apis/apps/v1beta1"
+	autoscalingv1 "github.com/FlorianOtel/client-go/pkg/apis/autoscaling/v1"
+	certificatesv1alpha1 "github.com/FlorianOtel/client-go/pkg/apis/certificates/v1alpha1"
 	apiv1beta1 "github.com/FlorianOtel/client-go/pkg/apis/extensions/v1beta1"
+	"github.com/FlorianOtel/client-go/pkg/apis/meta/v1/unstructured"
+	policyv1beta1 "github.com/FlorianOtel/client-go/pkg/apis/policy/v1beta1"
+	rbacv1alpha1 "github.com/FlorianOtel/client-go/pkg/apis/rbac/v1alpha1"
+	storagev1beta1 "github.com/FlorianOtel/client-go/pkg/apis/storage/v1beta1"
 	"github.com/FlorianOtel/client-go/pkg/runtime"
 	// "github.com/FlorianOtel/client-go/pkg/util/wait"
 )
@@ -35,6 +46,99 @@ func JsonPrettyPrint(resource string, obj runtime.Object) error {
 	case "networkpolicy":
 		meta = obj.(*apiv1beta1.NetworkPolicy).ObjectMeta
 		jsonspec, err = json.MarshalIndent(obj.(*apiv1beta1.NetworkPolicy).Spec, "", " ")
+	case "deployment":
+		meta = obj.(*apiv1beta1.Deployment).ObjectMeta
+		jsonspec, err = json.MarshalIndent(obj.(*apiv1beta1.Deployment).Spec, "", " ")
+	case "daemonset":
+		meta = obj.(*apiv1beta1.DaemonSet).ObjectMeta
+		jsonspec, err = json.MarshalIndent(obj.(*apiv1beta1.DaemonSet).Spec, "", " ")
+	case "statefulset":
+		meta = obj.(*appsv1beta1.StatefulSet).ObjectMeta
+		jsonspec, err = json.MarshalIndent(obj.(*appsv1beta1.StatefulSet).Spec, "", " ")
+	case "podsecuritypolicy":
+		meta = obj.(*apiv1beta1.PodSecurityPolicy).ObjectMeta
+		jsonspec, err = json.MarshalIndent(obj.(*apiv1beta1.PodSecurityPolicy).Spec, "", " ")
+	case "configmap":
+		// ConfigMaps have no "Spec" -- print the data instead
+		meta = obj.(*apiv1.ConfigMap).ObjectMeta
+		jsonspec, err = json.MarshalIndent(obj.(*apiv1.ConfigMap).Data, "", " ")
+	case "secret":
+		// Never print the Secret data -- only the key names, sizes and hashes. Nor the annotation "kubectl apply" copies it to
+		meta = RedactSecretMeta(obj.(*apiv1.Secret))
+		jsonspec, err = json.MarshalIndent(RedactSecret(obj.(*apiv1.Secret)), "", " ")
+	case "serviceaccount":
+		meta = obj.(*apiv1.ServiceAccount).ObjectMeta
+		jsonspec, err = json.MarshalIndent(map[string]interface{}{
+			"secrets":          obj.(*apiv1.ServiceAccount).Secrets,
+			"imagePullSecrets": obj.(*apiv1.ServiceAccount).ImagePullSecrets,
+		}, "", " ")
+	case "persistentvolume":
+		meta = obj.(*apiv1.PersistentVolume).ObjectMeta
+		jsonspec, err = json.MarshalIndent(obj.(*apiv1.PersistentVolume).Spec, "", " ")
+	case "persistentvolumeclaim":
+		meta = obj.(*apiv1.PersistentVolumeClaim).ObjectMeta
+		jsonspec, err = json.MarshalIndent(obj.(*apiv1.PersistentVolumeClaim).Spec, "", " ")
+	case "storageclass":
+		// StorageClasses have no "Spec" -- print the provisioner and its parameters instead
+		meta = obj.(*storagev1beta1.StorageClass).ObjectMeta
+		jsonspec, err = json.MarshalIndent(map[string]interface{}{
+			"provisioner": obj.(*storagev1beta1.StorageClass).Provisioner,
+			"parameters":  obj.(*storagev1beta1.StorageClass).Parameters,
+		}, "", " ")
+	case "role":
+		// RBAC objects have no "Spec" -- print the rules / subjects instead
+		meta = obj.(*rbacv1alpha1.Role).ObjectMeta
+		jsonspec, err = json.MarshalIndent(obj.(*rbacv1alpha1.Role).Rules, "", " ")
+	case "clusterrole":
+		meta = obj.(*rbacv1alpha1.ClusterRole).ObjectMeta
+		jsonspec, err = json.MarshalIndent(obj.(*rbacv1alpha1.ClusterRole).Rules, "", " ")
+	case "rolebinding":
+		meta = obj.(*rbacv1alpha1.RoleBinding).ObjectMeta
+		jsonspec, err = json.MarshalIndent(map[string]interface{}{
+			"subjects": obj.(*rbacv1alpha1.RoleBinding).Subjects,
+			"roleRef":  obj.(*rbacv1alpha1.RoleBinding).RoleRef,
+		}, "", " ")
+	case "clusterrolebinding":
+		meta = obj.(*rbacv1alpha1.ClusterRoleBinding).ObjectMeta
+		jsonspec, err = json.MarshalIndent(map[string]interface{}{
+			"subjects": obj.(*rbacv1alpha1.ClusterRoleBinding).Subjects,
+			"roleRef":  obj.(*rbacv1alpha1.ClusterRoleBinding).RoleRef,
+		}, "", " ")
+	case "resourcequota":
+		meta = obj.(*apiv1.ResourceQuota).ObjectMeta
+		jsonspec, err = json.MarshalIndent(obj.(*apiv1.ResourceQuota).Spec, "", " ")
+	case "limitrange":
+		meta = obj.(*apiv1.LimitRange).ObjectMeta
+		jsonspec, err = json.MarshalIndent(obj.(*apiv1.LimitRange).Spec, "", " ")
+	case "node":
+		meta = obj.(*apiv1.Node).ObjectMeta
+		jsonspec, err = json.MarshalIndent(obj.(*apiv1.Node).Spec, "", " ")
+	case "horizontalpodautoscaler":
+		meta = obj.(*autoscalingv1.HorizontalPodAutoscaler).ObjectMeta
+		jsonspec, err = json.MarshalIndent(obj.(*autoscalingv1.HorizontalPodAutoscaler).Spec, "", " ")
+	case "poddisruptionbudget":
+		meta = obj.(*policyv1beta1.PodDisruptionBudget).ObjectMeta
+		jsonspec, err = json.MarshalIndent(obj.(*policyv1beta1.PodDisruptionBudget).Spec, "", " ")
+	case "thirdpartyresource":
+		meta = obj.(*apiv1beta1.ThirdPartyResource).ObjectMeta
+		jsonspec, err = json.MarshalIndent(map[string]interface{}{
+			"description": obj.(*apiv1beta1.ThirdPartyResource).Description,
+			"versions":    obj.(*apiv1beta1.ThirdPartyResource).Versions,
+		}, "", " ")
+	case "certificatesigningrequest":
+		// The decoded request rather than the raw (PEM) one
+		meta = obj.(*certificatesv1alpha1.CertificateSigningRequest).ObjectMeta
+		jsonspec, err = json.MarshalIndent(csrInfo(obj.(*certificatesv1alpha1.CertificateSigningRequest)), "", " ")
+	case "unstructured":
+		// Generic (e.g. ThirdPartyResource instances): decode the metadata, and print the "spec" -- or the whole content if there is no "spec"
+		u := obj.(*unstructured.Unstructured)
+		resource = u.GetKind()
+		if jsonmeta, err = json.Marshal(u.Object["metadata"]); err == nil {
+			err = json.Unmarshal(jsonmeta, &meta)
+		}
+		if err == nil {
+			jsonspec, err = json.MarshalIndent(unstructuredContent(u), "", " ")
+		}
 	default:
 		glog.Errorf("Don't know how to pretty-print API object: %s", resource)
 	}
@@ -55,3 +159,93 @@ func JsonPrettyPrint(resource string, obj runtime.Object) error {
 
 	return err
 }
+
+// diffKeys compares two key / value maps and returns the (sorted) keys that were added, removed, or whose values changed
+func diffKeys(old, updated map[string]string) (added, removed, changed []string) {
+	for k, v := range updated {
+		ov, ok := old[k]
+		switch {
+		case !ok:
+			added = append(added, k)
+		case ov != v:
+			changed = append(changed, k)
+		}
+	}
+	for k := range old {
+		if _, ok := updated[k]; !ok {
+			removed = append(removed, k)
+		}
+	}
+	sort.Strings(added)
+	sort.Strings(removed)
+	sort.Strings(changed)
+	return added, removed, changed
+}
+
+// diffLines does a (naive, LCS-based) line-by-line diff of two strings. Lines are prefixed by "-", "+" or " " (unchanged)
+func diffLines(old, updated string) []string {
+	a := strings.Split(old, "\n")
+	b := strings.Split(updated, "\n")
+
+	// lcs[i][j] is the length of the longest common subsequence of a[i:] and b[j:]
+	lcs := make([][]int, len(a)+1)
+	for i := range lcs {
+		lcs[i] = make([]int, len(b)+1)
+	}
+	for i := len(a) - 1; i >= 0; i-- {
+		for j := len(b) - 1; j >= 0; j-- {
+			if a[i] == b[j] {
+				lcs[i][j] = lcs[i+1][j+1] + 1
+			} else if lcs[i+1][j] >= lcs[i][j+1] {
+				lcs[i][j] = lcs[i+1][j]
+			} else {
+				lcs[i][j] = lcs[i][j+1]
+			}
+		}
+	}
+
+	var out []string
+	i, j := 0, 0
+	for i < len(a) && j < len(b) {
+		switch {
+		case a[i] == b[j]:
+			out = append(out, " "+a[i])
+			i++
+			j++
+		case lcs[i+1][j] >= lcs[i][j+1]:
+			out = append(out, "-"+a[i])
+			i++
+		default:
+			out = append(out, "+"+b[j])
+			j++
+		}
+	}
+	for ; i < len(a); i++ {
+		out = append(out, "-"+a[i])
+	}
+	for ; j < len(b); j++ {
+		out = append(out, "+"+b[j])
+	}
+	return out
+}
+
+// writeIndentedJSON writes a value as indented JSON, followed by a newline
+func writeIndentedJSON(w io.Writer, v interface{}) error {
+	b, err := json.MarshalIndent(v, "", " ")
+	if err != nil {
+		return err
+	}
+	_, err = fmt.Fprintf(w, "%s\n", b)
+	return err
+}
+
+// writeJSON writes an (indented) JSON HTTP response
+func writeJSON(w http.ResponseWriter, v interface{}) {
+	b, err := json.MarshalIndent(v, "", " ")
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusInternalServerError)
+		return
+	}
+	w.Header().Set("Content-Type", "application/json")
+	w.Write(b)
+}
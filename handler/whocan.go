@@ -0,0 +1,353 @@
+package handler
+
+import (
+	"fmt"
+	"io"
+	"net/http"
+	"sort"
+	"strings"
+
+	"github.com/golang/glog"
+	//
+
+	"github.com/FlorianOtel/client-go/kubernetes"
+	authorizationv1beta1 "github.com/FlorianOtel/client-go/pkg/apis/authorization/v1beta1"
+	rbacv1alpha1 "github.com/FlorianOtel/client-go/pkg/apis/rbac/v1alpha1"
+)
+
+// Effective-permissions resolver, based on the cached RBAC objects:
+// - "who can": which users, groups and service accounts can do verb V on resource R in namespace N
+// - "what can": what can subject S do
+// ClusterRoles referenced from RoleBindings are expanded (and scoped to the namespace of the RoleBinding). Rules restricted to
+// some resourceNames only grant access to those objects -- the grants are returned qualified with the names.
+//
+// N.B. Only RBAC is taken into account -- other authorizers (ABAC, webhook...) configured on the API server may grant more.
+// Use the SubjectAccessReview cross-check to compare the results against what the API server actually decides.
+
+// Grant is a permission granted to a subject via a binding
+type Grant struct {
+	Subject       rbacv1alpha1.Subject `json:"subject"`
+	Binding       string               `json:"binding"`   // e.g. "RoleBinding default/view-binding"
+	Role          string               `json:"role"`      // e.g. "ClusterRole view"
+	Namespace     string               `json:"namespace"` // Namespace the grant applies to. Empty means cluster-wide
+	Rule          string               `json:"rule"`
+	ResourceNames []string             `json:"resourceNames,omitempty"` // The only objects the grant applies to. Empty means all of them
+}
+
+// CrossCheck is the answer of the API server (SubjectAccessReview) for a subject returned by the resolver
+type CrossCheck struct {
+	Subject string `json:"subject"`
+	Allowed bool   `json:"allowed"`
+	Reason  string `json:"reason,omitempty"`
+	Error   string `json:"error,omitempty"`
+}
+
+// ruleAllows tells whether a PolicyRule allows verb on resource (in the given API group). "*" acts as wildcard in the rule.
+// N.B. The rule may be restricted to some resourceNames -- see Grant.ResourceNames
+func ruleAllows(rule rbacv1alpha1.PolicyRule, verb, group, resource string) bool {
+	return matchesAny(rule.Verbs, verb, rbacv1alpha1.VerbAll) &&
+		matchesAny(rule.APIGroups, group, rbacv1alpha1.APIGroupAll) &&
+		matchesAny(rule.Resources, resource, rbacv1alpha1.ResourceAll)
+}
+
+func matchesAny(values []string, value, all string) bool {
+	for _, v := range values {
+		if v == value || v == all {
+			return true
+		}
+	}
+	return false
+}
+
+// resolveRoleRef returns the rules of the Role / ClusterRole a binding refers to. Roles are looked up in the namespace of the binding
+func resolveRoleRef(namespace string, ref rbacv1alpha1.RoleRef) ([]rbacv1alpha1.PolicyRule, bool) {
+	switch ref.Kind {
+	case "ClusterRole":
+		if ClusterRoleStore == nil {
+			return nil, false
+		}
+		obj, exists, err := ClusterRoleStore.GetByKey(ref.Name)
+		if err != nil || !exists {
+			return nil, false
+		}
+		return obj.(*rbacv1alpha1.ClusterRole).Rules, true
+	case "Role":
+		if RoleStore == nil {
+			return nil, false
+		}
+		obj, exists, err := RoleStore.GetByKey(namespace + "/" + ref.Name)
+		if err != nil || !exists {
+			return nil, false
+		}
+		return obj.(*rbacv1alpha1.Role).Rules, true
+	}
+	return nil, false
+}
+
+// boundRules is a binding, resolved: its subjects and the rules of the role it refers to
+type boundRules struct {
+	binding   string
+	role      string
+	namespace string // Empty for ClusterRoleBindings
+	subjects  []rbacv1alpha1.Subject
+	rules     []rbacv1alpha1.PolicyRule
+}
+
+// allBindings resolves all the cached RoleBindings and ClusterRoleBindings. Bindings referring to missing roles are skipped
+func allBindings() []boundRules {
+	var bindings []boundRules
+
+	if ClusterRoleBindingStore != nil {
+		for _, obj := range ClusterRoleBindingStore.List() {
+			crb := obj.(*rbacv1alpha1.ClusterRoleBinding)
+			rules, ok := resolveRoleRef("", crb.RoleRef)
+			if !ok {
+				glog.V(2).Infof("ClusterRoleBinding %s refers to unknown %s", crb.Name, roleRefString(crb.RoleRef))
+				continue
+			}
+			bindings = append(bindings, boundRules{"ClusterRoleBinding " + crb.Name, roleRefString(crb.RoleRef), "", crb.Subjects, rules})
+		}
+	}
+
+	if RoleBindingStore != nil {
+		for _, obj := range RoleBindingStore.List() {
+			rb := obj.(*rbacv1alpha1.RoleBinding)
+			rules, ok := resolveRoleRef(rb.Namespace, rb.RoleRef)
+			if !ok {
+				glog.V(2).Infof("RoleBinding %s/%s refers to unknown %s", rb.Namespace, rb.Name, roleRefString(rb.RoleRef))
+				continue
+			}
+			bindings = append(bindings, boundRules{"RoleBinding " + rb.Namespace + "/" + rb.Name, roleRefString(rb.RoleRef), rb.Namespace, rb.Subjects, rules})
+		}
+	}
+
+	return bindings
+}
+
+// WhoCan returns the subjects that can do "verb" on "resource" (in API "group" -- "" for the core API group) in "namespace".
+// An empty namespace only takes the cluster-wide grants (ClusterRoleBindings) into account
+func WhoCan(verb, group, resource, namespace string) []Grant {
+	var grants []Grant
+
+	for _, b := range allBindings() {
+		if b.namespace != "" && b.namespace != namespace {
+			continue
+		}
+		for _, rule := range b.rules {
+			if !ruleAllows(rule, verb, group, resource) {
+				continue
+			}
+			for _, s := range b.subjects {
+				grants = append(grants, Grant{s, b.binding, b.role, b.namespace, ruleString(rule), rule.ResourceNames})
+			}
+		}
+	}
+
+	sortGrants(grants)
+	return grants
+}
+
+// WhatCan returns all the permissions granted to a subject -- directly, or via the groups it implicitly belongs to
+// (e.g. "system:serviceaccounts:<namespace>" for service accounts). Explicit group memberships of users are not known to the API, so are not taken into account
+func WhatCan(subject rbacv1alpha1.Subject) []Grant {
+	var grants []Grant
+
+	for _, b := range allBindings() {
+		for _, s := range b.subjects {
+			if !subjectMatches(subject, s) {
+				continue
+			}
+			for _, rule := range b.rules {
+				grants = append(grants, Grant{s, b.binding, b.role, b.namespace, ruleString(rule), rule.ResourceNames})
+			}
+		}
+	}
+
+	sortGrants(grants)
+	return grants
+}
+
+// subjectMatches tells whether a binding subject applies to the queried subject
+func subjectMatches(query, bound rbacv1alpha1.Subject) bool {
+	switch bound.Kind {
+	case rbacv1alpha1.GroupKind:
+		if query.Kind == rbacv1alpha1.GroupKind {
+			return bound.Name == query.Name
+		}
+		// Implicit groups
+		switch bound.Name {
+		case "system:authenticated":
+			return true
+		case "system:serviceaccounts":
+			return query.Kind == rbacv1alpha1.ServiceAccountKind
+		case "system:serviceaccounts:" + query.Namespace:
+			return query.Kind == rbacv1alpha1.ServiceAccountKind
+		}
+		return false
+	case rbacv1alpha1.UserKind:
+		if query.Kind == rbacv1alpha1.ServiceAccountKind {
+			return bound.Name == serviceAccountUser(query) || bound.Name == rbacv1alpha1.UserAll
+		}
+		return query.Kind == rbacv1alpha1.UserKind && (bound.Name == query.Name || bound.Name == rbacv1alpha1.UserAll)
+	case rbacv1alpha1.ServiceAccountKind:
+		return query.Kind == rbacv1alpha1.ServiceAccountKind && bound.Name == query.Name && bound.Namespace == query.Namespace
+	}
+	return false
+}
+
+// serviceAccountUser returns the user name a service account authenticates as
+func serviceAccountUser(sa rbacv1alpha1.Subject) string {
+	return fmt.Sprintf("system:serviceaccount:%s:%s", sa.Namespace, sa.Name)
+}
+
+func sortGrants(grants []Grant) {
+	sort.SliceStable(grants, func(i, j int) bool {
+		if a, b := subjectString(grants[i].Subject), subjectString(grants[j].Subject); a != b {
+			return a < b
+		}
+		return grants[i].Binding < grants[j].Binding
+	})
+}
+
+// ParseSubject parses a subject given as "Kind:name" -- or "ServiceAccount:namespace/name" for service accounts
+func ParseSubject(s string) (rbacv1alpha1.Subject, error) {
+	var subject rbacv1alpha1.Subject
+
+	parts := strings.SplitN(s, ":", 2)
+	if len(parts) != 2 || parts[1] == "" {
+		return subject, fmt.Errorf("invalid subject %q. Expected \"User:name\", \"Group:name\" or \"ServiceAccount:namespace/name\"", s)
+	}
+
+	subject.Kind, subject.Name = parts[0], parts[1]
+	switch subject.Kind {
+	case rbacv1alpha1.UserKind, rbacv1alpha1.GroupKind:
+	case rbacv1alpha1.ServiceAccountKind:
+		nsName := strings.SplitN(subject.Name, "/", 2)
+		if len(nsName) != 2 {
+			return subject, fmt.Errorf("invalid service account %q. Expected \"ServiceAccount:namespace/name\"", s)
+		}
+		subject.Namespace, subject.Name = nsName[0], nsName[1]
+	default:
+		return subject, fmt.Errorf("invalid subject kind %q. Expected one of User, Group, ServiceAccount", subject.Kind)
+	}
+	return subject, nil
+}
+
+// CrossCheckWhoCan asks the API server (via SubjectAccessReviews) whether each of the subjects returned by WhoCan is actually allowed.
+// Subjects only granted access to some resourceNames are checked against the first of those names
+func CrossCheckWhoCan(c *kubernetes.Clientset, verb, group, resource, namespace string, grants []Grant) []CrossCheck {
+	var results []CrossCheck
+
+	// One check per subject -- on its unrestricted grant, if any
+	var subjects []string
+	best := make(map[string]Grant)
+	for _, g := range grants {
+		name := subjectString(g.Subject)
+		previous, seen := best[name]
+		if !seen {
+			subjects = append(subjects, name)
+		}
+		if !seen || (len(previous.ResourceNames) > 0 && len(g.ResourceNames) == 0) {
+			best[name] = g
+		}
+	}
+
+	for _, name := range subjects {
+		g := best[name]
+		spec := authorizationv1beta1.SubjectAccessReviewSpec{
+			ResourceAttributes: &authorizationv1beta1.ResourceAttributes{
+				Namespace: namespace,
+				Verb:      verb,
+				Group:     group,
+				Resource:  resource,
+			},
+		}
+		if len(g.ResourceNames) > 0 {
+			spec.ResourceAttributes.Name = g.ResourceNames[0]
+		}
+		switch g.Subject.Kind {
+		case rbacv1alpha1.UserKind:
+			spec.User = g.Subject.Name
+		case rbacv1alpha1.GroupKind:
+			spec.Groups = []string{g.Subject.Name}
+		case rbacv1alpha1.ServiceAccountKind:
+			spec.User = serviceAccountUser(g.Subject)
+			spec.Groups = []string{"system:serviceaccounts", "system:serviceaccounts:" + g.Subject.Namespace, "system:authenticated"}
+		}
+
+		result := CrossCheck{Subject: name}
+		sar, err := c.Authorization().SubjectAccessReviews().Create(&authorizationv1beta1.SubjectAccessReview{Spec: spec})
+		if err != nil {
+			result.Error = err.Error()
+		} else {
+			result.Allowed, result.Reason = sar.Status.Allowed, sar.Status.Reason
+			if sar.Status.EvaluationError != "" {
+				result.Error = sar.Status.EvaluationError
+			}
+		}
+		results = append(results, result)
+	}
+
+	return results
+}
+
+// PrintGrants prints the grants as a table
+func PrintGrants(w io.Writer, grants []Grant) {
+	if len(grants) == 0 {
+		fmt.Fprintf(w, "  <none>\n")
+		return
+	}
+	for _, g := range grants {
+		scope := "cluster-wide"
+		if g.Namespace != "" {
+			scope = "in namespace " + g.Namespace
+		}
+		if len(g.ResourceNames) > 0 {
+			scope += ", only " + strings.Join(g.ResourceNames, ", ")
+		}
+		fmt.Fprintf(w, "  %-50s via %s (%s, %s): %s\n", subjectString(g.Subject), g.Binding, g.Role, scope, g.Rule)
+	}
+}
+
+// PrintCrossChecks prints the SubjectAccessReview results, flagging the subjects the API server disagrees about
+func PrintCrossChecks(w io.Writer, results []CrossCheck) {
+	for _, r := range results {
+		switch {
+		case r.Error != "":
+			fmt.Fprintf(w, "  %-50s SubjectAccessReview error: %s\n", r.Subject, r.Error)
+		case r.Allowed:
+			fmt.Fprintf(w, "  %-50s confirmed by the API server\n", r.Subject)
+		default:
+			fmt.Fprintf(w, "  %-50s MISMATCH -- denied by the API server: %s\n", r.Subject, r.Reason)
+		}
+	}
+}
+
+// WhoCanHandler serves "who can" queries over HTTP, e.g. /whocan?verb=get&resource=secrets&namespace=default[&group=][&crosscheck=true]
+func WhoCanHandler(c *kubernetes.Clientset) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		q := r.URL.Query()
+		verb, group, resource, namespace := q.Get("verb"), q.Get("group"), q.Get("resource"), q.Get("namespace")
+		if verb == "" || resource == "" {
+			http.Error(w, "\"verb\" and \"resource\" are required", http.StatusBadRequest)
+			return
+		}
+
+		grants := WhoCan(verb, group, resource, namespace)
+		result := map[string]interface{}{"grants": grants}
+		if q.Get("crosscheck") == "true" {
+			result["crosscheck"] = CrossCheckWhoCan(c, verb, group, resource, namespace, grants)
+		}
+		writeJSON(w, result)
+	}
+}
+
+// WhatCanHandler serves "what can" queries over HTTP, e.g. /whatcan?subject=ServiceAccount:default/builder
+func WhatCanHandler(w http.ResponseWriter, r *http.Request) {
+	subject, err := ParseSubject(r.URL.Query().Get("subject"))
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusBadRequest)
+		return
+	}
+	writeJSON(w, map[string]interface{}{"grants": WhatCan(subject)})
+}
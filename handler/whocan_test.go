@@ -0,0 +1,167 @@
+package handler
+
+import (
+	"reflect"
+	"testing"
+
+	apiv1 "github.com/FlorianOtel/client-go/pkg/api/v1"
+	rbacv1alpha1 "github.com/FlorianOtel/client-go/pkg/apis/rbac/v1alpha1"
+	"github.com/FlorianOtel/client-go/tools/cache"
+)
+
+func TestRuleAllows(t *testing.T) {
+	tests := []struct {
+		name                  string
+		rule                  rbacv1alpha1.PolicyRule
+		verb, group, resource string
+		allowed               bool
+	}{
+		{"exact", rbacv1alpha1.PolicyRule{Verbs: []string{"get"}, APIGroups: []string{""}, Resources: []string{"pods"}}, "get", "", "pods", true},
+		{"other verb", rbacv1alpha1.PolicyRule{Verbs: []string{"get"}, APIGroups: []string{""}, Resources: []string{"pods"}}, "delete", "", "pods", false},
+		{"other resource", rbacv1alpha1.PolicyRule{Verbs: []string{"get"}, APIGroups: []string{""}, Resources: []string{"pods"}}, "get", "", "secrets", false},
+		{"other group", rbacv1alpha1.PolicyRule{Verbs: []string{"get"}, APIGroups: []string{""}, Resources: []string{"deployments"}}, "get", "extensions", "deployments", false},
+		{"wildcard verb", rbacv1alpha1.PolicyRule{Verbs: []string{"*"}, APIGroups: []string{""}, Resources: []string{"pods"}}, "delete", "", "pods", true},
+		{"wildcard group", rbacv1alpha1.PolicyRule{Verbs: []string{"get"}, APIGroups: []string{"*"}, Resources: []string{"deployments"}}, "get", "extensions", "deployments", true},
+		{"wildcard resource", rbacv1alpha1.PolicyRule{Verbs: []string{"get"}, APIGroups: []string{""}, Resources: []string{"*"}}, "get", "", "secrets", true},
+		{"no groups", rbacv1alpha1.PolicyRule{Verbs: []string{"get"}, Resources: []string{"pods"}}, "get", "", "pods", false},
+	}
+	for _, test := range tests {
+		if allowed := ruleAllows(test.rule, test.verb, test.group, test.resource); allowed != test.allowed {
+			t.Errorf("%s: ruleAllows(%s) = %v, expected %v", test.name, ruleString(test.rule), allowed, test.allowed)
+		}
+	}
+}
+
+// withRBACStores sets up the RBAC stores with the given objects for the duration of a test
+func withRBACStores(t *testing.T, objects ...interface{}) {
+	saved := []cache.Store{RoleStore, ClusterRoleStore, RoleBindingStore, ClusterRoleBindingStore}
+	t.Cleanup(func() {
+		RoleStore, ClusterRoleStore, RoleBindingStore, ClusterRoleBindingStore = saved[0], saved[1], saved[2], saved[3]
+	})
+
+	RoleStore = cache.NewStore(cache.MetaNamespaceKeyFunc)
+	ClusterRoleStore = cache.NewStore(cache.MetaNamespaceKeyFunc)
+	RoleBindingStore = cache.NewStore(cache.MetaNamespaceKeyFunc)
+	ClusterRoleBindingStore = cache.NewStore(cache.MetaNamespaceKeyFunc)
+	for _, obj := range objects {
+		var store cache.Store
+		switch obj.(type) {
+		case *rbacv1alpha1.Role:
+			store = RoleStore
+		case *rbacv1alpha1.ClusterRole:
+			store = ClusterRoleStore
+		case *rbacv1alpha1.RoleBinding:
+			store = RoleBindingStore
+		case *rbacv1alpha1.ClusterRoleBinding:
+			store = ClusterRoleBindingStore
+		}
+		if err := store.Add(obj); err != nil {
+			t.Fatal(err)
+		}
+	}
+}
+
+// grantedSubjects returns the subjects of grants, with the resourceNames they are restricted to
+func grantedSubjects(grants []Grant) map[string][]string {
+	subjects := make(map[string][]string)
+	for _, g := range grants {
+		subjects[subjectString(g.Subject)] = g.ResourceNames
+	}
+	return subjects
+}
+
+var (
+	alice   = rbacv1alpha1.Subject{Kind: rbacv1alpha1.UserKind, Name: "alice"}
+	bob     = rbacv1alpha1.Subject{Kind: rbacv1alpha1.UserKind, Name: "bob"}
+	builder = rbacv1alpha1.Subject{Kind: rbacv1alpha1.ServiceAccountKind, Namespace: "team", Name: "builder"}
+)
+
+func TestWhoCanResourceNames(t *testing.T) {
+	withRBACStores(t,
+		&rbacv1alpha1.Role{
+			ObjectMeta: apiv1.ObjectMeta{Namespace: "team", Name: "one-secret"},
+			Rules:      []rbacv1alpha1.PolicyRule{{Verbs: []string{"get"}, APIGroups: []string{""}, Resources: []string{"secrets"}, ResourceNames: []string{"db-password"}}},
+		},
+		&rbacv1alpha1.Role{
+			ObjectMeta: apiv1.ObjectMeta{Namespace: "team", Name: "all-secrets"},
+			Rules:      []rbacv1alpha1.PolicyRule{{Verbs: []string{"get"}, APIGroups: []string{""}, Resources: []string{"secrets"}}},
+		},
+		&rbacv1alpha1.RoleBinding{
+			ObjectMeta: apiv1.ObjectMeta{Namespace: "team", Name: "alice-one-secret"},
+			RoleRef:    rbacv1alpha1.RoleRef{Kind: "Role", Name: "one-secret"},
+			Subjects:   []rbacv1alpha1.Subject{alice},
+		},
+		&rbacv1alpha1.RoleBinding{
+			ObjectMeta: apiv1.ObjectMeta{Namespace: "team", Name: "bob-all-secrets"},
+			RoleRef:    rbacv1alpha1.RoleRef{Kind: "Role", Name: "all-secrets"},
+			Subjects:   []rbacv1alpha1.Subject{bob},
+		},
+	)
+
+	got := grantedSubjects(WhoCan("get", "", "secrets", "team"))
+	expected := map[string][]string{
+		"User alice": {"db-password"},
+		"User bob":   nil,
+	}
+	if !reflect.DeepEqual(got, expected) {
+		t.Errorf("WhoCan(get secrets in team) = %v, expected %v", got, expected)
+	}
+}
+
+func TestWhoCanClusterRoleExpansion(t *testing.T) {
+	withRBACStores(t,
+		&rbacv1alpha1.ClusterRole{
+			ObjectMeta: apiv1.ObjectMeta{Name: "view"},
+			Rules:      []rbacv1alpha1.PolicyRule{{Verbs: []string{"get", "list"}, APIGroups: []string{""}, Resources: []string{"pods"}}},
+		},
+		&rbacv1alpha1.ClusterRole{
+			ObjectMeta: apiv1.ObjectMeta{Name: "cluster-admin"},
+			Rules:      []rbacv1alpha1.PolicyRule{{Verbs: []string{"*"}, APIGroups: []string{"*"}, Resources: []string{"*"}}},
+		},
+		// ClusterRole via a RoleBinding: only in the namespace of the RoleBinding
+		&rbacv1alpha1.RoleBinding{
+			ObjectMeta: apiv1.ObjectMeta{Namespace: "team", Name: "builder-view"},
+			RoleRef:    rbacv1alpha1.RoleRef{Kind: "ClusterRole", Name: "view"},
+			Subjects:   []rbacv1alpha1.Subject{builder},
+		},
+		// ClusterRole via a ClusterRoleBinding: everywhere
+		&rbacv1alpha1.ClusterRoleBinding{
+			ObjectMeta: apiv1.ObjectMeta{Name: "alice-admin"},
+			RoleRef:    rbacv1alpha1.RoleRef{Kind: "ClusterRole", Name: "cluster-admin"},
+			Subjects:   []rbacv1alpha1.Subject{alice},
+		},
+		// Missing role: skipped
+		&rbacv1alpha1.RoleBinding{
+			ObjectMeta: apiv1.ObjectMeta{Namespace: "team", Name: "bob-missing"},
+			RoleRef:    rbacv1alpha1.RoleRef{Kind: "ClusterRole", Name: "missing"},
+			Subjects:   []rbacv1alpha1.Subject{bob},
+		},
+	)
+
+	tests := []struct {
+		verb, group, resource, namespace string
+		expected                         []string
+	}{
+		{"list", "", "pods", "team", []string{"ServiceAccount team/builder", "User alice"}},
+		{"list", "", "pods", "other", []string{"User alice"}},
+		{"list", "", "pods", "", []string{"User alice"}},
+		{"delete", "", "pods", "team", []string{"User alice"}},
+		{"get", "extensions", "deployments", "team", []string{"User alice"}},
+	}
+	for _, test := range tests {
+		var got []string
+		for _, g := range WhoCan(test.verb, test.group, test.resource, test.namespace) {
+			got = append(got, subjectString(g.Subject))
+		}
+		if !reflect.DeepEqual(got, test.expected) {
+			t.Errorf("WhoCan(%s %s.%s in %q) = %v, expected %v", test.verb, test.resource, test.group, test.namespace, got, test.expected)
+		}
+	}
+
+	// The grant via the RoleBinding is scoped to its namespace
+	for _, g := range WhoCan("list", "", "pods", "team") {
+		if g.Subject == builder && g.Namespace != "team" {
+			t.Errorf("grant %+v: expected namespace team", g)
+		}
+	}
+}
@@ -18,16 +18,21 @@ package main
 
 import (
 	"flag"
+	"fmt"
 	"net/http"
 	"os"
+	"strings"
+	"time"
 
 	"github.com/FlorianOtel/k8s-client/handler"
 
 	"github.com/golang/glog"
 
 	"github.com/FlorianOtel/client-go/kubernetes"
+	"github.com/FlorianOtel/client-go/pkg/labels"
 	"github.com/FlorianOtel/client-go/pkg/util/wait"
 
+	"github.com/FlorianOtel/client-go/tools/cache"
 	"github.com/FlorianOtel/client-go/tools/clientcmd"
 	// apiv1 "k8s.io/kubernetes/pkg/api/v1"
 	// "k8s.io/kubernetes/pkg/apis/extensions"
@@ -39,7 +44,55 @@ const errorLogLevel = 2
 
 var (
 	kubeconfig     = flag.String("kubeconfig", "./kubeconfig", "absolute path to the kubeconfig file")
+	stuckStorage   = flag.Duration("stuck-storage-threshold", 5*time.Minute, "report PVCs / PVs stuck in Pending or Released for longer than this")
+	rbacAuditLog   = flag.String("rbac-audit-log", "", "file to append the RBAC security-audit records (JSON lines) to. Default: stdout")
+	whoCan         = flag.String("who-can", "", "print who can do a given action and exit. Format: verb,resource,namespace[,apiGroup] -- e.g. \"get,secrets,default\"")
+	whatCan        = flag.String("what-can", "", "print what a subject can do and exit. Format: User:name, Group:name or ServiceAccount:namespace/name")
+	crossCheck     = flag.Bool("crosscheck", false, "with -who-can: cross-check the results against the API server (SubjectAccessReview)")
+	preflight      = flag.String("preflight", "skip", "pre-flight check of the list / watch permissions on the watched resources. One of: \"refuse\" (refuse to start if any is denied), \"skip\" (skip the watchers lacking permissions), \"off\". Resources whose permissions cannot be checked are watched anyway")
+	quotaThreshold = flag.Float64("quota-threshold", 0.8, "flag ResourceQuota usage above this ratio of the hard limit (e.g. 0.8 for 80%)")
+	cmDiffLimit    = flag.Int("configmap-diff-limit", 0, "print a full diff of changed ConfigMap values up to this size (bytes). 0 disables value diffs")
+	csrApproval    = flag.String("csr-approval", "off", "rule-based approval of CertificateSigningRequests. One of: \"off\", \"dry-run\" (only log the decisions), \"on\"")
+	netpolMatrix   = flag.String("netpol-matrix", "", "print the NetworkPolicy ingress connectivity matrix and exit. Format: csv, json or dot")
+	matrixGroup    = flag.String("matrix-group", "pod", "with -netpol-matrix: group the pods by \"pod\", \"namespace\" or \"label:<key>\"")
+	matrixPorts    = flag.String("matrix-ports", "TCP/80", "with -netpol-matrix / -simulate-netpol: comma-separated destination ports, e.g. \"TCP/80,UDP/53\"")
+	simulateNetpol = flag.String("simulate-netpol", "", "print the impact of the NetworkPolicies in a (YAML or JSON) file, if they were applied, and exit. The cluster is not modified")
+	canReach       = flag.String("can-reach", "", "explain whether a pod can reach another one, according to the NetworkPolicies, and exit. Format: namespace/source,namespace/destination,port -- e.g. \"default/client,default/web,TCP/80\"")
+	netpolLint     = flag.Bool("netpol-lint", false, "run the NetworkPolicy lint checks, print the findings and exit")
+	lintInterval   = flag.Duration("netpol-lint-interval", time.Minute, "how often to run the NetworkPolicy lint checks. 0 disables the continuous checks")
+	lintLog        = flag.String("netpol-lint-log", "", "file to append the NetworkPolicy lint events (JSON lines) to. Default: stdout")
+	provision      = flag.String("provision-netpol", "off", "provision new namespaces with DefaultDeny ingress isolation and the baseline NetworkPolicies. One of: \"off\", \"dry-run\" (only log the actions), \"on\"")
+	provisionSel   = flag.String("provision-selector", "", "label selector of the namespaces to provision, e.g. \"tenant,env!=dev\". Default: all namespaces")
+	provisionFile  = flag.String("provision-policy", "", "(YAML or JSON) file with the baseline NetworkPolicies. Default: allow ingress from the namespaces labelled role=ingress")
+	podTimeline    = flag.String("pod-timeline", "", "print the lifecycle timeline of a pod -- reconstructed from its status and the Events -- and exit. Format: namespace/name")
+	timelineFormat = flag.String("timeline-format", "text", "with -pod-timeline: output format. One of: text, json")
+	restartLimit   = flag.Int("restart-threshold", 5, "alert on containers restarting this many times (or more) within -restart-window")
+	restartWindow  = flag.Duration("restart-window", 10*time.Minute, "the window over which container restarts are counted, for -restart-threshold")
+	alertLog       = flag.String("alert-log", "", "file to append the alerts (JSON lines) to. Default: stdout")
+	alertWebhooks  = flag.String("alert-webhook", "", "comma-separated URLs to POST each alert (as JSON) to, in addition to -alert-log")
+	podSecurity    = flag.Bool("pod-security", false, "print the pod security posture audit, per namespace, and exit")
+	securityLog    = flag.String("pod-security-log", "", "file to append the events about non-compliant pods (JSON lines) to. Default: stdout")
+	imageInventory = flag.Bool("image-inventory", false, "print the container image inventory and the image drift findings, and exit")
+	whereIsImage   = flag.String("where-is-image", "", "print where an image runs and exit. An image reference (without a tag: all its tags) or a digest -- e.g. \"nginx\", \"nginx:1.11\" or \"sha256:...\"")
+	snapshot       = flag.String("snapshot", "", "write a snapshot of all the watched objects (JSON lines, gzip'ed if the name ends in \".gz\") to a file and exit")
+	snapshotDiff   = flag.String("snapshot-diff", "", "compare two snapshot files and exit -- no cluster access needed. Format: old,new")
+	diffFormat     = flag.String("snapshot-diff-format", "text", "with -snapshot-diff: output format. One of: text, json")
+	manifests      = flag.String("manifests", "", "directory of (YAML or JSON) manifests -- e.g. a GitOps repository -- to continuously compare against the live objects")
+	manifestDrift  = flag.Bool("manifest-drift", false, "with -manifests: print the drift between the manifests and the live objects, and exit")
+	driftInterval  = flag.Duration("manifest-drift-interval", time.Minute, "with -manifests: how often to compare the manifests against the live objects. 0 disables the continuous checks")
+	driftLog       = flag.String("manifest-drift-log", "", "file to append the manifest drift events (JSON lines) to. Default: stdout")
+	rulesFile      = flag.String("rules", "", "(YAML or JSON) rules file mapping the watch events to actions: log, webhook, exec, annotate, label, event. Reloaded when it changes")
+	rulesDryRun    = flag.Bool("rules-dry-run", false, "with -rules: only log what the actions of all the rules would do")
+	rulesReload    = flag.Duration("rules-reload-interval", 5*time.Second, "with -rules: how often to check the rules file for changes. 0 disables the reloads")
+	topology       = flag.String("topology", "", "print the topology graph (namespaces, services, pods, nodes and the traffic the NetworkPolicies allow) and exit. Format: dot or json")
+	saReport       = flag.Bool("serviceaccounts", false, "print the ServiceAccount inventory and findings (unused accounts, orphaned tokens, ...), and exit")
+	csrRules       = flag.String("csr-rules", "kubelet-serving,kubelet-client", "comma-separated CSR approval rules, applied in this order. Available: kubelet-serving, kubelet-client")
 	UseNetPolicies = false
+	UseRBAC        = false
+	UseTPR         = false
+	UseCSR         = false
+	UsePSP         = false
+	UseStatefulSet = false
 )
 
 func main() {
@@ -51,6 +104,11 @@ func main() {
 		os.Exit(0)
 	}
 
+	// Offline: compare two snapshots
+	if *snapshotDiff != "" {
+		os.Exit(diffSnapshots())
+	}
+
 	// glog.V(errorLogLevel).Infof("The given kubeconfig is: %s ", *kubeconfig)
 	glog.Infof("The given kubeconfig is: %s ", *kubeconfig)
 
@@ -64,6 +122,7 @@ func main() {
 	if err != nil {
 		glog.Errorf("Error creating Kubernetes client. Error: %s", err)
 	}
+	handler.Clientset = clientset
 
 	////////
 	//////// Discover K8S API -- version, extensions: Check if server supports Network Policy API extension (currently / Dec 2016: apiv1beta1)
@@ -72,22 +131,149 @@ func main() {
 	sver, err := clientset.ServerVersion()
 
 	glog.Infof("Kubernetes server details: %#v", *sver)
+	handler.ServerVersion = sver
 
 	//
 	sres, err := clientset.ServerResources()
 
 	for _, res := range sres {
 		for _, apires := range res.APIResources {
+			handler.APIResources = append(handler.APIResources, res.GroupVersion+"/"+apires.Name)
 			switch apires.Name {
 			case "networkpolicies":
 				glog.Infof(" ====> Found Kubernetes API server support for %#v. Available under / GroupVersion is: %#v . APIResource details: %#v", apires.Name, res.GroupVersion, apires)
 				UseNetPolicies = true
+			case "thirdpartyresources":
+				glog.Infof(" ====> Found Kubernetes API server support for %#v. Available under / GroupVersion is: %#v . APIResource details: %#v", apires.Name, res.GroupVersion, apires)
+				UseTPR = true
+			case "statefulsets":
+				glog.Infof(" ====> Found Kubernetes API server support for %#v. Available under / GroupVersion is: %#v . APIResource details: %#v", apires.Name, res.GroupVersion, apires)
+				UseStatefulSet = true
+			case "podsecuritypolicies":
+				glog.Infof(" ====> Found Kubernetes API server support for %#v. Available under / GroupVersion is: %#v . APIResource details: %#v", apires.Name, res.GroupVersion, apires)
+				UsePSP = true
+			case "certificatesigningrequests":
+				glog.Infof(" ====> Found Kubernetes API server support for %#v. Available under / GroupVersion is: %#v . APIResource details: %#v", apires.Name, res.GroupVersion, apires)
+				UseCSR = true
+			case "clusterrolebindings":
+				if res.GroupVersion == "rbac.authorization.k8s.io/v1alpha1" {
+					glog.Infof(" ====> Found Kubernetes API server support for %#v. Available under / GroupVersion is: %#v . APIResource details: %#v", apires.Name, res.GroupVersion, apires)
+					UseRBAC = true
+				}
 			default:
 				// glog.Infof("Kubernetes API Server discovery: API Server Resource:\n%#v\n", apires)
 			}
 		}
 	}
 
+	////////
+	//////// Pre-flight check: are we allowed to list / watch the resources we are about to watch ?
+	////////
+
+	watched := []handler.WatchedResource{
+		{Resource: "pods", Namespace: "default"},
+		{Resource: "services", Namespace: "default"},
+		{Resource: "configmaps", Namespace: "default"},
+		{Resource: "secrets", Namespace: "default"},
+		{Resource: "serviceaccounts", Namespace: "default"},
+		{Resource: "persistentvolumes"},
+		{Resource: "persistentvolumeclaims", Namespace: "default"},
+		{Group: "storage.k8s.io", Resource: "storageclasses"},
+		{Resource: "resourcequotas"},
+		{Resource: "limitranges"},
+		{Resource: "nodes"},
+		{Group: "autoscaling", Resource: "horizontalpodautoscalers", Namespace: "default"},
+		{Group: "policy", Resource: "poddisruptionbudgets", Namespace: "default"},
+		{Resource: "namespaces"},
+		{Resource: "events", Namespace: "default"},
+		{Group: "extensions", Resource: "deployments", Namespace: "default"},
+		{Group: "extensions", Resource: "daemonsets", Namespace: "default"},
+	}
+	if UseNetPolicies {
+		watched = append(watched, handler.WatchedResource{Group: "extensions", Resource: "networkpolicies", Namespace: "default"})
+	}
+	if UseStatefulSet {
+		watched = append(watched, handler.WatchedResource{Group: "apps", Resource: "statefulsets", Namespace: "default"})
+	}
+	if UsePSP {
+		watched = append(watched, handler.WatchedResource{Group: "extensions", Resource: "podsecuritypolicies"})
+	}
+	if UseCSR {
+		watched = append(watched, handler.WatchedResource{Group: "certificates.k8s.io", Resource: "certificatesigningrequests"})
+	}
+	if UseTPR {
+		watched = append(watched, handler.WatchedResource{Group: "extensions", Resource: "thirdpartyresources"})
+	}
+	if UseRBAC {
+		watched = append(watched,
+			handler.WatchedResource{Group: "rbac.authorization.k8s.io", Resource: "roles"},
+			handler.WatchedResource{Group: "rbac.authorization.k8s.io", Resource: "clusterroles"},
+			handler.WatchedResource{Group: "rbac.authorization.k8s.io", Resource: "rolebindings"},
+			handler.WatchedResource{Group: "rbac.authorization.k8s.io", Resource: "clusterrolebindings"})
+	}
+
+	handler.WatchedResources = watched
+
+	denied := map[string]bool{}
+
+	switch *preflight {
+	case "off":
+	case "refuse", "skip":
+		checks := handler.CheckAccess(clientset, watched)
+		fmt.Printf("Pre-flight permission check:\n")
+		handler.PrintAccessMatrix(os.Stdout, checks)
+
+		if unchecked := handler.UncheckedResources(checks); len(unchecked) > 0 {
+			glog.Warningf("Could not check the list / watch permissions for %d resource(s) -- watching them anyway", len(unchecked))
+		}
+		denied = handler.DeniedResources(checks)
+		if len(denied) > 0 {
+			if *preflight == "refuse" {
+				glog.Fatalf("Missing list / watch permissions for %d resource(s) -- refusing to start. Use -preflight=skip to start without the corresponding watchers", len(denied))
+			}
+			glog.Warningf("Missing list / watch permissions for %d resource(s) -- skipping the corresponding watchers", len(denied))
+		}
+	default:
+		glog.Fatalf("Invalid -preflight %q. Expected one of: refuse, skip, off", *preflight)
+	}
+
+	// watch tells whether we (may) watch a given resource of an API group ("" for the core API group)
+	watch := func(group, resource string) bool {
+		if name := handler.ResourceName(group, resource); denied[name] {
+			glog.Warningf("Not watching %s -- missing list / watch permissions", name)
+			return false
+		}
+		return true
+	}
+
+	// The caches the NetworkPolicy queries (e.g. -netpol-matrix) -- and, in addition, the topology graph -- need to be synchronized
+	var netpolSynced, topologySynced []cache.InformerSynced
+
+	// All the caches (but Events and ThirdPartyResources) -- for the snapshots
+	var allSynced []cache.InformerSynced
+
+	// The caches the -pod-timeline / -pod-security queries need to be synchronized
+	var timelineSynced, securitySynced []cache.InformerSynced
+
+	// The caches the image inventory queries (-image-inventory, -where-is-image) need to be synchronized
+	var imagesSynced []cache.InformerSynced
+
+	////////
+	//////// Rules: actions on the watch events -- loaded before the controllers are created, so they see the initial listing too
+	////////
+
+	if *rulesFile != "" {
+		handler.RulesDryRun = *rulesDryRun
+		if err := handler.LoadRules(*rulesFile); err != nil {
+			glog.Fatalf("Error loading the rules. Error: %s", err)
+		}
+		http.HandleFunc("/rules", handler.RulesHandler)
+
+		if *rulesReload > 0 {
+			go wait.Until(func() { handler.ReloadRules(*rulesFile) }, *rulesReload, wait.NeverStop)
+		}
+	}
+
 	////////
 	//////// Watch Pods
 	////////
@@ -96,34 +282,692 @@ func main() {
 	// var store cache.Store
 	// store, pController := handler.CreatePodController(clientset, "default", handler.PodCreated, handler.PodDeleted, handler.PodUpdated)
 
-	_, pController := handler.CreatePodController(clientset, "", "default", handler.PodCreated, handler.PodDeleted, handler.PodUpdated)
-	go pController.Run(wait.NeverStop)
+	// Container failure alerts, sent to the configured sinks
+	handler.RestartThreshold = *restartLimit
+	handler.RestartWindow = *restartWindow
+	if *alertLog != "" {
+		f, err := os.OpenFile(*alertLog, os.O_APPEND|os.O_CREATE|os.O_WRONLY, 0600)
+		if err != nil {
+			glog.Fatalf("Error opening alert log file %s. Error: %s", *alertLog, err)
+		}
+		defer f.Close()
+		handler.AlertSinks = []handler.AlertSink{handler.NewWriterSink(f, *alertLog)}
+	}
+	if *alertWebhooks != "" {
+		for _, url := range strings.Split(*alertWebhooks, ",") {
+			handler.AlertSinks = append(handler.AlertSinks, handler.NewWebhookSink(url))
+		}
+	}
+	// Restart storms of containers that stopped restarting are only resolved by re-evaluating them
+	if *restartWindow > 0 {
+		go wait.Until(handler.ExpireRestartStorms, *restartWindow/10, wait.NeverStop)
+	}
+
+	if watch("", "pods") {
+		podStore, pController := handler.CreatePodController(clientset, "", "default", handler.PodCreated, handler.PodDeleted, handler.PodUpdated)
+		handler.PodStore = podStore
+		netpolSynced = append(netpolSynced, pController.HasSynced)
+		timelineSynced = append(timelineSynced, pController.HasSynced)
+		securitySynced = append(securitySynced, pController.HasSynced)
+		imagesSynced = append(imagesSynced, pController.HasSynced)
+		allSynced = append(allSynced, pController.HasSynced)
+		go pController.Run(wait.NeverStop)
+
+		// No Service checks until the Pods are known: they would all report "no-pods"
+		go func() {
+			if cache.WaitForCacheSync(wait.NeverStop, pController.HasSynced) {
+				handler.EnableServiceHealth()
+			}
+		}()
+	} else {
+		handler.EnableServiceHealth()
+	}
+
+	////////
+	//////// Watch Events about Pods -- recorded in the Pod lifecycle timelines
+	////////
+
+	if watch("", "events") {
+		_, evController := handler.CreateEventController(clientset, "default", handler.EventCreated, handler.EventDeleted, handler.EventUpdated)
+		timelineSynced = append(timelineSynced, evController.HasSynced)
+		go evController.Run(wait.NeverStop)
+	}
+
+	http.HandleFunc("/timeline", handler.PodTimelineHandler)
+	http.HandleFunc("/alerts", handler.AlertsHandler)
+
+	if *podTimeline != "" {
+		if !cache.WaitForCacheSync(wait.NeverStop, timelineSynced...) {
+			glog.Fatalf("Error synchronizing the Pod / Event caches")
+		}
+		t, err := handler.GetPodTimeline(*podTimeline)
+		if err != nil {
+			glog.Errorf("Cannot print the pod timeline. Error: %s", err)
+			os.Exit(1)
+		}
+		if err := handler.WritePodTimeline(os.Stdout, t, *timelineFormat); err != nil {
+			glog.Errorf("Error writing the pod timeline. Error: %s", err)
+			os.Exit(1)
+		}
+		os.Exit(0)
+	}
+
+	////////
+	//////// Pod security posture -- cross-referenced with the PodSecurityPolicies (if supported)
+	////////
+
+	if *securityLog != "" {
+		f, err := os.OpenFile(*securityLog, os.O_APPEND|os.O_CREATE|os.O_WRONLY, 0600)
+		if err != nil {
+			glog.Fatalf("Error opening pod security log file %s. Error: %s", *securityLog, err)
+		}
+		defer f.Close()
+		handler.SecurityLog = f
+	}
+
+	if UsePSP && watch("extensions", "podsecuritypolicies") {
+		pspStore, pspController := handler.CreatePodSecurityPolicyController(clientset, handler.PodSecurityPolicyCreated, handler.PodSecurityPolicyDeleted, handler.PodSecurityPolicyUpdated)
+		handler.PodSecurityPolicyStore = pspStore
+		securitySynced = append(securitySynced, pspController.HasSynced)
+		allSynced = append(allSynced, pspController.HasSynced)
+		go pspController.Run(wait.NeverStop)
+	}
+
+	http.HandleFunc("/podsecurity", handler.PodSecurityHandler)
+
+	if *podSecurity {
+		if !cache.WaitForCacheSync(wait.NeverStop, securitySynced...) {
+			glog.Fatalf("Error synchronizing the Pod / PodSecurityPolicy caches")
+		}
+		handler.PrintPodSecurityReport(os.Stdout, handler.PodSecurityReport(""))
+		os.Exit(0)
+	}
+
+	////////
+	//////// Watch workloads: Deployments, DaemonSets and StatefulSets (if supported) -- for the image inventory
+	////////
+
+	if watch("extensions", "deployments") {
+		deployStore, deployController := handler.CreateDeploymentController(clientset, "default", handler.DeploymentCreated, handler.DeploymentDeleted, handler.DeploymentUpdated)
+		handler.DeploymentStore = deployStore
+		imagesSynced = append(imagesSynced, deployController.HasSynced)
+		allSynced = append(allSynced, deployController.HasSynced)
+		go deployController.Run(wait.NeverStop)
+	}
+
+	if watch("extensions", "daemonsets") {
+		dsStore, dsController := handler.CreateDaemonSetController(clientset, "default", handler.DaemonSetCreated, handler.DaemonSetDeleted, handler.DaemonSetUpdated)
+		handler.DaemonSetStore = dsStore
+		imagesSynced = append(imagesSynced, dsController.HasSynced)
+		allSynced = append(allSynced, dsController.HasSynced)
+		go dsController.Run(wait.NeverStop)
+	}
+
+	if UseStatefulSet && watch("apps", "statefulsets") {
+		ssStore, ssController := handler.CreateStatefulSetController(clientset, "default", handler.StatefulSetCreated, handler.StatefulSetDeleted, handler.StatefulSetUpdated)
+		handler.StatefulSetStore = ssStore
+		imagesSynced = append(imagesSynced, ssController.HasSynced)
+		allSynced = append(allSynced, ssController.HasSynced)
+		go ssController.Run(wait.NeverStop)
+	}
+
+	http.HandleFunc("/images", handler.ImagesHandler)
+	http.HandleFunc("/imagedrift", handler.ImageDriftHandler)
+
+	if *imageInventory || *whereIsImage != "" {
+		if !cache.WaitForCacheSync(wait.NeverStop, imagesSynced...) {
+			glog.Fatalf("Error synchronizing the Pod / workload caches")
+		}
+		if *whereIsImage != "" {
+			fmt.Printf("Where is image %q running:\n", *whereIsImage)
+			handler.PrintImageInventory(os.Stdout, handler.FindImage(*whereIsImage))
+		}
+		if *imageInventory {
+			fmt.Printf("Image inventory:\n")
+			handler.PrintImageInventory(os.Stdout, handler.ImageInventory(""))
+			fmt.Printf("Image drift:\n")
+			handler.PrintImageDrifts(os.Stdout, handler.ImageDrifts(""))
+		}
+		os.Exit(0)
+	}
 
 	////////
 	//////// Watch Services
 	////////
 
-	_, sController := handler.CreateServiceController(clientset, "default", handler.ServiceCreated, handler.ServiceDeleted, handler.ServiceUpdated)
-	go sController.Run(wait.NeverStop)
+	if watch("", "services") {
+		svcStore, sController := handler.CreateServiceController(clientset, "default", handler.ServiceCreated, handler.ServiceDeleted, handler.ServiceUpdated)
+		handler.ServiceStore = svcStore
+		topologySynced = append(topologySynced, sController.HasSynced)
+		allSynced = append(allSynced, sController.HasSynced)
+		go sController.Run(wait.NeverStop)
+	}
+
+	http.HandleFunc("/servicehealth", handler.ServiceHealthHandler)
+
+	////////
+	//////// Watch ConfigMaps and Secrets
+	////////
+
+	handler.ConfigMapDiffLimit = *cmDiffLimit
+
+	if watch("", "configmaps") {
+		cmStore, cmController := handler.CreateConfigMapController(clientset, "default", handler.ConfigMapCreated, handler.ConfigMapDeleted, handler.ConfigMapUpdated)
+		handler.ConfigMapStore = cmStore
+		allSynced = append(allSynced, cmController.HasSynced)
+		go cmController.Run(wait.NeverStop)
+	}
+
+	if watch("", "secrets") {
+		secStore, secController := handler.CreateSecretController(clientset, "default", handler.SecretCreated, handler.SecretDeleted, handler.SecretUpdated)
+		handler.SecretStore = secStore
+		allSynced = append(allSynced, secController.HasSynced)
+		go secController.Run(wait.NeverStop)
+	}
+
+	////////
+	//////// Watch ServiceAccounts -- correlated with their token Secrets and the Pods running as them
+	////////
+
+	if watch("", "serviceaccounts") {
+		saStore, saController := handler.CreateServiceAccountController(clientset, "default", handler.ServiceAccountCreated, handler.ServiceAccountDeleted, handler.ServiceAccountUpdated)
+		handler.ServiceAccountStore = saStore
+		allSynced = append(allSynced, saController.HasSynced)
+		go saController.Run(wait.NeverStop)
+	}
+
+	http.HandleFunc("/serviceaccounts", handler.ServiceAccountsHandler)
+
+	if *saReport {
+		if !cache.WaitForCacheSync(wait.NeverStop, allSynced...) {
+			glog.Fatalf("Error synchronizing the Pod / Secret / ServiceAccount caches")
+		}
+		fmt.Printf("ServiceAccounts:\n")
+		for _, info := range handler.ServiceAccountInventory("") {
+			handler.PrintServiceAccountInfo(os.Stdout, info)
+		}
+		fmt.Printf("ServiceAccount findings:\n")
+		handler.PrintServiceAccountFindings(os.Stdout, handler.ServiceAccountFindings(""))
+		os.Exit(0)
+	}
+
+	////////
+	//////// Watch storage: PersistentVolumes, PersistentVolumeClaims and StorageClasses
+	////////
+
+	if watch("", "persistentvolumes") {
+		pvStore, pvController := handler.CreatePersistentVolumeController(clientset, handler.PersistentVolumeCreated, handler.PersistentVolumeDeleted, handler.PersistentVolumeUpdated)
+		handler.PersistentVolumeStore = pvStore
+		allSynced = append(allSynced, pvController.HasSynced)
+		go pvController.Run(wait.NeverStop)
+	}
+
+	if watch("", "persistentvolumeclaims") {
+		pvcStore, pvcController := handler.CreatePersistentVolumeClaimController(clientset, "default", handler.PersistentVolumeClaimCreated, handler.PersistentVolumeClaimDeleted, handler.PersistentVolumeClaimUpdated)
+		handler.PersistentVolumeClaimStore = pvcStore
+		allSynced = append(allSynced, pvcController.HasSynced)
+		go pvcController.Run(wait.NeverStop)
+	}
+
+	if watch("storage.k8s.io", "storageclasses") {
+		scStore, scController := handler.CreateStorageClassController(clientset, handler.StorageClassCreated, handler.StorageClassDeleted, handler.StorageClassUpdated)
+		handler.StorageClassStore = scStore
+		allSynced = append(allSynced, scController.HasSynced)
+		go scController.Run(wait.NeverStop)
+	}
+
+	// Periodically check for PVCs / PVs stuck in Pending or Released
+	handler.StuckStorageThreshold = *stuckStorage
+	go wait.Until(handler.ReportStuckStorage, time.Minute, wait.NeverStop)
+
+	////////
+	//////// Watch ResourceQuotas and LimitRanges -- in all namespaces
+	////////
+
+	handler.QuotaThreshold = *quotaThreshold
+
+	if watch("", "resourcequotas") {
+		rqStore, rqController := handler.CreateResourceQuotaController(clientset, "", handler.ResourceQuotaCreated, handler.ResourceQuotaDeleted, handler.ResourceQuotaUpdated)
+		handler.ResourceQuotaStore = rqStore
+		allSynced = append(allSynced, rqController.HasSynced)
+		go rqController.Run(wait.NeverStop)
+	}
+
+	if watch("", "limitranges") {
+		lrStore, lrController := handler.CreateLimitRangeController(clientset, "", handler.LimitRangeCreated, handler.LimitRangeDeleted, handler.LimitRangeUpdated)
+		handler.LimitRangeStore = lrStore
+		allSynced = append(allSynced, lrController.HasSynced)
+		go lrController.Run(wait.NeverStop)
+	}
+
+	http.HandleFunc("/capacity", handler.CapacityHandler)
+
+	////////
+	//////// Watch Nodes, HorizontalPodAutoscalers and PodDisruptionBudgets
+	////////
+
+	if watch("", "nodes") {
+		nodeStore, nodeController := handler.CreateNodeController(clientset, handler.NodeCreated, handler.NodeDeleted, handler.NodeUpdated)
+		handler.NodeStore = nodeStore
+		topologySynced = append(topologySynced, nodeController.HasSynced)
+		allSynced = append(allSynced, nodeController.HasSynced)
+		go nodeController.Run(wait.NeverStop)
+	}
+
+	if watch("autoscaling", "horizontalpodautoscalers") {
+		hpaStore, hpaController := handler.CreateHorizontalPodAutoscalerController(clientset, "default", handler.HorizontalPodAutoscalerCreated, handler.HorizontalPodAutoscalerDeleted, handler.HorizontalPodAutoscalerUpdated)
+		handler.HorizontalPodAutoscalerStore = hpaStore
+		allSynced = append(allSynced, hpaController.HasSynced)
+		go hpaController.Run(wait.NeverStop)
+	}
+
+	if watch("policy", "poddisruptionbudgets") {
+		pdbStore, pdbController := handler.CreatePodDisruptionBudgetController(clientset, "default", handler.PodDisruptionBudgetCreated, handler.PodDisruptionBudgetDeleted, handler.PodDisruptionBudgetUpdated)
+		handler.PodDisruptionBudgetStore = pdbStore
+		allSynced = append(allSynced, pdbController.HasSynced)
+		go pdbController.Run(wait.NeverStop)
+	}
+
+	http.HandleFunc("/drain", handler.DrainHandler)
+
+	////////
+	//////// Watch CertificateSigningRequests (if supported) -- optionally approving / denying them according to the CSR rules
+	////////
+
+	switch *csrApproval {
+	case handler.CSRApprovalOff, handler.CSRApprovalDryRun, handler.CSRApprovalOn:
+		handler.CSRApproval = *csrApproval
+	default:
+		glog.Fatalf("Invalid -csr-approval %q. Expected one of: off, dry-run, on", *csrApproval)
+	}
+	handler.CSRRules = nil
+	for _, name := range strings.Split(*csrRules, ",") {
+		if name = strings.TrimSpace(name); name == "" {
+			continue
+		}
+		known := false
+		for _, n := range handler.CSRRuleNames() {
+			known = known || n == name
+		}
+		if !known {
+			glog.Fatalf("Invalid -csr-rules %q: unknown rule %q. Available: %s", *csrRules, name, strings.Join(handler.CSRRuleNames(), ", "))
+		}
+		handler.CSRRules = append(handler.CSRRules, name)
+	}
+
+	if UseCSR && watch("certificates.k8s.io", "certificatesigningrequests") {
+
+		csrStore, csrController := handler.CreateCertificateSigningRequestController(clientset, handler.CertificateSigningRequestCreated, handler.CertificateSigningRequestDeleted, handler.CertificateSigningRequestUpdated)
+		handler.CertificateSigningRequestStore = csrStore
+		allSynced = append(allSynced, csrController.HasSynced)
+		go csrController.Run(wait.NeverStop)
+
+	}
 
 	////////
-	//////// Watch Namespaces
+	//////// Watch Namespaces -- optionally provisioning the new ones with the baseline NetworkPolicies
 	////////
 
-	_, nsController := handler.CreateNamespaceController(clientset, handler.NamespaceCreated, handler.NamespaceDeleted, handler.NamespaceUpdated)
-	go nsController.Run(wait.NeverStop)
+	switch *provision {
+	case handler.ProvisionOff, handler.ProvisionDryRun, handler.ProvisionOn:
+		handler.ProvisionMode = *provision
+	default:
+		glog.Fatalf("Invalid -provision-netpol %q. Expected one of: off, dry-run, on", *provision)
+	}
+	if *provisionSel != "" {
+		selector, err := labels.Parse(*provisionSel)
+		if err != nil {
+			glog.Fatalf("Invalid -provision-selector %q. Error: %s", *provisionSel, err)
+		}
+		handler.ProvisionSelector = selector
+	}
+	if *provisionFile != "" {
+		policies, err := handler.LoadNetworkPolicies(*provisionFile)
+		if err != nil {
+			glog.Fatalf("Error loading the baseline NetworkPolicies from %s. Error: %s", *provisionFile, err)
+		}
+		handler.ProvisionPolicies = policies
+	}
+
+	if watch("", "namespaces") {
+		nsStore, nsController := handler.CreateNamespaceController(clientset, handler.NamespaceCreated, handler.NamespaceDeleted, handler.NamespaceUpdated)
+		handler.NamespaceStore = nsStore
+		netpolSynced = append(netpolSynced, nsController.HasSynced)
+		allSynced = append(allSynced, nsController.HasSynced)
+		go nsController.Run(wait.NeverStop)
+	}
 
 	////////
 	//////// Watch NetworkPolicies (if supported)
 	////////
 
-	if UseNetPolicies {
+	if UseNetPolicies && watch("extensions", "networkpolicies") {
 
-		_, npController := handler.CreateNetworkPolicyController(clientset, "default", handler.NetworkPolicyCreated, handler.NetworkPolicyDeleted, handler.NetworkPolicyUpdated)
+		npStore, npController := handler.CreateNetworkPolicyController(clientset, "default", handler.NetworkPolicyCreated, handler.NetworkPolicyDeleted, handler.NetworkPolicyUpdated)
+		handler.NetworkPolicyStore = npStore
+		netpolSynced = append(netpolSynced, npController.HasSynced)
+		allSynced = append(allSynced, npController.HasSynced)
 		go npController.Run(wait.NeverStop)
 
+		http.HandleFunc("/networkpolicies", handler.NetworkPolicySelectionsHandler)
+		http.HandleFunc("/connectivity", handler.ConnectivityHandler)
+		http.HandleFunc("/canreach", handler.CanReachHandler)
+		http.HandleFunc("/netpollint", handler.NetworkPolicyLintHandler)
+		http.HandleFunc("/simulate", handler.SimulateHandler)
+
+		// One-shot NetworkPolicy queries: wait for the Pod, Namespace and NetworkPolicy caches to be populated, print the answer and exit
+		if *netpolMatrix != "" || *canReach != "" || *netpolLint || *simulateNetpol != "" {
+			if !cache.WaitForCacheSync(wait.NeverStop, netpolSynced...) {
+				glog.Fatalf("Error synchronizing the Pod / Namespace / NetworkPolicy caches")
+			}
+			os.Exit(netpolQuery())
+		}
+
+		// Continuous lint checks -- once the caches are populated, so they don't report on partial state
+		if *lintInterval > 0 {
+			if *lintLog != "" {
+				f, err := os.OpenFile(*lintLog, os.O_APPEND|os.O_CREATE|os.O_WRONLY, 0600)
+				if err != nil {
+					glog.Fatalf("Error opening NetworkPolicy lint log file %s. Error: %s", *lintLog, err)
+				}
+				defer f.Close()
+				handler.LintLog = f
+			}
+			go func() {
+				if cache.WaitForCacheSync(wait.NeverStop, netpolSynced...) {
+					wait.Until(handler.ReportNetworkPolicyLint, *lintInterval, wait.NeverStop)
+				}
+			}()
+		}
+
+	} else if *netpolMatrix != "" || *canReach != "" || *netpolLint || *simulateNetpol != "" {
+		glog.Fatalf("NetworkPolicies are not supported by the Kubernetes API server, or we lack the permissions to watch them -- cannot answer -netpol-matrix / -can-reach / -netpol-lint / -simulate-netpol")
+	}
+
+	////////
+	//////// Topology graph: namespaces, Services, Pods, Nodes -- and the traffic the NetworkPolicies allow
+	////////
+
+	http.HandleFunc("/topology", handler.TopologyHandler)
+
+	if *topology != "" {
+		if !cache.WaitForCacheSync(wait.NeverStop, append(netpolSynced, topologySynced...)...) {
+			glog.Fatalf("Error synchronizing the caches")
+		}
+		if err := handler.WriteTopology(os.Stdout, handler.BuildTopology(""), *topology); err != nil {
+			glog.Errorf("Error writing the topology graph. Error: %s", err)
+			os.Exit(1)
+		}
+		os.Exit(0)
+	}
+
+	////////
+	//////// Watch ThirdPartyResources (if supported) -- and, dynamically, their instances in all namespaces
+	////////
+
+	if UseTPR && watch("extensions", "thirdpartyresources") {
+
+		handler.ClientConfig = config
+
+		_, tprController := handler.CreateThirdPartyResourceController(clientset, handler.ThirdPartyResourceCreated, handler.ThirdPartyResourceDeleted, handler.ThirdPartyResourceUpdated)
+		go tprController.Run(wait.NeverStop)
+
+	}
+
+	////////
+	//////// Watch RBAC objects (if supported): Roles, ClusterRoles, RoleBindings and ClusterRoleBindings -- in all namespaces
+	////////
+
+	// The RBAC watchers are all or nothing: the "who can" resolver needs all four caches
+	if UseRBAC && watch("rbac.authorization.k8s.io", "roles") && watch("rbac.authorization.k8s.io", "clusterroles") && watch("rbac.authorization.k8s.io", "rolebindings") && watch("rbac.authorization.k8s.io", "clusterrolebindings") {
+
+		if *rbacAuditLog != "" {
+			f, err := os.OpenFile(*rbacAuditLog, os.O_APPEND|os.O_CREATE|os.O_WRONLY, 0600)
+			if err != nil {
+				glog.Fatalf("Error opening RBAC audit log file %s. Error: %s", *rbacAuditLog, err)
+			}
+			defer f.Close()
+			handler.AuditLog = f
+		}
+
+		roleStore, roleController := handler.CreateRoleController(clientset, "", handler.RoleCreated, handler.RoleDeleted, handler.RoleUpdated)
+		handler.RoleStore = roleStore
+		allSynced = append(allSynced, roleController.HasSynced)
+		go roleController.Run(wait.NeverStop)
+
+		crStore, crController := handler.CreateClusterRoleController(clientset, handler.ClusterRoleCreated, handler.ClusterRoleDeleted, handler.ClusterRoleUpdated)
+		handler.ClusterRoleStore = crStore
+		allSynced = append(allSynced, crController.HasSynced)
+		go crController.Run(wait.NeverStop)
+
+		rbStore, rbController := handler.CreateRoleBindingController(clientset, "", handler.RoleBindingCreated, handler.RoleBindingDeleted, handler.RoleBindingUpdated)
+		handler.RoleBindingStore = rbStore
+		allSynced = append(allSynced, rbController.HasSynced)
+		go rbController.Run(wait.NeverStop)
+
+		crbStore, crbController := handler.CreateClusterRoleBindingController(clientset, handler.ClusterRoleBindingCreated, handler.ClusterRoleBindingDeleted, handler.ClusterRoleBindingUpdated)
+		handler.ClusterRoleBindingStore = crbStore
+		allSynced = append(allSynced, crbController.HasSynced)
+		go crbController.Run(wait.NeverStop)
+
+		http.HandleFunc("/whocan", handler.WhoCanHandler(clientset))
+		http.HandleFunc("/whatcan", handler.WhatCanHandler)
+
+		// One-shot "who can" / "what can" queries: wait for the RBAC caches to be populated, print the answer and exit
+		if *whoCan != "" || *whatCan != "" {
+			if !cache.WaitForCacheSync(wait.NeverStop, roleController.HasSynced, crController.HasSynced, rbController.HasSynced, crbController.HasSynced) {
+				glog.Fatalf("Error synchronizing the RBAC caches")
+			}
+			os.Exit(rbacQuery(clientset))
+		}
+
+	} else if *whoCan != "" || *whatCan != "" {
+		glog.Fatalf("RBAC (rbac.authorization.k8s.io/v1alpha1) is not supported by the Kubernetes API server, or we lack the permissions to watch it -- cannot answer -who-can / -what-can")
+	}
+
+	////////
+	//////// Desired state drift: the manifests of a directory against the live objects
+	////////
+
+	if *manifests != "" {
+		// Fail early on unreadable / invalid manifests -- later on, they are reloaded on each check
+		if _, err := handler.LoadManifests(*manifests); err != nil {
+			glog.Fatalf("Error loading the manifests from %s. Error: %s", *manifests, err)
+		}
+		handler.ManifestsDir = *manifests
+		http.HandleFunc("/manifestdrift", handler.ManifestDriftHandler)
+
+		if *manifestDrift {
+			if !cache.WaitForCacheSync(wait.NeverStop, allSynced...) {
+				glog.Fatalf("Error synchronizing the caches")
+			}
+			os.Exit(manifestDriftQuery())
+		}
+
+		// Continuous checks -- once the caches are populated, so they don't report on partial state
+		if *driftInterval > 0 {
+			if *driftLog != "" {
+				f, err := os.OpenFile(*driftLog, os.O_APPEND|os.O_CREATE|os.O_WRONLY, 0600)
+				if err != nil {
+					glog.Fatalf("Error opening manifest drift log file %s. Error: %s", *driftLog, err)
+				}
+				defer f.Close()
+				handler.ManifestDriftLog = f
+			}
+			go func() {
+				if cache.WaitForCacheSync(wait.NeverStop, allSynced...) {
+					wait.Until(func() { handler.ReportManifestDrift(*manifests) }, *driftInterval, wait.NeverStop)
+				}
+			}()
+		}
+
+	} else if *manifestDrift {
+		glog.Fatalf("-manifest-drift needs -manifests")
+	}
+
+	////////
+	//////// Snapshots of all the watched objects
+	////////
+
+	http.HandleFunc("/snapshot", handler.SnapshotHandler)
+
+	if *snapshot != "" {
+		if !cache.WaitForCacheSync(wait.NeverStop, allSynced...) {
+			glog.Fatalf("Error synchronizing the caches")
+		}
+		if err := handler.SaveSnapshot(*snapshot); err != nil {
+			glog.Errorf("Error writing snapshot %s. Error: %s", *snapshot, err)
+			os.Exit(1)
+		}
+		glog.Infof("Snapshot written to %s", *snapshot)
+		os.Exit(0)
 	}
+
 	//Keep alive
 	glog.Error(http.ListenAndServe(":8099", nil))
 
 }
+
+// rbacQuery answers the -who-can / -what-can queries (from the RBAC caches). Returns the exit code
+func rbacQuery(clientset *kubernetes.Clientset) int {
+	if *whoCan != "" {
+		parts := strings.Split(*whoCan, ",")
+		if len(parts) < 3 || len(parts) > 4 {
+			glog.Errorf("Invalid -who-can %q. Expected: verb,resource,namespace[,apiGroup]", *whoCan)
+			return 1
+		}
+		verb, resource, namespace, group := parts[0], parts[1], parts[2], ""
+		if len(parts) == 4 {
+			group = parts[3]
+		}
+
+		grants := handler.WhoCan(verb, group, resource, namespace)
+		fmt.Printf("Who can %q %q (API group %q) in namespace %q:\n", verb, resource, group, namespace)
+		handler.PrintGrants(os.Stdout, grants)
+
+		if *crossCheck {
+			fmt.Printf("Cross-check against the API server (SubjectAccessReview):\n")
+			handler.PrintCrossChecks(os.Stdout, handler.CrossCheckWhoCan(clientset, verb, group, resource, namespace, grants))
+		}
+	}
+
+	if *whatCan != "" {
+		subject, err := handler.ParseSubject(*whatCan)
+		if err != nil {
+			glog.Errorf("Invalid -what-can. Error: %s", err)
+			return 1
+		}
+		fmt.Printf("What can %s do:\n", *whatCan)
+		handler.PrintGrants(os.Stdout, handler.WhatCan(subject))
+	}
+
+	return 0
+}
+
+// netpolQuery answers the -netpol-matrix / -can-reach / -netpol-lint / -simulate-netpol queries (from the Pod, Namespace and NetworkPolicy caches). Returns the exit code
+func netpolQuery() int {
+	if *canReach != "" {
+		parts := strings.Split(*canReach, ",")
+		if len(parts) != 3 {
+			glog.Errorf("Invalid -can-reach %q. Expected: namespace/source,namespace/destination,port", *canReach)
+			return 1
+		}
+		src, err := handler.LookupPod(parts[0])
+		if err != nil {
+			glog.Errorf("Invalid -can-reach source. Error: %s", err)
+			return 1
+		}
+		dst, err := handler.LookupPod(parts[1])
+		if err != nil {
+			glog.Errorf("Invalid -can-reach destination. Error: %s", err)
+			return 1
+		}
+		ports, err := handler.ParseFlowPorts(parts[2])
+		if err != nil {
+			glog.Errorf("Invalid -can-reach port. Error: %s", err)
+			return 1
+		}
+		handler.PrintReachExplanation(os.Stdout, handler.ExplainReach(handler.CachedNetworkPolicies(), src, dst, ports[0]))
+	}
+
+	if *netpolLint {
+		fmt.Printf("NetworkPolicy lint findings:\n")
+		handler.PrintLintFindings(os.Stdout, handler.LintNetworkPolicies())
+	}
+
+	if *simulateNetpol != "" {
+		proposed, err := handler.LoadNetworkPolicies(*simulateNetpol)
+		if err != nil {
+			glog.Errorf("Error loading the NetworkPolicies from %s. Error: %s", *simulateNetpol, err)
+			return 1
+		}
+		ports, err := handler.ParseFlowPorts(*matrixPorts)
+		if err != nil {
+			glog.Errorf("Invalid -matrix-ports. Error: %s", err)
+			return 1
+		}
+		handler.PrintSimulation(os.Stdout, handler.SimulateNetworkPolicies(proposed, ports))
+	}
+
+	if *netpolMatrix == "" {
+		return 0
+	}
+
+	ports, err := handler.ParseFlowPorts(*matrixPorts)
+	if err != nil {
+		glog.Errorf("Invalid -matrix-ports. Error: %s", err)
+		return 1
+	}
+
+	m, err := handler.ComputeConnectivity(handler.CachedNetworkPolicies(), *matrixGroup, ports)
+	if err != nil {
+		glog.Errorf("Invalid -matrix-group. Error: %s", err)
+		return 1
+	}
+	if err := handler.WriteConnectivity(os.Stdout, m, *netpolMatrix); err != nil {
+		glog.Errorf("Error writing the connectivity matrix. Error: %s", err)
+		return 1
+	}
+	return 0
+}
+
+// diffSnapshots answers the -snapshot-diff query. Returns the exit code
+func diffSnapshots() int {
+	files := strings.Split(*snapshotDiff, ",")
+	if len(files) != 2 {
+		glog.Errorf("Invalid -snapshot-diff %q. Expected: old,new", *snapshotDiff)
+		return 1
+	}
+	old, err := handler.LoadSnapshot(files[0])
+	if err != nil {
+		glog.Errorf("Error loading snapshot. Error: %s", err)
+		return 1
+	}
+	updated, err := handler.LoadSnapshot(files[1])
+	if err != nil {
+		glog.Errorf("Error loading snapshot. Error: %s", err)
+		return 1
+	}
+	diff, err := handler.DiffSnapshots(old, updated)
+	if err != nil {
+		glog.Errorf("Error comparing the snapshots. Error: %s", err)
+		return 1
+	}
+	if err := handler.WriteSnapshotDiff(os.Stdout, diff, *diffFormat); err != nil {
+		glog.Errorf("Error writing the snapshot diff. Error: %s", err)
+		return 1
+	}
+	return 0
+}
+
+// manifestDriftQuery answers the -manifest-drift query. Returns the exit code
+func manifestDriftQuery() int {
+	m, err := handler.LoadManifests(*manifests)
+	if err != nil {
+		glog.Errorf("Error loading the manifests from %s. Error: %s", *manifests, err)
+		return 1
+	}
+	fmt.Printf("Drift between the manifests in %s and the live objects:\n", *manifests)
+	handler.PrintManifestDrift(os.Stdout, handler.ManifestDrift(m))
+	return 0
+}